@@ -0,0 +1,359 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"slices"
+	"sync/atomic"
+)
+
+// Tx represents a batch of changes of the grid, which are applied together once the
+// batch function returns without an error. A transaction must not be used outside of
+// the batch function.
+type Tx[T comparable] struct {
+	grid   *Grid[T]    // The associated map
+	ops    []txOp[T]   // The changes to apply, in order
+	reads  []ValueAt   // The values read during the batch, for validation
+	pages  []int       // The indices of the pages to lock
+	tiles  []txTile    // The expected values of the tiles of the locked pages
+	out    []Update[T] // The notifications of the applied changes
+	origin uint32      // The origin of the changes
+}
+
+// txOp represents a single change within a batch
+type txOp[T comparable] struct {
+	kind   txKind            // The kind of the change
+	at     Point             // The point of the tile
+	value  Value             // The value to write
+	merge  func(Value) Value // The merge function
+	object T                 // The object to add or remove
+	before Value             // The value of the tile before the change, once applied
+	after  Value             // The value of the tile after the change, once applied
+}
+
+// txTile represents the value a tile is expected to have while applying a batch, if it
+// was either read or already changed by the batch.
+type txTile struct {
+	value Value
+	known bool
+}
+
+// txKind represents a kind of change within a batch
+type txKind uint8
+
+// Various kinds of changes
+const (
+	txWrite txKind = iota
+	txMerge
+	txAdd
+	txDel
+)
+
+// Batch applies a set of changes across several tiles atomically. The function
+// records the changes on the transaction and can abort the whole batch by returning
+// an error, in which case nothing is applied and the error is returned.
+//
+// The pages are locked in a fixed order while the changes are applied, so batches
+// never deadlock and are isolated from each other, from the objects being added,
+// removed or moved, as well as from the writes of single tiles, which wait for the
+// batch to be applied. Before applying, every value read through the transaction
+// is validated against the grid and, if another writer has changed it in the meantime,
+// the function is called again, so it must be free of side effects. Each observer then
+// receives all of its updates of the batch at once, after the changes are applied, in
+// a single group which is never interleaved with other updates.
+func (m *Grid[T]) Batch(fn func(tx *Tx[T]) error) error {
+	tx := m.txs.Get().(*Tx[T])
+	defer m.txs.Put(tx)
+	for {
+		tx.reset()
+		if err := fn(tx); err != nil {
+			return err
+		}
+
+		if tx.commit() {
+			break
+		}
+	}
+
+	m.notifyBatch(tx.out)
+	return nil
+}
+
+// ValueAt returns the value of a tile, as it would be with the changes recorded so
+// far, and whether the tile is within the grid.
+func (tx *Tx[T]) ValueAt(x, y int16) (Value, bool) {
+	at, ok := tx.pointAt(x, y)
+	if !ok {
+		return 0, false
+	}
+
+	value := tx.grid.valueAt(at.X, at.Y)
+	tx.reads = append(tx.reads, ValueAt{Point: at, Value: value})
+	for _, op := range tx.ops {
+		if op.at == at {
+			value = op.apply(value)
+		}
+	}
+	return value, true
+}
+
+// WriteAt records an update of the entire tile at a specific coordinate.
+func (tx *Tx[T]) WriteAt(x, y int16, tile Value) {
+	tx.record(x, y, txOp[T]{kind: txWrite, value: tile})
+}
+
+// MaskAt records an update of the bits of a tile at a specific coordinate. The bits
+// that need to be updated should be flipped on in the mask.
+func (tx *Tx[T]) MaskAt(x, y int16, tile, mask Value) {
+	tx.MergeAt(x, y, func(value Value) Value {
+		return (value &^ mask) | (tile & mask)
+	})
+}
+
+// MergeAt records an update of a tile at a specific coordinate, given a merging
+// function which is applied on the value of the tile once the batch is applied.
+func (tx *Tx[T]) MergeAt(x, y int16, merge func(Value) Value) {
+	tx.record(x, y, txOp[T]{kind: txMerge, merge: merge})
+}
+
+// SetOrigin tags the changes of the batch with their origin, such as the identifier
+// of a player or of a replica, which is then carried by each of the updates.
+func (tx *Tx[T]) SetOrigin(origin uint32) {
+	tx.origin = origin
+}
+
+// Add records an object to add to a tile at a specific coordinate.
+func (tx *Tx[T]) Add(x, y int16, object T) {
+	tx.record(x, y, txOp[T]{kind: txAdd, object: object})
+}
+
+// Del records an object to remove from a tile at a specific coordinate.
+func (tx *Tx[T]) Del(x, y int16, object T) {
+	tx.record(x, y, txOp[T]{kind: txDel, object: object})
+}
+
+// record records a change of the tile at a specific coordinate, if within the grid
+func (tx *Tx[T]) record(x, y int16, op txOp[T]) {
+	if at, ok := tx.pointAt(x, y); ok {
+		op.at = at
+		tx.ops = append(tx.ops, op)
+	}
+}
+
+// pointAt returns the point at a specific coordinate, and whether it is in the grid
+func (tx *Tx[T]) pointAt(x, y int16) (Point, bool) {
+	x, y = tx.grid.wrapAt(x, y)
+	return At(x, y), x >= 0 && y >= 0 && x < tx.grid.Size.X && y < tx.grid.Size.Y
+}
+
+// reset clears the transaction, so the batch function can be called again
+func (tx *Tx[T]) reset() {
+	clear(tx.ops)
+	tx.ops = tx.ops[:0]
+	tx.reads = tx.reads[:0]
+	tx.pages = tx.pages[:0]
+	tx.origin = 0
+	clear(tx.out)
+	tx.out = tx.out[:0]
+}
+
+// commit locks the pages in order, validates the values which were read and applies
+// the changes. It returns false if the validation has failed and nothing was applied.
+func (tx *Tx[T]) commit() bool {
+	m := tx.grid
+	for _, op := range tx.ops {
+		tx.pages = append(tx.pages, m.pageIndex(op.at))
+	}
+	for _, read := range tx.reads {
+		tx.pages = append(tx.pages, m.pageIndex(read.Point))
+	}
+
+	// Always lock the pages in the order of their index, so that the concurrent
+	// batches can not deadlock each other.
+	slices.Sort(tx.pages)
+	tx.pages = slices.Compact(tx.pages)
+	for _, i := range tx.pages {
+		m.pages[i].lockBatch()
+		m.pages[i].beginWrite(m, true)
+	}
+	defer func() {
+		for _, i := range tx.pages {
+			m.pages[i].unlockBatch()
+		}
+	}()
+
+	// Validate that none of the values we've read has changed since
+	tx.tiles = slices.Grow(tx.tiles[:0], 9*len(tx.pages))[:9*len(tx.pages)]
+	clear(tx.tiles)
+	for _, read := range tx.reads {
+		if m.valueAt(read.X, read.Y) != read.Value {
+			return false
+		}
+
+		*tx.tileOf(read.Point) = txTile{value: read.Value, known: true}
+	}
+
+	// Apply the values first, since a write of a single tile which has missed the lock
+	// of its page might still replace one of them, in which case the values which were
+	// already applied are reverted and the batch is retried.
+	for i := range tx.ops {
+		if !tx.swapOn(&tx.ops[i]) {
+			tx.revert(i)
+			return false
+		}
+	}
+
+	for i := range tx.ops {
+		tx.applyOn(&m.pages[m.pageIndex(tx.ops[i].at)], &tx.ops[i])
+	}
+	return true
+}
+
+// tileOf returns the expected value of a tile of one of the locked pages
+func (tx *Tx[T]) tileOf(at Point) *txTile {
+	i, _ := slices.BinarySearch(tx.pages, tx.grid.pageIndex(at))
+	return &tx.tiles[9*i+int(tileIndex(at))]
+}
+
+// swapOn applies a change of a value on a locked page, and returns false if the tile
+// no longer has the value which was expected.
+func (tx *Tx[T]) swapOn(op *txOp[T]) bool {
+	if op.kind != txWrite && op.kind != txMerge {
+		return true
+	}
+
+	p, idx := &tx.grid.pages[tx.grid.pageIndex(op.at)], tileIndex(op.at)
+	expect := tx.tileOf(op.at)
+	switch {
+	case expect.known:
+		op.before, op.after = expect.value, op.apply(expect.value)
+		if !atomic.CompareAndSwapUint32(&p.tiles[idx], uint32(op.before), uint32(op.after)) {
+			return false
+		}
+	default:
+		op.before = p.tileAt(idx)
+		op.after = op.apply(op.before)
+		for !atomic.CompareAndSwapUint32(&p.tiles[idx], uint32(op.before), uint32(op.after)) {
+			op.before = p.tileAt(idx)
+			op.after = op.apply(op.before)
+		}
+	}
+
+	*expect = txTile{value: op.after, known: true}
+	return true
+}
+
+// revert reverts the values which were applied by the first n changes, in reverse
+// order. A tile which was replaced in the meantime by a write which has missed the lock
+// is left as is, since that write was made on the value from before the batch.
+func (tx *Tx[T]) revert(n int) {
+	for i := n - 1; i >= 0; i-- {
+		if op := &tx.ops[i]; op.kind == txWrite || op.kind == txMerge {
+			p := &tx.grid.pages[tx.grid.pageIndex(op.at)]
+			atomic.CompareAndSwapUint32(&p.tiles[tileIndex(op.at)], uint32(op.after), uint32(op.before))
+		}
+	}
+}
+
+// applyOn applies a single change of the objects on a locked page, and records the
+// notification of the change, once all of the values have been applied.
+func (tx *Tx[T]) applyOn(p *page[T], op *txOp[T]) {
+	idx := tileIndex(op.at)
+	update := Update[T]{Origin: tx.origin}
+	switch op.kind {
+	case txWrite, txMerge:
+		update.Old = ValueAt{Point: op.at, Value: op.before}
+		update.New = ValueAt{Point: op.at, Value: op.after}
+		update.Kind = ValueChanged | BatchApplied
+	case txAdd:
+		if p.state == nil {
+			p.state = make(map[T]uint8)
+		}
+
+		if prev, ok := p.state[op.object]; ok && prev == idx {
+			return // Already on the tile
+		}
+
+		p.state[op.object] = idx
+		update.Add = op.object
+		update.Kind = ObjectAdded | BatchApplied
+	case txDel:
+		if at, ok := p.state[op.object]; !ok || at != idx {
+			return // Not on the tile
+		}
+
+		delete(p.state, op.object)
+		update.Del = op.object
+		update.Kind = ObjectRemoved | BatchApplied
+	}
+
+	if !p.IsObserved() {
+		return
+	}
+
+	if op.kind == txAdd || op.kind == txDel {
+		value := p.tileAt(idx)
+		update.Old = ValueAt{Point: op.at, Value: value}
+		update.New = ValueAt{Point: op.at, Value: value}
+	}
+
+	update.Seq = tx.grid.seq.Add(1)
+	tx.out = append(tx.out, update)
+}
+
+// apply applies a value change on the current value of a tile
+func (op *txOp[T]) apply(value Value) Value {
+	switch op.kind {
+	case txWrite:
+		return op.value
+	case txMerge:
+		return op.merge(value)
+	default:
+		return value
+	}
+}
+
+// pageIndex returns the index of the page containing a point within the grid
+func (m *Grid[T]) pageIndex(at Point) int {
+	return int(at.X/3) + int(m.pageWidth)*int(at.Y/3)
+}
+
+// tileIndex returns the index of a tile within its page
+func tileIndex(at Point) uint8 {
+	return uint8((at.Y%3)*3 + (at.X % 3))
+}
+
+// notifyBatch notifies every observer of its updates of a batch, in a single group
+func (m *Grid[T]) notifyBatch(updates []Update[T]) {
+	if len(updates) == 0 {
+		return
+	}
+
+	groups := make(map[Observer[T]][]Update[T], 4)
+	for i := range updates {
+		ev := &updates[i]
+		m.observers.Each1(func(sub Observer[T]) {
+			if m.contains(sub.Viewport(), ev.New.Point) {
+				groups[sub] = append(groups[sub], *ev)
+			}
+		}, At(ev.New.X/3*3, ev.New.Y/3*3))
+	}
+
+	for sub, group := range groups {
+		if b, ok := sub.(batchObserver[T]); ok {
+			b.onBatch(group)
+			continue
+		}
+
+		for i := range group {
+			sub.onUpdate(&group[i])
+		}
+	}
+}
+
+// batchObserver represents an observer which can receive the updates of a batch in
+// a single group.
+type batchObserver[T comparable] interface {
+	onBatch([]Update[T])
+}
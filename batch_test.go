@@ -0,0 +1,322 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+cpu: Intel(R) Xeon(R) Processor
+BenchmarkBatch/write        	 2144454	       611.3 ns/op	       0 B/op	       0 allocs/op
+BenchmarkBatch/observed     	  312560	      3988 ns/op	    1616 B/op	       5 allocs/op
+*/
+func BenchmarkBatch(b *testing.B) {
+	m := NewGrid(768, 768)
+	building := func(tx *Tx[string]) error {
+		for y := int16(100); y < 104; y++ {
+			for x := int16(100); x < 103; x++ {
+				tx.WriteAt(x, y, Value(0xff))
+			}
+		}
+		return nil
+	}
+
+	b.Run("write", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			m.Batch(building)
+		}
+	})
+
+	b.Run("observed", func(b *testing.B) {
+		v := NewView(m, "view 1")
+		v.Resize(NewRect(90, 90, 110, 110), nil)
+		defer v.Close()
+
+		go func() {
+			for range v.Inbox {
+			}
+		}()
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			m.Batch(building)
+		}
+	})
+}
+
+func TestBatch(t *testing.T) {
+	m := NewGrid(9, 9)
+	v := NewView(m, "view 1")
+	v.Resize(NewRect(0, 0, 9, 9), nil)
+	defer v.Close()
+
+	// Place a 3x4 building across several pages, along with its owner
+	assert.NoError(t, m.Batch(func(tx *Tx[string]) error {
+		for y := int16(1); y < 5; y++ {
+			for x := int16(2); x < 5; x++ {
+				tx.WriteAt(x, y, Value(1))
+			}
+		}
+
+		tx.Add(2, 1, "A")
+		tx.MaskAt(4, 4, 0b10, 0b10)
+		return nil
+	}))
+
+	for y := int16(1); y < 5; y++ {
+		for x := int16(2); x < 5; x++ {
+			tile, _ := m.At(x, y)
+			assert.NotZero(t, tile.Value())
+		}
+	}
+
+	tile, _ := m.At(4, 4)
+	assert.Equal(t, Value(0b11), tile.Value())
+	tile, _ = m.At(2, 1)
+	assert.Equal(t, 1, tile.Count())
+
+	// All of the updates are delivered at once
+	assert.Len(t, v.Inbox, 14)
+	updates := make([]Update[string], 0, 14)
+	for len(v.Inbox) > 0 {
+		updates = append(updates, <-v.Inbox)
+	}
+
+	assert.Equal(t, "A", updates[12].Add)
+	assert.Equal(t, At(4, 4), updates[13].New.Point)
+	assert.Equal(t, Value(1), updates[13].Old.Value)
+	assert.Equal(t, Value(0b11), updates[13].New.Value)
+
+	// Remove the owner
+	assert.NoError(t, m.Batch(func(tx *Tx[string]) error {
+		tx.Del(2, 1, "A")
+		return nil
+	}))
+
+	assert.Equal(t, "A", (<-v.Inbox).Del)
+	assert.Equal(t, 0, tile.Count())
+}
+
+func TestBatchAbort(t *testing.T) {
+	m := NewGrid(9, 9)
+	m.WriteAt(3, 3, Value(1))
+
+	errOccupied := errors.New("occupied")
+	err := m.Batch(func(tx *Tx[string]) error {
+		for y := int16(2); y < 5; y++ {
+			for x := int16(2); x < 5; x++ {
+				if v, _ := tx.ValueAt(x, y); v != 0 {
+					return errOccupied
+				}
+				tx.WriteAt(x, y, Value(2))
+			}
+		}
+		return nil
+	})
+
+	// Nothing was written
+	assert.Equal(t, errOccupied, err)
+	m.Each(func(p Point, tile Tile[string]) {
+		if p != At(3, 3) {
+			assert.Zero(t, tile.Value())
+		}
+	})
+}
+
+func TestBatchValueAt(t *testing.T) {
+	m := NewGrid(9, 9, WithWrap(true, false))
+	m.WriteAt(8, 0, Value(1))
+
+	assert.NoError(t, m.Batch(func(tx *Tx[string]) error {
+		v, ok := tx.ValueAt(-1, 0)
+		assert.True(t, ok)
+		assert.Equal(t, Value(1), v)
+
+		// The recorded changes are visible within the batch
+		tx.WriteAt(8, 0, Value(2))
+		tx.MergeAt(8, 0, func(v Value) Value { return v + 1 })
+		v, _ = tx.ValueAt(8, 0)
+		assert.Equal(t, Value(3), v)
+
+		// Outside of the grid
+		_, ok = tx.ValueAt(0, 9)
+		assert.False(t, ok)
+		tx.WriteAt(0, 9, Value(2))
+		return nil
+	}))
+
+	tile, _ := m.At(8, 0)
+	assert.Equal(t, Value(3), tile.Value())
+}
+
+func TestBatchConcurrent(t *testing.T) {
+	const workers = 8
+	m := NewGrid(9, 9)
+
+	// Every worker tries to claim the same area, only one of them must succeed
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	claimed := 0
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(owner Value) {
+			defer wg.Done()
+			err := m.Batch(func(tx *Tx[string]) error {
+				for y := int16(1); y < 8; y++ {
+					for x := int16(7); x > 0; x-- {
+						if v, _ := tx.ValueAt(x, y); v != 0 {
+							return errors.New("claimed")
+						}
+						tx.WriteAt(x, y, owner)
+					}
+				}
+				return nil
+			})
+
+			if err == nil {
+				mu.Lock()
+				claimed++
+				mu.Unlock()
+			}
+		}(Value(i + 1))
+	}
+
+	wg.Wait()
+	assert.Equal(t, 1, claimed)
+
+	// All of the tiles belong to the same owner
+	owner, _ := m.At(1, 1)
+	for p, tile := range m.InRect(NewRect(1, 1, 8, 8)) {
+		assert.Equal(t, owner.Value(), tile.Value(), p.String())
+	}
+}
+
+func TestBatchIsolation(t *testing.T) {
+	const writes = 2000
+	m := NewGrid(9, 9)
+
+	// The batches and the single writes both increment the same tile, so none of the
+	// increments is lost if the single writes never land within a batch.
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < writes; i++ {
+			m.Batch(func(tx *Tx[string]) error {
+				v, _ := tx.ValueAt(1, 1)
+				tx.WriteAt(1, 1, v+1)
+				return nil
+			})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < writes; i++ {
+			m.MergeAt(1, 1, func(v Value) Value { return v + 1 })
+		}
+	}()
+
+	wg.Wait()
+	assert.Equal(t, Value(2*writes), m.valueAt(1, 1))
+
+	// A single write waits for the batch which holds the page
+	page := m.pageAt(0, 0)
+	page.lockBatch()
+	done := make(chan struct{})
+	go func() {
+		m.WriteAt(1, 1, 0)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		assert.Fail(t, "write within a batch")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	page.unlockBatch()
+	<-done
+	assert.Zero(t, m.valueAt(1, 1))
+}
+
+func TestBatchRevert(t *testing.T) {
+	m := NewGrid(9, 9)
+	m.WriteAt(1, 1, 1)
+	m.WriteAt(4, 4, 1)
+
+	// The batch has applied its changes on two tiles, while a write which has missed
+	// the lock has replaced one of them with a value from before the batch.
+	tx := &Tx[string]{grid: m}
+	tx.WriteAt(1, 1, 2)
+	tx.WriteAt(4, 4, 2)
+	tx.WriteAt(7, 7, 2)
+	for i := range tx.ops[:2] {
+		tx.ops[i].before, tx.ops[i].after = 1, 2
+	}
+
+	m.WriteAt(1, 1, 2)
+	m.WriteAt(4, 4, 3)
+	tx.revert(2)
+	assert.Equal(t, Value(1), m.valueAt(1, 1))
+	assert.Equal(t, Value(3), m.valueAt(4, 4))
+	assert.Equal(t, Value(0), m.valueAt(7, 7))
+}
+
+func TestBatchObserver(t *testing.T) {
+	m := NewGrid(9, 9)
+	h := NewHierarchy(m, 3, costOf)
+	defer h.Close()
+
+	// Observers which don't support batches still receive every update
+	h.Path(At(0, 0), At(8, 8))
+	assert.NoError(t, m.Batch(func(tx *Tx[string]) error {
+		tx.WriteAt(4, 0, Value(1))
+		tx.WriteAt(4, 1, Value(1))
+		return nil
+	}))
+
+	assert.True(t, h.stale.Load())
+}
+
+func TestBatchOrigin(t *testing.T) {
+	m := NewGridOf[uint32](9, 9)
+	v := NewView(m, "view 1")
+	v.Resize(NewRect(0, 0, 9, 9), nil)
+	defer v.Close()
+
+	// The updates of the batch carry its origin and are marked as such
+	assert.NoError(t, m.Batch(func(tx *Tx[uint32]) error {
+		tx.SetOrigin(7)
+		tx.WriteAt(1, 1, Value(1))
+		tx.Add(1, 1, 0)
+		tx.Del(1, 1, 0)
+		return nil
+	}))
+
+	for i, kind := range []UpdateKind{ValueChanged, ObjectAdded, ObjectRemoved} {
+		ev := <-v.Inbox
+		assert.Equal(t, kind|BatchApplied, ev.Kind)
+		assert.Equal(t, uint32(7), ev.Origin)
+		assert.Equal(t, uint64(i+1), ev.Seq)
+	}
+
+	// The origin is not carried over to the next batch
+	assert.NoError(t, m.Batch(func(tx *Tx[uint32]) error {
+		tx.WriteAt(1, 1, Value(2))
+		return nil
+	}))
+
+	ev := <-v.Inbox
+	assert.Zero(t, ev.Origin)
+	assert.Equal(t, uint64(4), ev.Seq)
+}
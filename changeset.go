@@ -0,0 +1,186 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+// ChangeSet represents the net changes of the tiles within a view since the previous
+// flush, such as the changes which happened during a tick of the server.
+type ChangeSet[T comparable] struct {
+	Values  []ValueAt     // The final value of each tile which has changed
+	Added   []ObjectAt[T] // The objects which were added to a tile
+	Removed []ObjectAt[T] // The objects which were removed from a tile
+}
+
+// ObjectAt represents an object within a tile.
+type ObjectAt[T comparable] struct {
+	Point    // The point of the tile
+	Object T // The object
+}
+
+// IsEmpty returns whether the change set has no changes.
+func (c ChangeSet[T]) IsEmpty() bool {
+	return len(c.Values) == 0 && len(c.Added) == 0 && len(c.Removed) == 0
+}
+
+// Flush returns the net changes accumulated since the previous flush, when the view
+// delivers its updates with DeliverChangeSet. A tile whose value was changed back to
+// its value of the previous flush is not part of the change set, and neither is an
+// object which was added and then removed from the same tile, and vice versa.
+func (v *View[S, T]) Flush() (out ChangeSet[T]) {
+	v.send.Lock()
+	defer v.send.Unlock()
+	v.changes.flush(func(at Point, value Value) {
+		out.Values = append(out.Values, ValueAt{Point: at, Value: value})
+	}, func(at Point, object T, added bool) {
+		if added {
+			out.Added = append(out.Added, ObjectAt[T]{Point: at, Object: object})
+		} else {
+			out.Removed = append(out.Removed, ObjectAt[T]{Point: at, Object: object})
+		}
+	})
+	return
+}
+
+// WorldChangeSet represents the net changes of the tiles within a world view since the
+// previous flush, with world coordinates.
+type WorldChangeSet[T comparable] struct {
+	Values  []WorldValueAt     // The final value of each tile which has changed
+	Added   []WorldObjectAt[T] // The objects which were added to a tile
+	Removed []WorldObjectAt[T] // The objects which were removed from a tile
+}
+
+// WorldObjectAt represents an object within a tile of a world.
+type WorldObjectAt[T comparable] struct {
+	WorldPoint   // The point of the tile
+	Object     T // The object
+}
+
+// IsEmpty returns whether the change set has no changes.
+func (c WorldChangeSet[T]) IsEmpty() bool {
+	return len(c.Values) == 0 && len(c.Added) == 0 && len(c.Removed) == 0
+}
+
+// Flush returns the net changes accumulated since the previous flush, when the view
+// delivers its updates with DeliverChangeSet, as for the views of a grid.
+func (v *WorldView[S, T]) Flush() (out WorldChangeSet[T]) {
+	v.send.Lock()
+	defer v.send.Unlock()
+	v.changes.flush(func(at WorldPoint, value Value) {
+		out.Values = append(out.Values, WorldValueAt{WorldPoint: at, Value: value})
+	}, func(at WorldPoint, object T, added bool) {
+		if added {
+			out.Added = append(out.Added, WorldObjectAt[T]{WorldPoint: at, Object: object})
+		} else {
+			out.Removed = append(out.Removed, WorldObjectAt[T]{WorldPoint: at, Object: object})
+		}
+	})
+	return
+}
+
+// changeSet represents the changes which were accumulated since the last flush, in
+// the order in which the tiles have first changed.
+type changeSet[P comparable, T comparable] struct {
+	values  []valueChange[P]        // The changes of the values
+	objects []objectChange[P, T]    // The changes of the objects
+	byValue map[P]int               // The position of the change of each value
+	byObj   map[objectKey[P, T]]int // The position of the change of each object
+}
+
+// valueChange represents the change of a value since the last flush
+type valueChange[P comparable] struct {
+	at     P     // The point of the tile
+	old    Value // The value as of the last flush
+	new    Value // The latest value
+	forced bool  // Whether the tile was revealed by the fog of war
+}
+
+// objectKey represents an object within a tile
+type objectKey[P comparable, T comparable] struct {
+	at     P // The point of the tile
+	object T // The object
+}
+
+// objectChange represents the change of an object since the last flush
+type objectChange[P comparable, T comparable] struct {
+	objectKey[P, T]
+	before bool // Whether the object was on the tile as of the last flush
+	after  bool // Whether the object is on the tile now
+}
+
+// record accumulates an update into the change set
+func (c *changeSet[P, T]) record(ev change[P, T]) {
+	switch {
+	case ev.kind&ValueChanged != 0:
+		c.recordValue(ev)
+	case ev.kind&ObjectMoved != 0:
+		c.recordObject(objectKey[P, T]{at: ev.old, object: ev.del}, false)
+		c.recordObject(objectKey[P, T]{at: ev.new, object: ev.add}, true)
+	case ev.kind&ObjectAdded != 0:
+		c.recordObject(objectKey[P, T]{at: ev.new, object: ev.add}, true)
+	case ev.kind&ObjectRemoved != 0:
+		c.recordObject(objectKey[P, T]{at: ev.old, object: ev.del}, false)
+	}
+}
+
+// recordValue accumulates the change of a value. The tiles which are revealed by the
+// fog of war are always part of the change set, even if their value did not change.
+func (c *changeSet[P, T]) recordValue(ev change[P, T]) {
+	if c.byValue == nil {
+		c.byValue = make(map[P]int, 64)
+	}
+
+	forced := ev.kind&FogRevealed != 0
+	if i, ok := c.byValue[ev.new]; ok {
+		c.values[i].new = ev.next
+		c.values[i].forced = c.values[i].forced || forced
+		return
+	}
+
+	c.byValue[ev.new] = len(c.values)
+	c.values = append(c.values, valueChange[P]{
+		at:     ev.new,
+		old:    ev.prev,
+		new:    ev.next,
+		forced: forced,
+	})
+}
+
+// recordObject accumulates an addition or a removal of an object. The objects are only
+// added or removed when the set of the tile changes, so the first change tells whether
+// the object was on the tile as of the last flush.
+func (c *changeSet[P, T]) recordObject(at objectKey[P, T], present bool) {
+	if c.byObj == nil {
+		c.byObj = make(map[objectKey[P, T]]int, 64)
+	}
+
+	i, ok := c.byObj[at]
+	if !ok {
+		i = len(c.objects)
+		c.byObj[at] = i
+		c.objects = append(c.objects, objectChange[P, T]{objectKey: at, before: !present})
+	}
+
+	c.objects[i].after = present
+}
+
+// flush calls the functions for each of the net changes of the values and the objects,
+// and resets the change set.
+func (c *changeSet[P, T]) flush(value func(P, Value), object func(at P, object T, added bool)) {
+	for _, change := range c.values {
+		if change.forced || change.old != change.new {
+			value(change.at, change.new)
+		}
+	}
+
+	for _, change := range c.objects {
+		if change.after != change.before {
+			object(change.at, change.object, change.after)
+		}
+	}
+
+	clear(c.objects)
+	c.values = c.values[:0]
+	c.objects = c.objects[:0]
+	clear(c.byValue)
+	clear(c.byObj)
+}
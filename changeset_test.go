@@ -0,0 +1,263 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+cpu: Intel(R) Xeon(R) Processor
+BenchmarkChangeSet/write         	 9154417	       132.5 ns/op	      64 B/op	       1 allocs/op
+BenchmarkChangeSet/flush         	  216832	      4990 ns/op	    2424 B/op	      36 allocs/op
+*/
+func BenchmarkChangeSet(b *testing.B) {
+	b.Run("write", func(b *testing.B) {
+		m := NewGrid(768, 768)
+		v := NewView(m, "view 1", WithDelivery(DeliverChangeSet))
+		v.Resize(NewRect(0, 0, 30, 30), nil)
+		defer v.Close()
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			m.WriteAt(int16(n%30), 10, Value(n))
+		}
+	})
+
+	b.Run("flush", func(b *testing.B) {
+		m := NewGrid(768, 768)
+		v := NewView(m, "view 1", WithDelivery(DeliverChangeSet))
+		v.Resize(NewRect(0, 0, 30, 30), nil)
+		defer v.Close()
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			for x := int16(0); x < 30; x++ {
+				m.WriteAt(x, 10, Value(n))
+			}
+			v.Flush()
+		}
+	})
+}
+
+func TestChangeSetValues(t *testing.T) {
+	m := NewGrid(9, 9)
+	v := NewView(m, "view 1", WithDelivery(DeliverChangeSet))
+	v.Resize(NewRect(0, 0, 9, 9), nil)
+	defer v.Close()
+
+	m.WriteAt(1, 1, 1)
+	m.WriteAt(2, 2, 1)
+	m.WriteAt(1, 1, 2)
+	m.WriteAt(3, 3, 1)
+	m.WriteAt(3, 3, 0) // A → B → A
+	m.WriteAt(4, 4, 0) // A → A
+	m.WriteAt(10, 10, 1)
+
+	// Only the final value of each of the changed tiles is kept
+	assert.Empty(t, v.Inbox)
+	assert.Equal(t, ChangeSet[string]{
+		Values: []ValueAt{{At(1, 1), 2}, {At(2, 2), 1}},
+	}, v.Flush())
+
+	// The next flush only contains the changes since the previous one
+	assert.True(t, v.Flush().IsEmpty())
+	m.WriteAt(1, 1, 3)
+	m.WriteAt(1, 1, 2)
+	m.WriteAt(2, 2, 5)
+	assert.Equal(t, ChangeSet[string]{
+		Values: []ValueAt{{At(2, 2), 5}},
+	}, v.Flush())
+}
+
+func TestChangeSetObjects(t *testing.T) {
+	m := NewGrid(9, 9)
+	v := NewView(m, "view 1", WithDelivery(DeliverChangeSet))
+	v.Resize(NewRect(0, 0, 9, 9), nil)
+	defer v.Close()
+
+	tile, _ := m.At(1, 1)
+	tile.Add("A")
+	tile.Add("B")
+	tile.Add("C")
+	tile.Del("B")
+	tile.Move("C", At(2, 2))
+	assert.Equal(t, ChangeSet[string]{
+		Added: []ObjectAt[string]{{At(1, 1), "A"}, {At(2, 2), "C"}},
+	}, v.Flush())
+
+	// Moving back and forth cancels out
+	tile.Move("A", At(3, 3))
+	dst, _ := m.At(3, 3)
+	dst.Move("A", At(1, 1))
+	tile.Del("A")
+	tile.Add("A")
+	assert.True(t, v.Flush().IsEmpty())
+
+	// The removals are kept as well
+	tile.Del("A")
+	tile.Del("A")
+	other, _ := m.At(2, 2)
+	other.Move("C", At(3, 3))
+	assert.Equal(t, ChangeSet[string]{
+		Added:   []ObjectAt[string]{{At(3, 3), "C"}},
+		Removed: []ObjectAt[string]{{At(1, 1), "A"}, {At(2, 2), "C"}},
+	}, v.Flush())
+}
+
+func TestChangeSetPresent(t *testing.T) {
+	m := NewGrid(9, 9)
+	v := NewView(m, "view 1", WithDelivery(DeliverChangeSet))
+	v.Resize(NewRect(0, 0, 9, 9), nil)
+	defer v.Close()
+
+	tile, _ := m.At(1, 1)
+	tile.Add("A")
+	v.Flush()
+
+	// Adding an object which is already there changes nothing, so it is still removed
+	tile.Add("A")
+	tile.Del("A")
+	assert.Equal(t, ChangeSet[string]{
+		Removed: []ObjectAt[string]{{At(1, 1), "A"}},
+	}, v.Flush())
+
+	// The same goes for a batch
+	tile.Add("A")
+	v.Flush()
+	assert.NoError(t, m.Batch(func(tx *Tx[string]) error {
+		tx.Add(1, 1, "A")
+		tx.Del(1, 1, "A")
+		tx.Del(1, 1, "A")
+		return nil
+	}))
+	assert.Equal(t, ChangeSet[string]{
+		Removed: []ObjectAt[string]{{At(1, 1), "A"}},
+	}, v.Flush())
+
+	// An object which is not on the tile can neither be moved nor removed from it
+	tile.Move("B", At(5, 5))
+	corner, _ := m.At(0, 0)
+	corner.Add("C")
+	tile.Del("C")
+	assert.Equal(t, ChangeSet[string]{
+		Added: []ObjectAt[string]{{At(5, 5), "B"}, {At(0, 0), "C"}},
+	}, v.Flush())
+	assert.NoError(t, m.Batch(func(tx *Tx[string]) error {
+		tx.Del(1, 1, "C")
+		return nil
+	}))
+	assert.True(t, v.Flush().IsEmpty())
+	assert.Equal(t, 1, corner.Count())
+}
+
+func TestChangeSetBatch(t *testing.T) {
+	m := NewGrid(9, 9)
+	v := NewView(m, "view 1", WithDelivery(DeliverChangeSet))
+	v.Resize(NewRect(0, 0, 9, 9), nil)
+	defer v.Close()
+
+	assert.NoError(t, m.Batch(func(tx *Tx[string]) error {
+		tx.WriteAt(1, 1, 1)
+		tx.WriteAt(1, 1, 2)
+		tx.Add(1, 1, "A")
+		return nil
+	}))
+
+	assert.Equal(t, ChangeSet[string]{
+		Values: []ValueAt{{At(1, 1), 2}},
+		Added:  []ObjectAt[string]{{At(1, 1), "A"}},
+	}, v.Flush())
+}
+
+func TestChangeSetFog(t *testing.T) {
+	m := NewGrid(9, 9)
+	fog := NewFog(m, 1)
+	v := NewView(m, "view 1", WithDelivery(DeliverChangeSet))
+	v.Resize(NewRect(0, 0, 9, 9), nil)
+	v.SetFog(fog, 0)
+	defer v.Close()
+
+	// The revealed tiles are part of the change set, even if their value is unchanged
+	fog.Update(0, func(Value) bool { return false }, Sight{Origin: At(1, 1), Radius: 1})
+	assert.NotEmpty(t, v.Flush().Values)
+}
+
+func TestChangeSetConcurrent(t *testing.T) {
+	const writers, writes = 4, 1000
+	m := NewGrid(9, 9)
+	v := NewView(m, "view 1", WithDelivery(DeliverChangeSet))
+	v.Resize(NewRect(0, 0, 9, 9), nil)
+	defer v.Close()
+
+	// Flush the changes while the tiles are being written
+	values := make(map[Point]Value)
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			for _, change := range v.Flush().Values {
+				values[change.Point] = change.Value
+			}
+
+			select {
+			case <-done:
+				return
+			default:
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for n := 1; n <= writes; n++ {
+				m.WriteAt(int16(i), 0, Value(n))
+			}
+		}(i)
+	}
+
+	// Applying every change set gives the final value of each tile
+	wg.Wait()
+	close(done)
+	<-stopped
+	for _, change := range v.Flush().Values {
+		values[change.Point] = change.Value
+	}
+
+	assert.Len(t, values, writers)
+	for at, value := range values {
+		assert.Equal(t, m.valueAt(at.X, at.Y), value)
+	}
+}
+
+func TestChangeSetWorld(t *testing.T) {
+	w := NewWorld(0)
+	v := NewWorldView(w, "view 1", WithDelivery(DeliverChangeSet))
+	defer v.Close()
+	v.Resize(NewWorldRect(-50, -50, 50, 50), nil)
+
+	w.WriteAt(-10, -10, 1)
+	w.WriteAt(-10, -10, 2)
+	w.WriteAt(10, 10, 1)
+	w.WriteAt(10, 10, 0) // A → B → A
+	w.At(20, -20).Add("A")
+	w.At(30, 30).Add("B")
+	w.At(30, 30).Del("B")
+
+	// Only the net changes are kept, with the coordinates of the world
+	assert.Empty(t, v.Inbox)
+	assert.Equal(t, WorldChangeSet[string]{
+		Values: []WorldValueAt{{WorldAt(-10, -10), 2}},
+		Added:  []WorldObjectAt[string]{{WorldAt(20, -20), "A"}},
+	}, v.Flush())
+	assert.True(t, v.Flush().IsEmpty())
+}
@@ -0,0 +1,311 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Delivery specifies how the updates are delivered to the inbox of a view, once the
+// inbox is full. Alternatively, DeliverChangeSet accumulates the updates instead of
+// sending them to the inbox.
+type Delivery uint8
+
+// Various delivery policies
+const (
+	DeliverBlock      Delivery = iota // The writers wait until the inbox has room
+	DeliverDropOldest                 // The oldest update of the inbox is dropped
+	DeliverDropNewest                 // The new update is dropped
+	DeliverCoalesce                   // The pending updates of a tile are merged together
+	DeliverChangeSet                  // The updates are accumulated until the next Flush()
+)
+
+// maxPendingObjects is the max number of pending updates of the objects of a view which
+// coalesces its updates, beyond which they are dropped.
+const maxPendingObjects = 4096
+
+// ViewOption represents an option of the view, which can be provided to NewView().
+type ViewOption func(*viewOptions)
+
+// viewOptions represents the configuration of a view
+type viewOptions struct {
+	delivery Delivery // The delivery policy of the updates
+	capacity int      // The capacity of the inbox
+}
+
+// newViewOptions returns the configuration of a view, given its options
+func newViewOptions(opts []ViewOption) viewOptions {
+	o := viewOptions{capacity: 32}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithDelivery specifies how the updates are delivered to the inbox of the view, once
+// it is full. By default, the writers are blocked until the inbox has room, so a slow
+// consumer slows down every writer of the tiles in its view. With DeliverCoalesce, the
+// view moves the updates into the inbox from its own goroutine, which keeps running
+// until the view is closed, so Close() must be called once the view is no longer used.
+func WithDelivery(policy Delivery) ViewOption {
+	return func(o *viewOptions) {
+		o.delivery = policy
+	}
+}
+
+// WithInbox specifies the capacity of the inbox of the view, which is 32 by default.
+func WithInbox(capacity int) ViewOption {
+	return func(o *viewOptions) {
+		o.capacity = capacity
+	}
+}
+
+// Dropped returns the number of updates which were dropped, since the inbox was full.
+func (v *View[S, T]) Dropped() uint64 {
+	return v.dropped.Load()
+}
+
+// Coalesced returns the number of updates which were merged into a pending update of
+// the same tile.
+func (v *View[S, T]) Coalesced() uint64 {
+	return v.coalesced.Load()
+}
+
+// outbox delivers the updates of a view to its inbox, according to the delivery policy.
+// The updates are either the updates of a grid, where the tiles are located by a Point,
+// or the updates of a world, where they are located by a WorldPoint.
+type outbox[U any, E event[U, P, T], P comparable, T comparable] struct {
+	inbox     chan U          // The inbox of the view
+	send      sync.Mutex      // Keeps the updates of a batch together
+	delivery  Delivery        // The delivery policy of the updates
+	dropped   atomic.Uint64   // The number of dropped updates
+	coalesced atomic.Uint64   // The number of coalesced updates
+	pending   coalescer[U]    // The updates waiting to be coalesced
+	closed    sync.Once       // Stops the delivery once closed
+	changes   changeSet[P, T] // The changes accumulated since the last flush
+}
+
+// event represents an update which can be delivered to the inbox of a view
+type event[U any, P comparable, T comparable] interface {
+	*U
+	tile() (uint64, UpdateKind) // The tile after the update, and the kind of the update
+	change() change[P, T]       // The change of the tile
+	merge(prev *U)              // Merges a previous update of the same tile into the update
+}
+
+// change represents the change of a tile, located by a point of type P
+type change[P comparable, T comparable] struct {
+	old, new   P          // The tile before and after the update
+	prev, next Value      // The value before and after the update
+	add, del   T          // The objects which were added and removed
+	kind       UpdateKind // The kind of the update
+}
+
+// coalescer represents the updates which are waiting to be moved into the inbox
+type coalescer[U any] struct {
+	sync.Mutex
+	queue   []queued[U]    // The updates, in order
+	index   map[uint64]int // The position of the update of each tile in the queue
+	stale   int            // The number of superseded updates in the queue
+	objects int            // The number of updates of the objects in the queue
+	wake    chan struct{}  // Wakes up the pump
+	done    chan struct{}  // Stops the pump
+}
+
+// queued represents an update waiting in the queue of the coalescer
+type queued[U any] struct {
+	update     U      // The update
+	at         uint64 // The tile of the update
+	mergeable  bool   // Whether the update can be merged with a later one
+	superseded bool   // Whether the update was merged into a later one
+}
+
+// open creates the inbox and configures the delivery of the updates. The coalesced
+// updates are moved into the inbox in the background, until the outbox is closed.
+func (o *outbox[U, E, P, T]) open(opts viewOptions) chan U {
+	o.inbox = make(chan U, opts.capacity)
+	o.delivery = opts.delivery
+	if o.delivery == DeliverCoalesce {
+		o.pending.index = make(map[uint64]int, opts.capacity)
+		o.pending.wake = make(chan struct{}, 1)
+		o.pending.done = make(chan struct{})
+		go o.pump()
+	}
+	return o.inbox
+}
+
+// close stops moving the coalesced updates into the inbox
+func (o *outbox[U, E, P, T]) close() {
+	o.closed.Do(func() {
+		if o.pending.done != nil {
+			close(o.pending.done)
+		}
+	})
+}
+
+// deliver delivers an update to the inbox, according to the delivery policy. The send
+// lock must be held.
+func (o *outbox[U, E, P, T]) deliver(ev *U) {
+	switch o.delivery {
+	case DeliverDropNewest:
+		select {
+		case o.inbox <- *ev:
+		default:
+			o.dropped.Add(1)
+		}
+
+	case DeliverDropOldest:
+		for {
+			select {
+			case o.inbox <- *ev:
+				return
+			default:
+			}
+
+			// Make room by dropping the oldest update, unless it was just consumed
+			select {
+			case <-o.inbox:
+				o.dropped.Add(1)
+			default:
+			}
+		}
+
+	case DeliverCoalesce:
+		o.coalesce(ev)
+
+	case DeliverChangeSet:
+		o.changes.record(E(ev).change())
+
+	default:
+		o.inbox <- *ev // (copy)
+	}
+}
+
+// deliverBatch delivers the updates of a batch to the inbox, according to the delivery
+// policy. The policies which drop the updates keep the batch together, so they either
+// make room for all of it or drop all of it, if it doesn't fit in the inbox. The send
+// lock must be held.
+func (o *outbox[U, E, P, T]) deliverBatch(updates []U) {
+	switch {
+	case len(updates) == 0:
+		return
+	case o.delivery == DeliverDropNewest && len(updates) > cap(o.inbox)-len(o.inbox),
+		o.delivery == DeliverDropOldest && len(updates) > cap(o.inbox):
+		o.dropped.Add(uint64(len(updates)))
+		return
+	case o.delivery == DeliverDropOldest:
+		for len(updates) > cap(o.inbox)-len(o.inbox) {
+			select {
+			case <-o.inbox:
+				o.dropped.Add(1)
+			default:
+			}
+		}
+	}
+
+	// The room made for the batch can only grow, since the send lock is held
+	for i := range updates {
+		o.deliver(&updates[i])
+	}
+}
+
+// coalesce queues an update for the pump, merging it with the pending update of the
+// same tile if there is one. The merged update is moved to the end of the queue, so
+// that the updates are still delivered in the order of their sequence numbers. Only
+// the updates of a value can be merged, while the updates of the objects are queued up
+// to a limit, after which they are dropped.
+func (o *outbox[U, E, P, T]) coalesce(ev *U) {
+	o.pending.Lock()
+	defer o.pending.Unlock()
+
+	at, kind := E(ev).tile()
+	mergeable := isValueChange(kind)
+	switch i, ok := o.pending.index[at]; {
+	case ok && mergeable:
+		o.pending.queue[i].superseded = true
+		o.pending.stale++
+		o.pending.index[at] = len(o.pending.queue)
+		o.pending.queue = append(o.pending.queue, queued[U]{update: *ev, at: at, mergeable: true})
+		E(&o.pending.queue[len(o.pending.queue)-1].update).merge(&o.pending.queue[i].update)
+		o.coalesced.Add(1)
+		o.pending.compact()
+		return
+	case mergeable:
+		o.pending.index[at] = len(o.pending.queue)
+	case o.pending.objects >= maxPendingObjects:
+		o.dropped.Add(1)
+		return
+	default:
+		o.pending.objects++
+	}
+
+	o.pending.queue = append(o.pending.queue, queued[U]{update: *ev, at: at, mergeable: mergeable})
+	select {
+	case o.pending.wake <- struct{}{}:
+	default:
+	}
+}
+
+// isValueChange returns whether an update only changes the value of a tile, in which
+// case it can be merged with the other changes of the value of the same tile.
+func isValueChange(kind UpdateKind) bool {
+	return kind&^(BatchApplied|FogRevealed) == ValueChanged
+}
+
+// compact removes the superseded updates from the queue, once they make up for more
+// than half of it.
+func (c *coalescer[U]) compact() {
+	if c.stale <= len(c.queue)/2 {
+		return
+	}
+
+	queue := c.queue[:0]
+	for _, ev := range c.queue {
+		if ev.superseded {
+			continue
+		}
+
+		if ev.mergeable {
+			c.index[ev.at] = len(queue)
+		}
+		queue = append(queue, ev)
+	}
+
+	clear(c.queue[len(queue):])
+	c.queue = queue
+	c.stale = 0
+}
+
+// pump moves the pending updates into the inbox, until the view is closed
+func (o *outbox[U, E, P, T]) pump() {
+	var queue []queued[U]
+	for {
+		select {
+		case <-o.pending.wake:
+		case <-o.pending.done:
+			return
+		}
+
+		// Take the pending updates, so that the new ones are queued in the meantime
+		o.pending.Lock()
+		queue, o.pending.queue = o.pending.queue, queue[:0]
+		o.pending.stale, o.pending.objects = 0, 0
+		clear(o.pending.index)
+		o.pending.Unlock()
+
+		for _, ev := range queue {
+			if ev.superseded {
+				continue
+			}
+
+			select {
+			case o.inbox <- ev.update:
+			case <-o.pending.done:
+				return
+			}
+		}
+		clear(queue)
+	}
+}
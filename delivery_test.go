@@ -0,0 +1,245 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+cpu: Intel(R) Xeon(R) Processor
+BenchmarkDelivery/block         	 3692725	       296.6 ns/op	      64 B/op	       1 allocs/op
+BenchmarkDelivery/drop-oldest   	 3741123	       294.9 ns/op	      64 B/op	       1 allocs/op
+BenchmarkDelivery/drop-newest   	 7154986	       196.5 ns/op	      64 B/op	       1 allocs/op
+BenchmarkDelivery/coalesce      	 3630789	       314.2 ns/op	      64 B/op	       1 allocs/op
+*/
+func BenchmarkDelivery(b *testing.B) {
+	for _, tc := range []struct {
+		name   string
+		policy Delivery
+	}{
+		{"block", DeliverBlock},
+		{"drop-oldest", DeliverDropOldest},
+		{"drop-newest", DeliverDropNewest},
+		{"coalesce", DeliverCoalesce},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			m := NewGrid(768, 768)
+			v := NewView(m, "view 1", WithDelivery(tc.policy))
+			v.Resize(NewRect(0, 0, 30, 30), nil)
+			defer v.Close()
+
+			go func() {
+				for range v.Inbox {
+				}
+			}()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				m.WriteAt(int16(n%30), 10, Value(n))
+			}
+		})
+	}
+}
+
+func TestDeliverDropNewest(t *testing.T) {
+	m := NewGrid(9, 9)
+	v := NewView(m, "view 1", WithDelivery(DeliverDropNewest), WithInbox(2))
+	v.Resize(NewRect(0, 0, 9, 9), nil)
+	defer v.Close()
+
+	for i := int16(0); i < 5; i++ {
+		m.WriteAt(i, 0, Value(i+1))
+	}
+
+	assert.Equal(t, uint64(3), v.Dropped())
+	assert.Equal(t, Value(1), (<-v.Inbox).New.Value)
+	assert.Equal(t, Value(2), (<-v.Inbox).New.Value)
+}
+
+func TestDeliverDropOldest(t *testing.T) {
+	m := NewGrid(9, 9)
+	v := NewView(m, "view 1", WithDelivery(DeliverDropOldest), WithInbox(2))
+	v.Resize(NewRect(0, 0, 9, 9), nil)
+	defer v.Close()
+
+	for i := int16(0); i < 5; i++ {
+		m.WriteAt(i, 0, Value(i+1))
+	}
+
+	assert.Equal(t, uint64(3), v.Dropped())
+	assert.Equal(t, Value(4), (<-v.Inbox).New.Value)
+	assert.Equal(t, Value(5), (<-v.Inbox).New.Value)
+}
+
+func TestDeliverBatch(t *testing.T) {
+	m := NewGrid(9, 9)
+	batch := func(values ...Value) {
+		m.Batch(func(tx *Tx[string]) error {
+			for i, value := range values {
+				tx.WriteAt(int16(i), 1, value)
+			}
+			return nil
+		})
+	}
+
+	// A batch which doesn't fit in the remaining room is dropped as a whole
+	newest := NewView(m, "view 1", WithDelivery(DeliverDropNewest), WithInbox(4))
+	newest.Resize(NewRect(0, 0, 9, 9), nil)
+	defer newest.Close()
+
+	m.WriteAt(0, 0, 1)
+	m.WriteAt(1, 0, 2)
+	batch(3, 4, 5)
+	assert.Equal(t, uint64(3), newest.Dropped())
+	assert.Len(t, newest.Inbox, 2)
+
+	// The oldest updates make room for the entire batch, unless it can never fit
+	oldest := NewView(m, "view 2", WithDelivery(DeliverDropOldest), WithInbox(4))
+	oldest.Resize(NewRect(0, 0, 9, 9), nil)
+	defer oldest.Close()
+
+	m.WriteAt(0, 0, 6)
+	m.WriteAt(1, 0, 7)
+	m.WriteAt(2, 0, 8)
+	batch(9, 10, 11)
+	assert.Equal(t, uint64(2), oldest.Dropped())
+	batch(12, 13, 14, 15, 16)
+	assert.Equal(t, uint64(7), oldest.Dropped())
+
+	var values []Value
+	for len(oldest.Inbox) > 0 {
+		values = append(values, (<-oldest.Inbox).New.Value)
+	}
+	assert.Equal(t, []Value{8, 9, 10, 11}, values)
+}
+
+func TestDeliverCoalesce(t *testing.T) {
+	m := NewGrid(9, 9)
+	v := NewView(m, "view 1", WithDelivery(DeliverCoalesce), WithInbox(1))
+	v.Resize(NewRect(0, 0, 9, 9), nil)
+	defer v.Close()
+
+	// The writers are never blocked, even if nobody reads the inbox
+	tile, _ := m.At(1, 1)
+	tile.Add("A")
+	for i := Value(1); i <= 100; i++ {
+		m.WriteAt(1, 1, i)
+	}
+	tile.Del("A")
+
+	// Every update is either received or merged into another one
+	assert.Equal(t, "A", receive(t, v.Inbox).Add)
+	received, last := 0, Value(0)
+	for last != 100 {
+		ev := receive(t, v.Inbox)
+		assert.Equal(t, last, ev.Old.Value)
+		last = ev.New.Value
+		received++
+	}
+
+	assert.Equal(t, 100, received+int(v.Coalesced()))
+	assert.Equal(t, "A", receive(t, v.Inbox).Del)
+	assert.Zero(t, v.Dropped())
+}
+
+func TestDeliverCoalesceOrder(t *testing.T) {
+	m := NewGrid(9, 9)
+	v := NewView(m, "view 1", WithDelivery(DeliverCoalesce), WithInbox(1))
+	v.Resize(NewRect(0, 0, 9, 9), nil)
+	defer v.Close()
+
+	// Block the pump, so that the next updates are pending
+	m.WriteAt(0, 0, 1)
+	m.WriteAt(0, 0, 2)
+	for len(v.Inbox) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The merged update of a tile is not delivered before the later updates
+	m.WriteAt(1, 1, 1)
+	tile, _ := m.At(2, 2)
+	tile.Add("A")
+	m.WriteAt(1, 1, 2)
+
+	var seq uint64
+	var kinds []UpdateKind
+	for len(kinds) < 2 {
+		ev := receive(t, v.Inbox)
+		assert.Greater(t, ev.Seq, seq)
+		seq = ev.Seq
+		if ev.New.Point != At(0, 0) {
+			kinds = append(kinds, ev.Kind)
+		}
+	}
+
+	assert.Equal(t, []UpdateKind{ObjectAdded, ValueChanged}, kinds)
+}
+
+func TestDeliverCoalesceLimit(t *testing.T) {
+	m := NewGrid(9, 9)
+	v := NewView(m, "view 1", WithDelivery(DeliverCoalesce), WithInbox(1))
+	v.Resize(NewRect(0, 0, 9, 9), nil)
+	defer v.Close()
+
+	// The pending updates of the objects are bounded, even if nobody reads the inbox
+	tile, _ := m.At(1, 1)
+	for i := 0; i < 3*maxPendingObjects; i++ {
+		tile.Add(strconv.Itoa(i))
+	}
+
+	assert.NotZero(t, v.Dropped())
+	v.pending.Lock()
+	assert.LessOrEqual(t, len(v.pending.queue), maxPendingObjects)
+	v.pending.Unlock()
+}
+
+func TestDeliverResize(t *testing.T) {
+	m := NewGrid(9, 9)
+	v := NewView(m, "view 1", WithInbox(1))
+	v.Resize(NewRect(0, 0, 3, 3), nil)
+	defer v.Close()
+
+	// The writer is blocked, since nobody reads the inbox
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := Value(1); i <= 3; i++ {
+			m.WriteAt(1, 1, i)
+		}
+	}()
+
+	// Which does not prevent the view from moving away
+	for len(v.Inbox) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	v.Resize(NewRect(6, 6, 9, 9), nil)
+	for {
+		select {
+		case <-v.Inbox:
+		case <-done:
+			return
+		case <-time.After(5 * time.Second):
+			assert.Fail(t, "writer is still blocked")
+			return
+		}
+	}
+}
+
+// receive receives an update from the inbox, or fails after a timeout
+func receive(t *testing.T, inbox chan Update[string]) Update[string] {
+	select {
+	case ev := <-inbox:
+		return ev
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "no update received")
+		return Update[string]{}
+	}
+}
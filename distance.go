@@ -0,0 +1,172 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"math"
+)
+
+// DistanceMap represents a map of the costs of reaching the closest of several sources
+// from each of the tiles, also known as a "Dijkstra map". Walking downhill leads to the
+// closest source, while walking uphill leads away from all of them, which is useful for
+// the units which need to flee.
+//
+// The distance map is not thread-safe, the updates must not run concurrently with the
+// reads of the map.
+type DistanceMap[T comparable] struct {
+	integration[T]
+	sources []Point // The sources of the map
+}
+
+// NewDistanceMap creates a new distance map from a set of sources, given a cost function.
+// The cost of moving to a tile is the same as in Path(), and blocked tiles as well as the
+// tiles which can not reach any of the sources are unreachable.
+func NewDistanceMap[T comparable](m *Grid[T], costOf costFn, sources ...Point) *DistanceMap[T] {
+	d := &DistanceMap[T]{
+		integration: newIntegration(m, costOf),
+		sources:     sources,
+	}
+
+	d.origins = make([]uint32, len(d.costs))
+	d.Update(Rect{Max: m.Size})
+	return d
+}
+
+// CostAt returns the cost of reaching the closest source from a tile. It returns false
+// if no source can be reached from the tile.
+func (d *DistanceMap[T]) CostAt(x, y int16) (uint32, bool) {
+	if !At(x, y).WithinSize(d.size) {
+		return 0, false
+	}
+
+	cost := d.costs[d.indexOf(x, y)]
+	return cost, cost != math.MaxUint32
+}
+
+// SourceAt returns the closest source from a tile. It returns false if no source can be
+// reached from the tile.
+func (d *DistanceMap[T]) SourceAt(x, y int16) (Point, bool) {
+	if _, ok := d.CostAt(x, y); !ok {
+		return Point{}, false
+	}
+
+	return d.sources[d.origins[d.indexOf(x, y)]], true
+}
+
+// Downhill returns the next step towards the closest source, which is the neighbor with
+// the lowest cost. It returns false if the tile is a source or is unreachable.
+func (d *DistanceMap[T]) Downhill(from Point) (Point, bool) {
+	if _, ok := d.CostAt(from.X, from.Y); !ok {
+		return from, false
+	}
+
+	dir := d.slope(from, func(next, best int) bool {
+		return d.costs[next] < d.costs[best]
+	})
+	return from.Move(dir), dir != noDirection
+}
+
+// Uphill returns the next step away from the sources, which is the reachable neighbor
+// with the highest cost. It returns false if there is no such neighbor, for example if
+// the tile is cornered, or if the tile itself is unreachable.
+func (d *DistanceMap[T]) Uphill(from Point) (Point, bool) {
+	if _, ok := d.CostAt(from.X, from.Y); !ok {
+		return from, false
+	}
+
+	dir := d.slope(from, func(next, best int) bool {
+		return d.costs[next] != math.MaxUint32 && d.costs[next] > d.costs[best]
+	})
+	return from.Move(dir), dir != noDirection
+}
+
+// Update recomputes the distance map after the tiles within a rectangle have changed.
+// Only the tiles whose path to a source went through the rectangle are recomputed, along
+// with the tiles which can now reach a source with a lower cost.
+func (d *DistanceMap[T]) Update(r Rect) {
+	d.integrate(r, d.sources)
+}
+
+// ---------------------------------- Combined ----------------------------------
+
+// Weighted represents a distance map with its weight, when combining several of them.
+// A negative weight turns the sources of the map into something to avoid.
+type Weighted[T comparable] struct {
+	Map    *DistanceMap[T] // The distance map
+	Weight float32         // The weight of the map
+}
+
+// CombinedMap represents a weighted sum of several distance maps of the same grid. For
+// example, a unit could weigh the distance to the treasure against the distance to the
+// monsters and walk downhill on the combination.
+type CombinedMap[T comparable] struct {
+	*integration[T]
+	values []float32 // The combined values, infinite when unreachable
+}
+
+// Combine combines several distance maps of the same grid by summing their weighted
+// costs. A tile is unreachable if it is unreachable in any of the maps. The combined map
+// is a snapshot and does not follow the updates of the distance maps.
+func Combine[T comparable](maps ...Weighted[T]) *CombinedMap[T] {
+	if len(maps) == 0 {
+		return nil
+	}
+
+	values := make([]float32, len(maps[0].Map.costs))
+	for _, m := range maps {
+		for i, cost := range m.Map.costs {
+			switch {
+			case cost == math.MaxUint32:
+				values[i] = float32(math.Inf(1))
+			default:
+				values[i] += float32(cost) * m.Weight
+			}
+		}
+	}
+
+	return &CombinedMap[T]{
+		integration: &maps[0].Map.integration,
+		values:      values,
+	}
+}
+
+// ValueAt returns the combined value of a tile. It returns false if the tile is
+// unreachable.
+func (c *CombinedMap[T]) ValueAt(x, y int16) (float32, bool) {
+	if !At(x, y).WithinSize(c.size) {
+		return 0, false
+	}
+
+	value := c.values[c.indexOf(x, y)]
+	return value, !math.IsInf(float64(value), 1)
+}
+
+// Downhill returns the next step towards the neighbor with the lowest combined value.
+// It returns false if there is no such neighbor, when the tile is a local minimum or
+// is unreachable.
+func (c *CombinedMap[T]) Downhill(from Point) (Point, bool) {
+	if _, ok := c.ValueAt(from.X, from.Y); !ok {
+		return from, false
+	}
+
+	dir := c.slope(from, func(next, best int) bool {
+		return c.values[next] < c.values[best]
+	})
+	return from.Move(dir), dir != noDirection
+}
+
+// Uphill returns the next step towards the reachable neighbor with the highest combined
+// value. It returns false if there is no such neighbor, when the tile is a local maximum
+// or is unreachable.
+func (c *CombinedMap[T]) Uphill(from Point) (Point, bool) {
+	if _, ok := c.ValueAt(from.X, from.Y); !ok {
+		return from, false
+	}
+
+	inf := float32(math.Inf(1))
+	dir := c.slope(from, func(next, best int) bool {
+		return c.values[next] != inf && c.values[next] > c.values[best]
+	})
+	return from.Move(dir), dir != noDirection
+}
@@ -0,0 +1,181 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+cpu: Intel(R) Xeon(R) Processor
+BenchmarkDistanceMap/build         	     118	   9731251 ns/op	 4220208 B/op	     107 allocs/op
+BenchmarkDistanceMap/combine       	    3615	    333505 ns/op	  360480 B/op	       2 allocs/op
+BenchmarkDistanceMap/downhill      	13075826	        79.04 ns/op	       0 B/op	       0 allocs/op
+*/
+func BenchmarkDistanceMap(b *testing.B) {
+	m := mapFrom("300x300.png")
+	sources := []Point{At(160, 270), At(20, 20), At(250, 100)}
+
+	b.Run("build", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			NewDistanceMap(m, costOf, sources...)
+		}
+	})
+
+	b.Run("combine", func(b *testing.B) {
+		goals := NewDistanceMap(m, costOf, sources...)
+		enemies := NewDistanceMap(m, costOf, At(115, 20))
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			Combine(Weighted[string]{goals, 1}, Weighted[string]{enemies, -0.5})
+		}
+	})
+
+	b.Run("downhill", func(b *testing.B) {
+		d := NewDistanceMap(m, costOf, sources...)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			d.Downhill(At(115, 20))
+		}
+	})
+}
+
+func TestDistanceMap(t *testing.T) {
+	m := mapFrom("300x300.png")
+	sources := []Point{At(160, 270), At(20, 20), At(250, 100)}
+	d := NewDistanceMap(m, costOf, sources...)
+
+	for i := 0; i < 20; i++ {
+		from := At(int16(rand(i*7)), int16(rand(i*13+1)))
+		cost, ok := d.CostAt(from.X, from.Y)
+		if !ok {
+			continue
+		}
+
+		// The cost is the one of the shortest path to the closest source
+		source, ok := d.SourceAt(from.X, from.Y)
+		assert.True(t, ok)
+		_, expect, _ := m.Path(from, source, costOf)
+		assert.Equal(t, uint32(expect), cost, "%v -> %v", from, source)
+		for _, other := range sources {
+			if _, dist, found := m.Path(from, other, costOf); found {
+				assert.GreaterOrEqual(t, uint32(dist), cost)
+			}
+		}
+
+		// Walking downhill leads to the closest source
+		at := from
+		for next, ok := d.Downhill(at); ok; next, ok = d.Downhill(at) {
+			prev, _ := d.CostAt(at.X, at.Y)
+			cost, _ := d.CostAt(next.X, next.Y)
+			assert.Less(t, cost, prev)
+			at = next
+		}
+		assert.Equal(t, source, at)
+	}
+}
+
+func TestDistanceMapUphill(t *testing.T) {
+	m := NewGrid(9, 9)
+	d := NewDistanceMap(m, costOf, At(4, 4))
+
+	// Fleeing away from the source, until cornered
+	at := At(5, 5)
+	for next, ok := d.Uphill(at); ok; next, ok = d.Uphill(at) {
+		prev, _ := d.CostAt(at.X, at.Y)
+		cost, _ := d.CostAt(next.X, next.Y)
+		assert.Greater(t, cost, prev)
+		at = next
+	}
+	assert.Equal(t, At(8, 8), at)
+
+	// Source itself has no downhill
+	_, ok := d.Downhill(At(4, 4))
+	assert.False(t, ok)
+}
+
+func TestDistanceMapMiss(t *testing.T) {
+	m := mapFrom("9x9.png")
+	d := NewDistanceMap(m, costOf, At(7, 7), At(0, 0))
+
+	// Blocked tile
+	_, ok := d.CostAt(0, 0)
+	assert.False(t, ok)
+	_, ok = d.SourceAt(0, 0)
+	assert.False(t, ok)
+	_, ok = d.Downhill(At(0, 0))
+	assert.False(t, ok)
+	_, ok = d.Uphill(At(0, 0))
+	assert.False(t, ok)
+
+	// Outside of the grid
+	_, ok = d.CostAt(20, 20)
+	assert.False(t, ok)
+	_, ok = d.Downhill(At(-1, 5))
+	assert.False(t, ok)
+
+	// Blocked source is ignored
+	source, ok := d.SourceAt(1, 1)
+	assert.True(t, ok)
+	assert.Equal(t, At(7, 7), source)
+}
+
+func TestDistanceMapUpdate(t *testing.T) {
+	m := mapFrom("300x300.png")
+	sources := []Point{At(160, 270), At(20, 20), At(250, 100)}
+	d := NewDistanceMap(m, costOf, sources...)
+
+	for i := 0; i < 20; i++ {
+		x, y := int16(rand(i*11)), int16(rand(i*3+2))
+		r := NewRect(x, y, x+int16(i%4)+1, y+int16(i%3)+1)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				m.WriteAt(x, y, Value(i%2))
+			}
+		}
+
+		// Incremental update should match a full rebuild
+		d.Update(r)
+		expect := NewDistanceMap(m, costOf, sources...)
+		assert.Equal(t, expect.costs, d.costs, "costs differ after %v", r)
+	}
+}
+
+func TestCombine(t *testing.T) {
+	m := NewGrid(30, 3)
+	treasure := NewDistanceMap(m, costOf, At(29, 1))
+	monster := NewDistanceMap(m, costOf, At(10, 1))
+
+	// The monster is far enough, walk towards the treasure
+	c := Combine(Weighted[string]{treasure, 1}, Weighted[string]{monster, -0.5})
+	next, ok := c.Downhill(At(15, 1))
+	assert.True(t, ok)
+	assert.Equal(t, int16(16), next.X)
+
+	// The monster matters more than the treasure, flee from it
+	c = Combine(Weighted[string]{treasure, -1}, Weighted[string]{monster, 2})
+	next, ok = c.Uphill(At(15, 1))
+	assert.True(t, ok)
+	assert.Equal(t, int16(16), next.X)
+
+	value, ok := c.ValueAt(15, 1)
+	assert.True(t, ok)
+	assert.Equal(t, float32(-14+10), value)
+
+	// Unreachable in any of the maps
+	m.WriteAt(0, 0, Value(0xff))
+	treasure.Update(NewRect(0, 0, 1, 1))
+	c = Combine(Weighted[string]{treasure, 1}, Weighted[string]{monster, 1})
+	_, ok = c.ValueAt(0, 0)
+	assert.False(t, ok)
+	_, ok = c.ValueAt(0, 1)
+	assert.True(t, ok)
+	assert.Nil(t, Combine[string]())
+}
@@ -0,0 +1,48 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+// Filter represents a filter of the updates received by a view. The updates which do
+// not match the filter are dropped before they are queued into the inbox. The zero
+// value of each of the fields matches every update.
+type Filter[T comparable] struct {
+	Mask   Value        // The bits of the value whose changes matter
+	Kinds  UpdateKind   // The kinds of updates which matter
+	Object func(T) bool // The objects whose updates matter
+}
+
+// SetFilter filters the updates received by the view from now on. For example, a view
+// which only renders the sprites can ignore the changes of the other bits of the tiles.
+// The zero value of the filter lets every update through.
+func (v *View[S, T]) SetFilter(filter Filter[T]) {
+	v.filter.Store(&filter)
+}
+
+// SetFilter filters the updates received by the view from now on, as for the views
+// of a grid. The zero value of the filter lets every update through.
+func (v *WorldView[S, T]) SetFilter(filter Filter[T]) {
+	v.filter.Store(&filter)
+}
+
+// allows returns whether an update matches the filter. The value updates match if
+// any of the bits of the mask has changed, or if the tile was revealed by the fog of
+// war, since its value is then new to the view. The object updates match if the
+// predicate accepts the object which was added, removed or moved.
+func (f *Filter[T]) allows(ev *Update[T]) bool {
+	if f.Kinds != 0 && ev.Kind&f.Kinds == 0 {
+		return false
+	}
+
+	switch {
+	case ev.Kind&ValueChanged != 0:
+		changed := ev.Old.Value ^ ev.New.Value
+		return f.Mask == 0 || changed&f.Mask != 0 || ev.Kind&FogRevealed != 0
+	case f.Object == nil:
+		return true
+	case ev.Kind&ObjectRemoved != 0:
+		return f.Object(ev.Del)
+	default:
+		return f.Object(ev.Add)
+	}
+}
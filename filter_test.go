@@ -0,0 +1,180 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+cpu: Intel(R) Xeon(R) Processor
+BenchmarkFilter/match         	 6269250	       189.8 ns/op	      64 B/op	       1 allocs/op
+BenchmarkFilter/drop          	10945352	       119.7 ns/op	      64 B/op	       1 allocs/op
+*/
+func BenchmarkFilter(b *testing.B) {
+	m := NewGrid(768, 768)
+	v := NewView(m, "view 1")
+	v.SetFilter(Filter[string]{Mask: 0xFF})
+	v.Resize(NewRect(0, 0, 30, 30), nil)
+	defer v.Close()
+
+	go func() {
+		for range v.Inbox {
+		}
+	}()
+
+	b.Run("match", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			m.MaskAt(10, 10, Value(n), 0xFF)
+		}
+	})
+
+	b.Run("drop", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			m.MaskAt(10, 10, Value(n)<<8, 0xFF00)
+		}
+	})
+}
+
+func TestFilterMask(t *testing.T) {
+	m := NewGrid(9, 9)
+	v := NewView(m, "view 1")
+	v.SetFilter(Filter[string]{Mask: 0xFF})
+	v.Resize(NewRect(0, 0, 9, 9), nil)
+	defer v.Close()
+
+	// Only the changes of the sprite bits are received
+	m.MaskAt(1, 1, 0x100, 0xFF00)
+	m.MaskAt(1, 1, 0x001, 0x00FF)
+	m.WriteAt(1, 1, 0x201)
+	m.WriteAt(1, 1, 0x202)
+	assert.Len(t, v.Inbox, 2)
+	assert.Equal(t, Value(0x101), (<-v.Inbox).New.Value)
+	assert.Equal(t, Value(0x202), (<-v.Inbox).New.Value)
+
+	// The objects are not affected by the mask
+	tile, _ := m.At(1, 1)
+	tile.Add("A")
+	assert.Equal(t, "A", (<-v.Inbox).Add)
+
+	// Writing the same value changes none of the bits
+	m.WriteAt(1, 1, 0x202)
+	assert.Len(t, v.Inbox, 0)
+
+	// The zero filter lets every update through
+	v.SetFilter(Filter[string]{})
+	m.MaskAt(1, 1, 0x300, 0xFF00)
+	assert.Equal(t, Value(0x302), (<-v.Inbox).New.Value)
+}
+
+func TestFilterKinds(t *testing.T) {
+	m := NewGrid(9, 9)
+	v := NewView(m, "view 1")
+	v.SetFilter(Filter[string]{Kinds: ObjectAdded | ObjectRemoved})
+	v.Resize(NewRect(0, 0, 9, 9), nil)
+	defer v.Close()
+
+	tile, _ := m.At(1, 1)
+	tile.Add("A")
+	tile.Move("A", At(2, 2))
+	m.WriteAt(2, 2, 1)
+	tile, _ = m.At(2, 2)
+	tile.Del("A")
+
+	assert.Len(t, v.Inbox, 2)
+	assert.Equal(t, ObjectAdded, (<-v.Inbox).Kind)
+	assert.Equal(t, ObjectRemoved, (<-v.Inbox).Kind)
+
+	// The updates of a batch can be selected as well
+	batched := NewView(m, "view 2")
+	batched.SetFilter(Filter[string]{Kinds: BatchApplied})
+	batched.Resize(NewRect(0, 0, 9, 9), nil)
+	defer batched.Close()
+
+	m.WriteAt(3, 3, 1)
+	assert.NoError(t, m.Batch(func(tx *Tx[string]) error {
+		tx.WriteAt(3, 3, 2)
+		tx.Add(3, 3, "B")
+		return nil
+	}))
+
+	assert.Len(t, batched.Inbox, 2)
+	assert.Equal(t, ValueChanged|BatchApplied, (<-batched.Inbox).Kind)
+	assert.Equal(t, ObjectAdded|BatchApplied, (<-batched.Inbox).Kind)
+}
+
+func TestFilterObject(t *testing.T) {
+	m := NewGrid(9, 9)
+	v := NewView(m, "view 1")
+	v.SetFilter(Filter[string]{
+		Object: func(object string) bool {
+			return strings.HasPrefix(object, "unit")
+		},
+	})
+	v.Resize(NewRect(0, 0, 9, 9), nil)
+	defer v.Close()
+
+	tile, _ := m.At(1, 1)
+	tile.Add("item 1")
+	tile.Add("unit 1")
+	tile.Move("item 1", At(2, 2))
+	tile.Move("unit 1", At(2, 2))
+	tile, _ = m.At(2, 2)
+	tile.Del("item 1")
+	tile.Del("unit 1")
+	m.WriteAt(2, 2, 1)
+
+	// The values are not affected by the predicate
+	assert.Len(t, v.Inbox, 4)
+	assert.Equal(t, ObjectAdded, (<-v.Inbox).Kind)
+	assert.Equal(t, ObjectMoved, (<-v.Inbox).Kind)
+	assert.Equal(t, ObjectRemoved, (<-v.Inbox).Kind)
+	assert.Equal(t, ValueChanged, (<-v.Inbox).Kind)
+}
+
+func TestFilterFog(t *testing.T) {
+	m := NewGrid(9, 9)
+	fog := NewFog(m, 1)
+	v := NewView(m, "view 1")
+	v.SetFilter(Filter[string]{Mask: 0xFF})
+	v.Resize(NewRect(0, 0, 9, 9), nil)
+	v.SetFog(fog, 0)
+	defer v.Close()
+
+	// The tiles revealed by the fog are received, even though their value is unchanged
+	m.WriteAt(1, 1, 0x100)
+	fog.Update(0, func(Value) bool { return false }, Sight{Origin: At(1, 1), Radius: 1})
+	assert.NotZero(t, len(v.Inbox))
+	for len(v.Inbox) > 0 {
+		ev := <-v.Inbox
+		assert.Equal(t, ev.Old.Value, ev.New.Value)
+		assert.Equal(t, ValueChanged|FogRevealed, ev.Kind)
+	}
+}
+
+func TestFilterWorld(t *testing.T) {
+	w := NewWorld(0)
+	v := NewWorldView(w, "view 1")
+	defer v.Close()
+	v.Resize(NewWorldRect(-50, -50, 50, 50), nil)
+	v.SetFilter(Filter[string]{Mask: 0x00FF})
+
+	// Only the changes of the bits of the mask are received
+	w.WriteAt(-10, -10, 0x100)
+	w.WriteAt(10, 10, 0x001)
+	assert.Equal(t, WorldAt(10, 10), (<-v.Inbox).New.WorldPoint)
+	assert.Len(t, v.Inbox, 0)
+
+	// The zero filter lets every update through
+	v.SetFilter(Filter[string]{})
+	w.WriteAt(-10, -10, 0x200)
+	assert.Equal(t, WorldAt(-10, -10), (<-v.Inbox).New.WorldPoint)
+}
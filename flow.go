@@ -0,0 +1,294 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"math"
+)
+
+// noDirection marks the tiles which have no direction, such as goals or tiles from
+// which the goal can not be reached.
+const noDirection Direction = 0xFF
+
+// pending marks the tiles whose direction needs to be recomputed
+const pending Direction = 0xFE
+
+// FlowField represents a field of directions towards one or more goals, which can be
+// shared by any number of units heading to the same goals. It holds an integration
+// field with the cost of reaching the closest goal from each tile, along with the
+// direction to move in, so each unit can simply sample the direction at its location
+// and move there, instead of searching for its own path.
+//
+// The flow field is not thread-safe, the updates must not run concurrently with the
+// reads of the field.
+type FlowField[T comparable] struct {
+	integration[T]
+	goals []Point     // The goals of the field
+	flow  []Direction // The direction towards the goals, for each tile
+}
+
+// NewFlowField creates a new flow field towards a set of goals, given a cost function.
+// The cost of moving to a tile is the same as in Path(), and blocked tiles as well as
+// the tiles which can not reach any of the goals have no direction.
+func NewFlowField[T comparable](m *Grid[T], costOf costFn, goals ...Point) *FlowField[T] {
+	f := &FlowField[T]{
+		integration: newIntegration(m, costOf),
+		goals:       goals,
+		flow:        make([]Direction, len(m.pages)*9),
+	}
+
+	for i := range f.flow {
+		f.flow[i] = noDirection
+	}
+
+	f.Update(Rect{Max: m.Size})
+	return f
+}
+
+// At returns the direction to move in from a tile, in order to reach the closest goal.
+// It returns false if the tile is one of the goals or if no goal can be reached.
+func (f *FlowField[T]) At(x, y int16) (Direction, bool) {
+	if !At(x, y).WithinSize(f.size) {
+		return noDirection, false
+	}
+
+	dir := f.flow[f.indexOf(x, y)]
+	return dir, dir != noDirection
+}
+
+// CostAt returns the cost of reaching the closest goal from a tile. It returns false
+// if no goal can be reached from the tile.
+func (f *FlowField[T]) CostAt(x, y int16) (uint32, bool) {
+	if !At(x, y).WithinSize(f.size) {
+		return 0, false
+	}
+
+	cost := f.costs[f.indexOf(x, y)]
+	return cost, cost != math.MaxUint32
+}
+
+// Update recomputes the flow field after the tiles within a rectangle have changed. Only
+// the tiles whose path to the goal went through the rectangle are recomputed, along with
+// the tiles which can now reach the goal with a lower cost.
+func (f *FlowField[T]) Update(r Rect) {
+	touched := f.integrate(r, f.goals)
+
+	// The direction depends on the costs of the neighbors, so all of the neighbors of
+	// the changed tiles need to be updated as well. Each of them is marked as pending
+	// first, so that it is only updated once.
+	f.stack = f.stack[:0]
+	for _, v := range touched {
+		at := unpackPoint(v)
+		f.markPending(at)
+		for dir := North; dir <= NorthWest; dir++ {
+			if next := at.Move(dir); next.WithinSize(f.size) {
+				f.markPending(next)
+			}
+		}
+	}
+
+	for _, v := range f.stack {
+		at := unpackPoint(v)
+		f.flow[f.indexOf(at.X, at.Y)] = f.directionOf(at)
+	}
+}
+
+// markPending marks the direction of a tile as pending an update
+func (f *FlowField[T]) markPending(at Point) {
+	if i := f.indexOf(at.X, at.Y); f.flow[i] != pending {
+		f.flow[i] = pending
+		f.stack = append(f.stack, at.Integer())
+	}
+}
+
+// directionOf returns the direction towards the neighbor with the lowest cost, which
+// always leads to the goal since it is cheaper than the tile itself.
+func (f *FlowField[T]) directionOf(at Point) Direction {
+	if cost := f.costs[f.indexOf(at.X, at.Y)]; cost == 0 || cost == math.MaxUint32 {
+		return noDirection // Goal or unreachable
+	}
+
+	return f.slope(at, func(next, best int) bool {
+		return f.costs[next] < f.costs[best]
+	})
+}
+
+// ---------------------------------- Integration ----------------------------------
+
+// integration represents an integration field, which holds the cost of reaching the
+// closest seed from each of the tiles, along with the direction of the next tile on
+// the cheapest path. It is computed using a four-directional Dijkstra search from all
+// of the seeds at once and can be updated incrementally.
+type integration[T comparable] struct {
+	grid    *Grid[T]    // The associated map
+	size    Point       // The size of the map, when the field was created
+	costOf  costFn      // The cost function of the tiles
+	costs   []uint32    // The cost of reaching a seed, for each tile
+	parents []Direction // The direction of the next tile towards a seed, for each tile
+	queue   *frontier   // The frontier of the search
+	origins []uint32    // The index of the closest seed for each tile, if tracked
+	stack   []uint32    // The invalidated tiles, reused between the updates
+	touched []uint32    // The changed tiles, reused between the updates
+}
+
+// newIntegration creates a new integration field where none of the tiles are reached
+func newIntegration[T comparable](m *Grid[T], costOf costFn) integration[T] {
+	size := len(m.pages) * 9
+	field := integration[T]{
+		grid:    m,
+		size:    m.Size,
+		costOf:  costOf,
+		costs:   make([]uint32, size),
+		parents: make([]Direction, size),
+		queue:   newFrontier(),
+	}
+
+	for i := range field.costs {
+		field.costs[i] = math.MaxUint32
+		field.parents[i] = noDirection
+	}
+	return field
+}
+
+// integrate recomputes the costs after the tiles within a rectangle have changed and
+// returns the tiles whose cost has changed. First, the tiles of the rectangle and all
+// of the tiles whose cheapest path goes through them are invalidated. Then, the search
+// resumes from the valid tiles around them and from the seeds, which also propagates
+// the costs which have decreased to the rest of the field.
+func (f *integration[T]) integrate(r Rect, seeds []Point) []uint32 {
+	size := f.size
+	r.Min = At(max(r.Min.X, 0), max(r.Min.Y, 0))
+	r.Max = At(min(r.Max.X, size.X), min(r.Max.Y, size.Y))
+
+	// Invalidate the rectangle and the tiles which depend on it. Since the parent of
+	// an invalid tile is reset, each of the dependent tiles is only added once.
+	f.stack = f.stack[:0]
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			f.invalidate(At(x, y))
+		}
+	}
+
+	for i := 0; i < len(f.stack); i++ {
+		at := unpackPoint(f.stack[i])
+		for dir := North; dir <= NorthWest; dir += 2 {
+			next := at.Move(dir)
+			if next.WithinSize(size) && f.parents[f.indexOf(next.X, next.Y)] == oppositeDirection(dir) {
+				f.invalidate(next)
+			}
+		}
+	}
+
+	// Resume the search from the valid tiles around the invalidated ones
+	queue := f.queue
+	queue.Reset()
+	for _, v := range f.stack {
+		at := unpackPoint(v)
+		for dir := North; dir <= NorthWest; dir += 2 {
+			next := at.Move(dir)
+			if next.WithinSize(size) && f.costs[f.indexOf(next.X, next.Y)] != math.MaxUint32 {
+				queue.Push(next.Integer(), f.costs[f.indexOf(next.X, next.Y)])
+			}
+		}
+	}
+
+	// Start from all of the seeds, which could have been invalidated too
+	f.touched = append(f.touched[:0], f.stack...)
+	for origin, at := range seeds {
+		if !f.passable(at) {
+			continue // Seed is blocked
+		}
+
+		if i := f.indexOf(at.X, at.Y); f.costs[i] != 0 {
+			f.costs[i] = 0
+			f.parents[i] = noDirection
+			if f.origins != nil {
+				f.origins[i] = uint32(origin)
+			}
+
+			f.touched = append(f.touched, at.Integer())
+			queue.Push(at.Integer(), 0)
+		}
+	}
+
+	// Propagate the costs, since the neighbors move into the current tile, they pay
+	// the cost of the current tile.
+	for !queue.IsEmpty() {
+		current := unpackPoint(queue.Pop())
+		currentCost := f.costs[f.indexOf(current.X, current.Y)]
+		if currentCost < queue.last {
+			continue // Already visited with a lower cost
+		}
+
+		step := uint32(f.costOf(f.grid.valueAt(current.X, current.Y)))
+		if step == 0 {
+			continue // Blocked tile, can't move into it
+		}
+
+		for dir := North; dir <= NorthWest; dir += 2 {
+			next := current.Move(dir)
+			if !next.WithinSize(size) || !f.passable(next) {
+				continue
+			}
+
+			i := f.indexOf(next.X, next.Y)
+			if nextCost := currentCost + step; nextCost < f.costs[i] {
+				f.costs[i] = nextCost
+				f.parents[i] = oppositeDirection(dir)
+				if f.origins != nil {
+					f.origins[i] = f.origins[f.indexOf(current.X, current.Y)]
+				}
+
+				f.touched = append(f.touched, next.Integer())
+				queue.Push(next.Integer(), nextCost)
+			}
+		}
+	}
+
+	return f.touched
+}
+
+// slope returns the direction towards the neighbor which is better than the tile
+// itself and all of the other neighbors, according to the comparison function of
+// their indices. Diagonal moves are only allowed if both of the adjacent sides are
+// passable, so that a unit would not cut the corner of a blocked tile.
+func (f *integration[T]) slope(at Point, better func(next, best int) bool) Direction {
+	best, bestIdx := noDirection, f.indexOf(at.X, at.Y)
+	for dir := North; dir <= NorthWest; dir++ {
+		next := at.Move(dir)
+		if !next.WithinSize(f.size) {
+			continue
+		}
+
+		i := f.indexOf(next.X, next.Y)
+		switch {
+		case !better(i, bestIdx):
+			continue
+		case dir%2 == 1 && !(f.passable(at.Move(dir-1)) && f.passable(at.Move((dir+1)%8))):
+			continue // Diagonal move would cut a corner
+		default:
+			best, bestIdx = dir, i
+		}
+	}
+	return best
+}
+
+// invalidate marks the tile as not reached and adds it to the stack
+func (f *integration[T]) invalidate(at Point) {
+	i := f.indexOf(at.X, at.Y)
+	f.costs[i] = math.MaxUint32
+	f.parents[i] = noDirection
+	f.stack = append(f.stack, at.Integer())
+}
+
+// passable returns whether a tile is within the field and the grid, which might have
+// been resized since, and can be moved to
+func (f *integration[T]) passable(at Point) bool {
+	return at.WithinSize(f.size) && at.WithinSize(f.grid.Size) && f.costOf(f.grid.valueAt(at.X, at.Y)) != 0
+}
+
+// indexOf returns the index of a tile in the field
+func (f *integration[T]) indexOf(x, y int16) int {
+	return int(y)*int(f.size.X) + int(x)
+}
@@ -0,0 +1,160 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+cpu: Intel(R) Xeon(R) Processor
+BenchmarkFlowField/build         	     111	  10995099 ns/op	 3347030 B/op	      94 allocs/op
+BenchmarkFlowField/update        	 1814419	       691.6 ns/op	      32 B/op	       1 allocs/op
+BenchmarkFlowField/at            	1000000000	         1.073 ns/op	       0 B/op	       0 allocs/op
+*/
+func BenchmarkFlowField(b *testing.B) {
+	m := mapFrom("300x300.png")
+
+	b.Run("build", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			NewFlowField(m, costOf, At(160, 270))
+		}
+	})
+
+	b.Run("update", func(b *testing.B) {
+		f := NewFlowField(m, costOf, At(160, 270))
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			m.WriteAt(96, 142, Value(n%2))
+			f.Update(NewRect(96, 142, 97, 143))
+		}
+	})
+
+	b.Run("at", func(b *testing.B) {
+		f := NewFlowField(m, costOf, At(160, 270))
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			f.At(115, 20)
+		}
+	})
+}
+
+func TestFlowField(t *testing.T) {
+	m := mapFrom("300x300.png")
+	f := NewFlowField(m, costOf, At(160, 270))
+
+	// The cost is the same as the one of the shortest path
+	_, expect, _ := m.Path(At(115, 20), At(160, 270), costOf)
+	cost, ok := f.CostAt(115, 20)
+	assert.True(t, ok)
+	assert.Equal(t, uint32(expect), cost)
+
+	// Following the field should lead to the goal
+	assert.Equal(t, At(160, 270), assertFlow(t, f, At(115, 20)))
+
+	// Goal has no direction, but is reachable
+	_, ok = f.At(160, 270)
+	assert.False(t, ok)
+	cost, ok = f.CostAt(160, 270)
+	assert.True(t, ok)
+	assert.Equal(t, uint32(0), cost)
+}
+
+func TestFlowFieldGoals(t *testing.T) {
+	m := NewGrid(30, 30)
+	f := NewFlowField(m, costOf, At(0, 0), At(29, 29))
+
+	// Each unit heads to the closest goal
+	assert.Equal(t, At(0, 0), assertFlow(t, f, At(5, 8)))
+	assert.Equal(t, At(29, 29), assertFlow(t, f, At(25, 20)))
+
+	cost, _ := f.CostAt(5, 8)
+	assert.Equal(t, uint32(13), cost)
+}
+
+func TestFlowFieldMiss(t *testing.T) {
+	m := mapFrom("9x9.png")
+	f := NewFlowField(m, costOf, At(7, 7))
+
+	// Blocked tile
+	_, ok := f.At(0, 0)
+	assert.False(t, ok)
+	_, ok = f.CostAt(0, 0)
+	assert.False(t, ok)
+
+	// Outside of the grid
+	_, ok = f.At(20, 20)
+	assert.False(t, ok)
+	_, ok = f.CostAt(-1, 0)
+	assert.False(t, ok)
+
+	// Blocked goal can not be reached from anywhere
+	f = NewFlowField(m, costOf, At(0, 0))
+	_, ok = f.CostAt(1, 1)
+	assert.False(t, ok)
+}
+
+func TestFlowFieldCorners(t *testing.T) {
+	m := NewGrid(9, 9)
+	m.WriteAt(4, 3, Value(0xff))
+
+	// Diagonal move would cut the corner of the blocked tile
+	f := NewFlowField(m, costOf, At(5, 3))
+	dir, ok := f.At(4, 4)
+	assert.True(t, ok)
+	assert.Equal(t, East, dir)
+}
+
+func TestFlowFieldUpdate(t *testing.T) {
+	m := mapFrom("300x300.png")
+	f := NewFlowField(m, costOf, At(160, 270), At(20, 20))
+
+	for i := 0; i < 20; i++ {
+		x, y := int16(rand(i*7))+20, int16(rand(i*13+1))+20
+		r := NewRect(x, y, x+int16(i%5)+1, y+int16(i%3)+1)
+
+		// Open or block a small rectangle, which may cut existing paths or create new
+		// shortcuts, or even block the goal itself.
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				m.WriteAt(x, y, Value(i%2))
+			}
+		}
+
+		// Incremental update should match a full rebuild
+		f.Update(r)
+		if i == 10 {
+			m.WriteAt(20, 20, Value(0xff))
+			f.Update(NewRect(20, 20, 21, 21))
+		}
+
+		expect := NewFlowField(m, costOf, At(160, 270), At(20, 20))
+		assert.Equal(t, expect.costs, f.costs, "costs differ after %v", r)
+		assert.Equal(t, expect.flow, f.flow, "flow differs after %v", r)
+	}
+}
+
+// assertFlow follows the flow field from a point and returns where it stops, checking
+// that every step is passable and lowers the cost.
+func assertFlow[T comparable](t *testing.T, f *FlowField[T], from Point) Point {
+	at := from
+	for {
+		dir, ok := f.At(at.X, at.Y)
+		if !ok {
+			return at
+		}
+
+		prev, _ := f.CostAt(at.X, at.Y)
+		at = at.Move(dir)
+		next, ok := f.CostAt(at.X, at.Y)
+		assert.True(t, ok, "flow leads to an unreachable tile %v", at)
+		assert.Less(t, next, prev, "flow does not lower the cost at %v", at)
+	}
+}
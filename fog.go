@@ -0,0 +1,279 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"math/bits"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// Sight represents the sight of a single unit, used to lift the fog of war.
+type Sight struct {
+	Origin Point // The position of the unit
+	Radius int16 // The radius of the sight
+}
+
+// Fog represents a fog of war for several factions. For each of the factions, it keeps
+// a bit plane of the tiles which are currently visible and another one of the tiles
+// which were explored at some point. Views can be attached to the fog of a faction, in
+// which case they only receive the updates of the tiles which are currently visible,
+// along with the tiles which were revealed once the fog lifts.
+type Fog[T comparable] struct {
+	mu     sync.Mutex    // Protects the updates and the views
+	grid   *Grid[T]      // The associated map
+	size   Point         // The size of the map covered by the planes
+	planes []fogPlane[T] // The bit planes, for each faction
+}
+
+// fogPlane represents the fog of war of a single faction.
+type fogPlane[T comparable] struct {
+	visible  []uint64      // The tiles which are currently visible
+	explored []uint64      // The tiles which were visible at some point
+	next     []uint64      // The tiles which are visible after the update
+	views    []Observer[T] // The views attached to the fog of the faction
+}
+
+// NewFog creates a new fog of war for a number of factions, where none of the tiles
+// are visible nor explored.
+func NewFog[T comparable](m *Grid[T], factions int) *Fog[T] {
+	words := (int(m.Size.X)*int(m.Size.Y) + 63) / 64
+	fog := &Fog[T]{
+		grid:   m,
+		size:   m.Size,
+		planes: make([]fogPlane[T], factions),
+	}
+
+	for i := range fog.planes {
+		fog.planes[i] = fogPlane[T]{
+			visible:  make([]uint64, words),
+			explored: make([]uint64, words),
+			next:     make([]uint64, words),
+		}
+	}
+	return fog
+}
+
+// IsVisible returns whether a tile is currently visible to a faction.
+func (f *Fog[T]) IsVisible(faction int, x, y int16) bool {
+	return f.isSet(f.planes[faction].visible, x, y)
+}
+
+// IsExplored returns whether a tile was visible to a faction at some point.
+func (f *Fog[T]) IsExplored(faction int, x, y int16) bool {
+	return f.isSet(f.planes[faction].explored, x, y)
+}
+
+// Update recomputes the tiles which are visible to a faction from the sights of all of
+// its units, using FieldOfView() with a predicate which returns whether a tile blocks
+// the sight. The tiles which become visible are also explored, and the views attached
+// to the faction receive the revealed tiles in a single batch: an update for each of
+// the tiles with the same old and new value, along with an ObjectAdded update for each
+// of the objects standing on them, so that they can show what was revealed. All of
+// these updates carry FogRevealed along with their kind.
+func (f *Fog[T]) Update(faction int, opaque func(Value) bool, sights ...Sight) {
+	revealed, views := f.update(faction, opaque, sights)
+
+	// Deliver the revealed tiles once the fog is unlocked, since the views might be
+	// closed or attached to the fog concurrently.
+	f.notify(views, revealed)
+}
+
+// update recomputes the visible tiles of a faction, and returns the updates of the
+// tiles which were revealed, along with the views attached to the faction.
+func (f *Fog[T]) update(faction int, opaque func(Value) bool, sights []Sight) ([]Update[T], []Observer[T]) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	plane := &f.planes[faction]
+	clear(plane.next)
+	for _, sight := range sights {
+		f.grid.FieldOfView(sight.Origin, sight.Radius, opaque, func(p Point, _ Tile[T]) {
+			if p.WithinSize(f.size) {
+				i := int(p.Y)*int(f.size.X) + int(p.X)
+				plane.next[i/64] |= 1 << (i % 64)
+			}
+		})
+	}
+
+	// Swap the visible tiles word by word, since they are concurrently read by the
+	// views, and collect the tiles which were revealed.
+	var revealed []Update[T]
+	for i, next := range plane.next {
+		prev := atomic.SwapUint64(&plane.visible[i], next)
+		atomic.OrUint64(&plane.explored[i], next)
+		if len(plane.views) == 0 {
+			continue
+		}
+
+		for shown := next &^ prev; shown != 0; shown &= shown - 1 {
+			revealed = f.reveal(revealed, i*64+bits.TrailingZeros64(shown))
+		}
+	}
+
+	if len(revealed) == 0 {
+		return nil, nil
+	}
+	return revealed, slices.Clone(plane.views)
+}
+
+// reveal appends the updates of a revealed tile, which are the value of the tile and
+// each of the objects standing on it.
+func (f *Fog[T]) reveal(dst []Update[T], i int) []Update[T] {
+	tile, ok := f.grid.At(int16(i%int(f.size.X)), int16(i/int(f.size.X)))
+	if !ok {
+		return dst
+	}
+
+	value := ValueAt{Point: tile.Point(), Value: tile.Value()}
+	dst = append(dst, Update[T]{
+		Old:  value,
+		New:  value,
+		Seq:  f.grid.seq.Add(1),
+		Kind: ValueChanged | FogRevealed,
+	})
+
+	tile.Range(func(object T) error {
+		dst = append(dst, Update[T]{
+			Old:  value,
+			New:  value,
+			Add:  object,
+			Seq:  f.grid.seq.Add(1),
+			Kind: ObjectAdded | FogRevealed,
+		})
+		return nil
+	})
+	return dst
+}
+
+// notify sends the revealed updates to each of the views of a faction, in a single
+// batch of the updates within the viewport of the view.
+func (f *Fog[T]) notify(views []Observer[T], revealed []Update[T]) {
+	if len(revealed) == 0 {
+		return
+	}
+
+	group := make([]Update[T], 0, len(revealed))
+	for _, view := range views {
+		group = group[:0]
+		viewport := view.Viewport()
+		for _, ev := range revealed {
+			if f.grid.contains(viewport, ev.New.Point) {
+				group = append(group, ev)
+			}
+		}
+
+		switch b, ok := view.(batchObserver[T]); {
+		case len(group) == 0:
+			continue
+		case ok:
+			b.onBatch(group)
+		default:
+			for i := range group {
+				view.onUpdate(&group[i])
+			}
+		}
+	}
+}
+
+// redact returns the update which should be delivered to a view of a faction, or nil
+// if the update is hidden by the fog. An update is delivered when either the old or the
+// new tile is visible, but the hidden end of a moving object is never disclosed: the
+// object rather appears to be removed from or added to the visible tile.
+func (f *Fog[T]) redact(faction int, ev *Update[T]) *Update[T] {
+	visible := f.planes[faction].visible
+	oldVisible := f.isSet(visible, ev.Old.X, ev.Old.Y)
+	newVisible := f.isSet(visible, ev.New.X, ev.New.Y)
+	switch {
+	case oldVisible && newVisible:
+		return ev
+	case !oldVisible && !newVisible:
+		return nil
+	case ev.Kind&ObjectMoved == 0:
+		return ev // Both ends are the same tile
+	}
+
+	var zero T
+	redacted := *ev
+	redacted.Kind &^= ObjectMoved
+	if oldVisible {
+		redacted.New, redacted.Add = redacted.Old, zero
+		redacted.Kind |= ObjectRemoved
+	} else {
+		redacted.Old, redacted.Del = redacted.New, zero
+		redacted.Kind |= ObjectAdded
+	}
+	return &redacted
+}
+
+// attach attaches a view to the fog of a faction
+func (f *Fog[T]) attach(faction int, view Observer[T]) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.planes[faction].views = append(f.planes[faction].views, view)
+}
+
+// detach detaches a view from the fog of a faction
+func (f *Fog[T]) detach(faction int, view Observer[T]) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	plane := &f.planes[faction]
+	clean := plane.views[:0]
+	for _, v := range plane.views {
+		if v != view {
+			clean = append(clean, v)
+		}
+	}
+	plane.views = clean
+}
+
+// resize moves the tiles of the fog along with the tiles of the grid, once the grid was
+// resized from a previous size and its existing tiles were moved by an offset.
+func (f *Fog[T]) resize(prev, moved Point) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.size != prev {
+		return // Already resized, or not covering the previous size
+	}
+
+	size := f.grid.Size
+	words := (int(size.X)*int(size.Y) + 63) / 64
+	for i := range f.planes {
+		plane := &f.planes[i]
+		plane.visible = f.move(plane.visible, words, moved)
+		plane.explored = f.move(plane.explored, words, moved)
+		plane.next = make([]uint64, words)
+	}
+	f.size = size
+}
+
+// move returns a copy of a plane of the previous size of the grid, where each of the
+// tiles is moved by an offset and the tiles which are no longer within the grid are
+// dropped.
+func (f *Fog[T]) move(plane []uint64, words int, moved Point) []uint64 {
+	out := make([]uint64, words)
+	for i, word := range plane {
+		for ; word != 0; word &= word - 1 {
+			j := i*64 + bits.TrailingZeros64(word)
+			at := At(int16(j%int(f.size.X)), int16(j/int(f.size.X))).Add(moved)
+			if at.WithinSize(f.grid.Size) {
+				k := int(at.Y)*int(f.grid.Size.X) + int(at.X)
+				out[k/64] |= 1 << (k % 64)
+			}
+		}
+	}
+	return out
+}
+
+// isSet returns whether the bit of a tile is set in a plane
+func (f *Fog[T]) isSet(plane []uint64, x, y int16) bool {
+	if !At(x, y).WithinSize(f.size) {
+		return false
+	}
+
+	i := int(y)*int(f.size.X) + int(x)
+	return atomic.LoadUint64(&plane[i/64])&(1<<(i%64)) != 0
+}
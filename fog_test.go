@@ -0,0 +1,255 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+cpu: Intel(R) Xeon(R) Processor
+BenchmarkFog/update         	   17806	     78895 ns/op	       0 B/op	       0 allocs/op
+BenchmarkFog/write          	 9995378	       139.7 ns/op	      64 B/op	       1 allocs/op
+*/
+func BenchmarkFog(b *testing.B) {
+	m := mapFrom("300x300.png")
+	fog := NewFog(m, 2)
+	sights := make([]Sight, 0, 10)
+	for i := 0; i < 10; i++ {
+		sights = append(sights, Sight{At(int16(rand(i*7)), int16(rand(i*13+1))), 8})
+	}
+
+	b.Run("update", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			fog.Update(0, opaque, sights...)
+		}
+	})
+
+	b.Run("write", func(b *testing.B) {
+		v := NewView(m, "view 1")
+		v.Resize(NewRect(100, 0, 200, 100), nil)
+		v.SetFog(fog, 0)
+		defer v.Close()
+
+		go func() {
+			for range v.Inbox {
+			}
+		}()
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			v.WriteAt(152, 52, Value(0))
+		}
+	})
+}
+
+func TestFog(t *testing.T) {
+	m := NewGrid(30, 30)
+	m.WriteAt(10, 5, Value(0xff))
+	fog := NewFog(m, 2)
+	assert.False(t, fog.IsVisible(0, 5, 5))
+	assert.False(t, fog.IsExplored(0, 5, 5))
+
+	// The unit sees around itself, but not behind the wall
+	fog.Update(0, opaque, Sight{At(5, 5), 8})
+	assert.True(t, fog.IsVisible(0, 5, 5))
+	assert.True(t, fog.IsVisible(0, 10, 5))
+	assert.False(t, fog.IsVisible(0, 12, 5))
+	assert.True(t, fog.IsExplored(0, 9, 5))
+	assert.False(t, fog.IsVisible(0, 20, 20))
+
+	// The other faction sees nothing
+	assert.False(t, fog.IsVisible(1, 5, 5))
+	assert.False(t, fog.IsExplored(1, 5, 5))
+
+	// The unit moves away, the tiles remain explored
+	fog.Update(0, opaque, Sight{At(20, 20), 3}, Sight{At(25, 25), 3})
+	assert.False(t, fog.IsVisible(0, 5, 5))
+	assert.True(t, fog.IsExplored(0, 5, 5))
+	assert.True(t, fog.IsVisible(0, 20, 20))
+	assert.True(t, fog.IsVisible(0, 25, 25))
+
+	// Outside of the grid
+	assert.False(t, fog.IsVisible(0, -1, 5))
+	assert.False(t, fog.IsExplored(0, 5, 30))
+}
+
+func TestFogView(t *testing.T) {
+	m := NewGrid(30, 30)
+	fog := NewFog(m, 2)
+	fog.Update(0, opaque, Sight{At(5, 5), 2})
+
+	v := NewView(m, "view 1")
+	v.Resize(NewRect(0, 0, 30, 30), nil)
+	v.SetFog(fog, 0)
+	defer v.Close()
+
+	// Updates of the hidden tiles are filtered out
+	m.WriteAt(20, 20, Value(1))
+	m.WriteAt(5, 5, Value(2))
+	update := <-v.Inbox
+	assert.Equal(t, At(5, 5), update.New.Point)
+	assert.Equal(t, Value(2), update.New.Value)
+
+	// Objects moving into the fog are seen as removed, without disclosing where to
+	tile, _ := m.At(5, 6)
+	tile.Add("A")
+	<-v.Inbox
+	tile.Move("A", At(20, 21))
+	update = <-v.Inbox
+	assert.Equal(t, ObjectRemoved, update.Kind)
+	assert.Equal(t, At(5, 6), update.Old.Point)
+	assert.Equal(t, At(5, 6), update.New.Point)
+	assert.Equal(t, "A", update.Del)
+	assert.Empty(t, update.Add)
+
+	// Lifting the fog reveals the hidden tiles, along with the objects on them
+	fog.Update(0, opaque, Sight{At(5, 5), 2}, Sight{At(20, 20), 1})
+	revealed := map[Point]Value{}
+	var seq uint64
+	for len(v.Inbox) > 0 {
+		update := <-v.Inbox
+		assert.Equal(t, update.Old, update.New)
+		assert.Greater(t, update.Seq, seq)
+		seq = update.Seq
+		switch update.Kind {
+		case ObjectAdded:
+			assert.Equal(t, At(20, 21), update.New.Point)
+			assert.Equal(t, "A", update.Add)
+		default:
+			revealed[update.New.Point] = update.New.Value
+		}
+	}
+
+	assert.Len(t, revealed, 5)
+	assert.Equal(t, Value(1), revealed[At(20, 20)])
+	m.WriteAt(20, 20, Value(3))
+	assert.Equal(t, Value(3), (<-v.Inbox).New.Value)
+
+	// Other factions and detached views see everything
+	v.SetFog(fog, 1)
+	m.WriteAt(20, 20, Value(4))
+	assert.Len(t, v.Inbox, 0)
+	v.SetFog(nil, 0)
+	m.WriteAt(25, 25, Value(5))
+	assert.Equal(t, Value(5), (<-v.Inbox).New.Value)
+}
+
+func TestFogMove(t *testing.T) {
+	m := NewGrid(30, 30)
+	fog := NewFog(m, 1)
+	fog.Update(0, opaque, Sight{At(2, 2), 1})
+
+	v := NewView(m, "view 1")
+	v.Resize(NewRect(0, 0, 30, 30), nil)
+	v.SetFog(fog, 0)
+	defer v.Close()
+
+	// Objects coming out of the fog are seen as added, without disclosing where from
+	tile, _ := m.At(25, 25)
+	tile.Add("A")
+	tile.Move("A", At(2, 2))
+	assert.Len(t, v.Inbox, 1)
+	update := <-v.Inbox
+	assert.Equal(t, ObjectAdded, update.Kind)
+	assert.Equal(t, At(2, 2), update.Old.Point)
+	assert.Equal(t, At(2, 2), update.New.Point)
+	assert.Equal(t, "A", update.Add)
+	assert.Empty(t, update.Del)
+
+	// Objects moving within the visible tiles are seen moving
+	tile, _ = m.At(2, 2)
+	tile.Move("A", At(2, 3))
+	update = <-v.Inbox
+	assert.Equal(t, ObjectMoved, update.Kind)
+	assert.Equal(t, At(2, 2), update.Old.Point)
+	assert.Equal(t, At(2, 3), update.New.Point)
+}
+
+func TestFogReveal(t *testing.T) {
+	m := NewGrid(30, 30)
+	tile, _ := m.At(20, 20)
+	tile.Add("A")
+	fog := NewFog(m, 1)
+
+	v := NewView(m, "view 1")
+	v.Resize(NewRect(0, 0, 30, 30), nil)
+	v.SetFog(fog, 0)
+	defer v.Close()
+
+	// The revealed tiles are sent in a single batch, ordered after the earlier updates
+	m.WriteAt(1, 1, 0)
+	seq := m.seq.Load()
+	fog.Update(0, opaque, Sight{At(1, 1), 1}, Sight{At(20, 20), 0})
+	assert.Len(t, v.Inbox, 7)
+
+	var objects []string
+	for len(v.Inbox) > 0 {
+		update := <-v.Inbox
+		assert.Equal(t, seq+1, update.Seq)
+		seq = update.Seq
+		assert.True(t, update.Kind.Is(FogRevealed))
+		if update.Kind.Is(ObjectAdded) {
+			objects = append(objects, update.Add)
+		}
+	}
+	assert.Equal(t, []string{"A"}, objects)
+}
+
+func TestFogClose(t *testing.T) {
+	m := NewGrid(9, 9)
+	fog := NewFog(m, 1)
+
+	v := NewView(m, "view 1")
+	v.Resize(NewRect(0, 0, 9, 9), nil)
+	v.SetFog(fog, 0)
+	v.SetFog(fog, 0)
+	assert.Len(t, fog.planes[0].views, 1)
+
+	// Closed views are no longer revealed to
+	assert.NoError(t, v.Close())
+	assert.Len(t, fog.planes[0].views, 0)
+	fog.Update(0, opaque, Sight{At(4, 4), 3})
+	assert.Len(t, v.Inbox, 0)
+}
+
+func TestFogBlocked(t *testing.T) {
+	m := NewGrid(9, 9)
+	fog := NewFog(m, 1)
+
+	v := NewView(m, "view 1", WithInbox(1))
+	v.Resize(NewRect(0, 0, 9, 9), nil)
+	v.SetFog(fog, 0)
+
+	// The delivery of the revealed tiles blocks on the full inbox, which doesn't keep
+	// the other views from being attached to or detached from the fog.
+	done := make(chan struct{})
+	go func() {
+		fog.Update(0, opaque, Sight{At(4, 4), 1})
+		close(done)
+	}()
+
+	for len(v.Inbox) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	other := NewView(m, "view 2")
+	other.SetFog(fog, 0)
+	assert.NoError(t, other.Close())
+
+	for {
+		select {
+		case <-v.Inbox:
+		case <-done:
+			assert.NoError(t, v.Close())
+			return
+		}
+	}
+}
@@ -10,22 +10,34 @@ import (
 
 // Grid represents a 2D tile map. Internally, a map is composed of 3x3 pages.
 type Grid[T comparable] struct {
-	pages      []page[T] // The pages of the map
-	pageWidth  int16     // The max page width
-	pageHeight int16     // The max page height
-	observers  pubsub[T] // The map of observers
-	Size       Point     // The map size
+	pages      []page[T]                  // The pages of the map
+	pageWidth  int16                      // The max page width
+	pageHeight int16                      // The max page height
+	observers  pubsub[T]                  // The map of observers
+	wrap       Point                      // The size of the axes which wrap around, or zero
+	txs        sync.Pool                  // The reusable batch transactions
+	snaps      atomic.Pointer[[]*Grid[T]] // The active snapshots of the map
+	snapMu     sync.Mutex                 // Protects the creation of the snapshots
+	origin     *Grid[T]                   // The live map, if this is a snapshot
+	copies     []atomic.Pointer[page[T]]  // The copied pages, if this is a snapshot
+	seq        atomic.Uint64              // The sequence number of the last update
+	Size       Point                      // The map size
 }
 
 // NewGrid returns a new map of the specified size. The width and height must be both
 // multiples of 3.
-func NewGrid(width, height int16) *Grid[string] {
-	return NewGridOf[string](width, height)
+func NewGrid(width, height int16, opts ...Option) *Grid[string] {
+	return NewGridOf[string](width, height, opts...)
 }
 
 // NewGridOf returns a new map of the specified size. The width and height must be both
 // multiples of 3.
-func NewGridOf[T comparable](width, height int16) *Grid[T] {
+func NewGridOf[T comparable](width, height int16, opts ...Option) *Grid[T] {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	width, height = width/3, height/3
 
 	max := int32(width) * int32(height)
@@ -42,6 +54,18 @@ func NewGridOf[T comparable](width, height int16) *Grid[T] {
 		},
 	}
 
+	m.txs.New = func() any {
+		return &Tx[T]{grid: m}
+	}
+
+	if o.wrapX {
+		m.wrap.X = m.Size.X
+	}
+	if o.wrapY {
+		m.wrap.Y = m.Size.Y
+	}
+	m.observers.wrap = m.wrap
+
 	// Function to calculate a point based on the index
 	var pointAt func(i int) Point = func(i int) Point {
 		return At(int16(i%int(width)), int16(i/int(width)))
@@ -53,11 +77,22 @@ func NewGridOf[T comparable](width, height int16) *Grid[T] {
 	return m
 }
 
+// tiled represents a map whose tiles are stored in the pages of a grid, which is either
+// a square or a hexagonal grid.
+type tiled[T comparable] interface {
+	tiles() *Grid[T]
+}
+
+// tiles returns the grid which stores the tiles
+func (m *Grid[T]) tiles() *Grid[T] {
+	return m
+}
+
 // Each iterates over all of the tiles in the map.
 func (m *Grid[T]) Each(fn func(Point, Tile[T])) {
 	until := int(m.pageHeight) * int(m.pageWidth)
 	for i := 0; i < until; i++ {
-		m.pages[i].Each(m, fn)
+		m.page(i).Each(m, fn)
 	}
 }
 
@@ -66,7 +101,7 @@ func (m *Grid[T]) Each(fn func(Point, Tile[T])) {
 func (m *Grid[T]) Within(nw, se Point, fn func(Point, Tile[T])) {
 	m.pagesWithin(nw, se, func(page *page[T]) {
 		page.Each(m, func(p Point, v Tile[T]) {
-			if p.Within(nw, se) {
+			if m.contains(Rect{Min: nw, Max: se}, p) {
 				fn(p, v)
 			}
 		})
@@ -74,22 +109,29 @@ func (m *Grid[T]) Within(nw, se Point, fn func(Point, Tile[T])) {
 }
 
 // pagesWithin selects the pages within a specifid bounding box which is specified
-// by north-west and south-east coordinates.
+// by north-west and south-east coordinates. If the grid wraps around, the pages on
+// both sides of the seam are selected.
 func (m *Grid[T]) pagesWithin(nw, se Point, fn func(*page[T])) {
-	if !se.WithinSize(m.Size) {
-		se = At(m.Size.X-1, m.Size.Y-1)
-	}
-
-	for x := nw.X / 3; x <= se.X/3; x++ {
-		for y := nw.Y / 3; y <= se.Y/3; y++ {
-			fn(m.pageAt(x, y))
+	m.split(nw, se, func(nw, se Point) {
+		nw = At(max(nw.X, 0), max(nw.Y, 0))
+		se = At(min(se.X, m.Size.X-1), min(se.Y, m.Size.Y-1))
+		for x := nw.X / 3; x <= se.X/3; x++ {
+			for y := nw.Y / 3; y <= se.Y/3; y++ {
+				fn(m.pageAt(x, y))
+			}
 		}
-	}
+	})
 }
 
 // At returns the tile at a specified position
 func (m *Grid[T]) At(x, y int16) (Tile[T], bool) {
+	x, y = m.wrapAt(x, y)
 	if x >= 0 && y >= 0 && x < m.Size.X && y < m.Size.Y {
+		// Only go through the copies of the pages for a snapshot, so that the reads of
+		// the live grid do not pay for the call.
+		if index := int(x/3) + int(m.pageWidth)*int(y/3); index < len(m.pages) {
+			return m.pages[index].At(m, x, y), true
+		}
 		return m.pageAt(x/3, y/3).At(m, x, y), true
 	}
 
@@ -98,28 +140,70 @@ func (m *Grid[T]) At(x, y int16) (Tile[T], bool) {
 
 // WriteAt updates the entire tile value at a specific coordinate
 func (m *Grid[T]) WriteAt(x, y int16, tile Value) {
+	x, y = m.wrapAt(x, y)
+	if x >= 0 && y >= 0 && x < m.Size.X && y < m.Size.Y {
+		m.pageAt(x/3, y/3).writeTile(m, uint8((y%3)*3+(x%3)), tile, 0)
+	}
+}
+
+// SwapAt updates the entire tile value at a specific coordinate and returns its
+// previous value, or zero if the tile is outside of the grid.
+func (m *Grid[T]) SwapAt(x, y int16, tile Value) Value {
+	x, y = m.wrapAt(x, y)
 	if x >= 0 && y >= 0 && x < m.Size.X && y < m.Size.Y {
-		m.pageAt(x/3, y/3).writeTile(m, uint8((y%3)*3+(x%3)), tile)
+		return m.pageAt(x/3, y/3).writeTile(m, uint8((y%3)*3+(x%3)), tile, 0)
 	}
+	return 0
+}
+
+// CompareAndSwapAt updates the entire tile value at a specific coordinate, only if it
+// still has the old value, and returns whether the tile was updated.
+func (m *Grid[T]) CompareAndSwapAt(x, y int16, old, new Value) bool {
+	x, y = m.wrapAt(x, y)
+	if x >= 0 && y >= 0 && x < m.Size.X && y < m.Size.Y {
+		return m.pageAt(x/3, y/3).swapTile(m, uint8((y%3)*3+(x%3)), old, new, 0)
+	}
+	return false
 }
 
 // MaskAt atomically updates the bits of tile at a specific coordinate. The bits are
 // specified by the mask. The bits that need to be updated should be flipped on in the mask.
-func (m *Grid[T]) MaskAt(x, y int16, tile, mask Value) {
-	m.MergeAt(x, y, func(value Value) Value {
+// It returns the value of the tile before and after the update.
+func (m *Grid[T]) MaskAt(x, y int16, tile, mask Value) (old, new Value) {
+	return m.MergeAt(x, y, func(value Value) Value {
 		return (value &^ mask) | (tile & mask)
 	})
 }
 
 // Merge atomically merges the tile by applying a merging function at a specific coordinate.
-func (m *Grid[T]) MergeAt(x, y int16, merge func(Value) Value) {
+// It returns the value of the tile before and after the merge.
+func (m *Grid[T]) MergeAt(x, y int16, merge func(Value) Value) (old, new Value) {
+	x, y = m.wrapAt(x, y)
 	if x >= 0 && y >= 0 && x < m.Size.X && y < m.Size.Y {
-		m.pageAt(x/3, y/3).mergeTile(m, uint8((y%3)*3+(x%3)), merge)
+		return m.pageAt(x/3, y/3).mergeTile(m, uint8((y%3)*3+(x%3)), merge, 0)
 	}
+	return 0, 0
+}
+
+// TryMergeAt atomically merges the tile by applying a merging function at a specific
+// coordinate, which can veto the update by returning false. It returns the value of the
+// tile before and after the merge, and whether the tile was updated.
+func (m *Grid[T]) TryMergeAt(x, y int16, merge func(Value) (Value, bool)) (old, new Value, ok bool) {
+	x, y = m.wrapAt(x, y)
+	if x >= 0 && y >= 0 && x < m.Size.X && y < m.Size.Y {
+		return m.pageAt(x/3, y/3).updateTile(m, uint8((y%3)*3+(x%3)), merge, 0)
+	}
+	return 0, 0, false
 }
 
 // Neighbors iterates over the direct neighbouring tiles
 func (m *Grid[T]) Neighbors(x, y int16, fn func(Point, Tile[T])) {
+	if m.wrap != (Point{}) {
+		for p, tile := range m.NeighborsOf(At(x, y)) {
+			fn(p, tile)
+		}
+		return
+	}
 
 	// First we need to figure out which pages contain the neighboring tiles and
 	// then load them. In the best-case we need to load only a single page. In
@@ -159,7 +243,16 @@ func (m *Grid[T]) pageAt(x, y int16) *page[T] {
 		return &m.pages[index]
 	}
 
-	return nil
+	return m.copyAt(index)
+}
+
+// page loads a page at a given index. For snapshots, the page is first copied from
+// the live map if it wasn't yet.
+func (m *Grid[T]) page(index int) *page[T] {
+	if m.origin != nil {
+		return m.copied(index)
+	}
+	return &m.pages[index]
 }
 
 // ---------------------------------- Tile ----------------------------------
@@ -179,6 +272,12 @@ type page[T comparable] struct {
 	tiles [9]Value    // Page tiles, 36 bytes
 }
 
+// valueAt reads the value of a tile directly from its page, the point must be within
+// the grid.
+func (m *Grid[T]) valueAt(x, y int16) Value {
+	return m.pageAt(x/3, y/3).tileAt(uint8((y%3)*3 + (x % 3)))
+}
+
 // tileAt reads a tile at a page index
 func (p *page[T]) tileAt(idx uint8) Value {
 	return Value(atomic.LoadUint32((*uint32)(&p.tiles[idx])))
@@ -186,7 +285,7 @@ func (p *page[T]) tileAt(idx uint8) Value {
 
 // IsObserved returns whether the tile is observed or not
 func (p *page[T]) IsObserved() bool {
-	return (atomic.LoadUint32(&p.flags))&1 != 0
+	return (atomic.LoadUint32(&p.flags))&flagObserved != 0
 }
 
 // Bounds returns the bounding box for the tile page.
@@ -213,9 +312,14 @@ func (p *page[T]) Each(grid *Grid[T], fn func(Point, Tile[T])) {
 	fn(Point{x + 2, y + 2}, Tile[T]{grid: grid, data: p, idx: 8}) // SE
 }
 
+// Various flags of the page
+const (
+	flagObserved = 0x1 // The page is observed
+	flagBatched  = 0x2 // The page is locked by a batch
+)
+
 // SetObserved sets the observed flag on the page
 func (p *page[T]) SetObserved(observed bool) {
-	const flagObserved = 0x1
 	for {
 		value := atomic.LoadUint32(&p.flags)
 		merge := value
@@ -231,6 +335,39 @@ func (p *page[T]) SetObserved(observed bool) {
 	}
 }
 
+// compareAndSwap stores the tile only if it still has the expected value and the page
+// is not locked by a batch, in which case it first waits for the batch to be applied
+// and returns false. The expected value must be read before calling it, so a write
+// which misses the batch lock can only replace a value from before the batch, which
+// the batch detects when applying its own changes.
+func (p *page[T]) compareAndSwap(idx uint8, before, after Value) bool {
+	if atomic.LoadUint32(&p.flags)&flagBatched == 0 {
+		return atomic.CompareAndSwapUint32(&p.tiles[idx], uint32(before), uint32(after))
+	}
+
+	waitBatch(&p.mu)
+	return false
+}
+
+// waitBatch waits for the batch which holds the lock of a page to be applied
+func waitBatch(mu *sync.Mutex) {
+	mu.Lock()
+	mu.Unlock()
+}
+
+// lockBatch locks the page for a batch, so that the lock-free writes of the tiles wait
+// for the batch to be applied.
+func (p *page[T]) lockBatch() {
+	p.Lock()
+	atomic.OrUint32(&p.flags, flagBatched)
+}
+
+// unlockBatch unlocks the page which was locked for a batch
+func (p *page[T]) unlockBatch() {
+	atomic.AndUint32(&p.flags, ^uint32(flagBatched))
+	p.Unlock()
+}
+
 // Lock locks the state. Note: this needs to be named Lock() so go vet will
 // complain if the page is copied around.
 func (p *page[T]) Lock() {
@@ -245,62 +382,116 @@ func (p *page[T]) Unlock() {
 
 // ---------------------------------- Mutations ----------------------------------
 
-// writeTile stores the tile and return  whether tile is observed or not
-func (p *page[T]) writeTile(grid *Grid[T], idx uint8, after Value) {
+// writeTile stores the tile and returns its previous value
+func (p *page[T]) writeTile(grid *Grid[T], idx uint8, after Value, origin uint32) Value {
+	if grid.readOnly() {
+		return p.tileAt(idx)
+	}
+
+	p.beginWrite(grid, false)
 	before := p.tileAt(idx)
-	for !atomic.CompareAndSwapUint32(&p.tiles[idx], uint32(before), uint32(after)) {
+	for !p.compareAndSwap(idx, before, after) {
 		before = p.tileAt(idx)
 	}
 
-	// If observed, notify the observers of the tile
-	if p.IsObserved() {
-		at := pointOf(p.point, idx)
-		grid.observers.Notify1(&Update[T]{
-			Old: ValueAt{
-				Point: at,
-				Value: before,
-			},
-			New: ValueAt{
-				Point: at,
-				Value: after,
-			},
-		}, p.point)
-	}
+	p.endWrite(grid)
+	p.notify(grid, idx, before, after, origin)
+	return before
 }
 
-// mergeTile atomically merges the tile bits given a function
-func (p *page[T]) mergeTile(grid *Grid[T], idx uint8, fn func(Value) Value) Value {
+// mergeTile atomically merges the tile bits given a function, and returns the value
+// before and after the merge.
+func (p *page[T]) mergeTile(grid *Grid[T], idx uint8, fn func(Value) Value, origin uint32) (Value, Value) {
+	if grid.readOnly() {
+		return p.tileAt(idx), p.tileAt(idx)
+	}
+
+	p.beginWrite(grid, false)
 	before := p.tileAt(idx)
 	after := fn(before)
 
 	// Swap, if we're not able to re-merge again
-	for !atomic.CompareAndSwapUint32(&p.tiles[idx], uint32(before), uint32(after)) {
+	for !p.compareAndSwap(idx, before, after) {
 		before = p.tileAt(idx)
 		after = fn(before)
 	}
 
-	// If observed, notify the observers of the tile
-	if p.IsObserved() {
-		at := pointOf(p.point, idx)
-		grid.observers.Notify1(&Update[T]{
-			Old: ValueAt{
-				Point: at,
-				Value: before,
-			},
-			New: ValueAt{
-				Point: at,
-				Value: after,
-			},
-		}, p.point)
+	p.endWrite(grid)
+	p.notify(grid, idx, before, after, origin)
+	return before, after
+}
+
+// updateTile atomically updates the tile given a function which can veto the update,
+// and returns the value before and after the update, and whether it was written.
+func (p *page[T]) updateTile(grid *Grid[T], idx uint8, fn func(Value) (Value, bool), origin uint32) (Value, Value, bool) {
+	if grid.readOnly() {
+		return p.tileAt(idx), p.tileAt(idx), false
 	}
 
-	// Return the merged tile data
-	return after
+	p.beginWrite(grid, false)
+	for {
+		before := p.tileAt(idx)
+		after, ok := fn(before)
+		switch {
+		case !ok:
+			return before, before, false
+		case p.compareAndSwap(idx, before, after):
+			p.endWrite(grid)
+			p.notify(grid, idx, before, after, origin)
+			return before, after, true
+		}
+	}
+}
+
+// swapTile stores the tile only if it still has the expected value
+func (p *page[T]) swapTile(grid *Grid[T], idx uint8, before, after Value, origin uint32) bool {
+	if grid.readOnly() {
+		return false
+	}
+
+	p.beginWrite(grid, false)
+	for p.tileAt(idx) == before {
+		if p.compareAndSwap(idx, before, after) {
+			p.endWrite(grid)
+			p.notify(grid, idx, before, after, origin)
+			return true
+		}
+	}
+
+	p.endWrite(grid)
+	return false
 }
 
-// addObject adds object to the set
-func (p *page[T]) addObject(idx uint8, object T) (value uint32) {
+// notify notifies the observers of the tile about its new value, if observed
+func (p *page[T]) notify(grid *Grid[T], idx uint8, before, after Value, origin uint32) {
+	if !p.IsObserved() {
+		return
+	}
+
+	at := pointOf(p.point, idx)
+	grid.observers.Notify1(&Update[T]{
+		Old: ValueAt{
+			Point: at,
+			Value: before,
+		},
+		New: ValueAt{
+			Point: at,
+			Value: after,
+		},
+		Seq:    grid.seq.Add(1),
+		Origin: origin,
+		Kind:   ValueChanged,
+	}, p.point)
+}
+
+// addObject adds object to the set, and returns whether the set has changed
+func (p *page[T]) addObject(grid *Grid[T], idx uint8, object T) (value uint32, added bool) {
+	if grid.readOnly() {
+		return p.tileAt(idx), false
+	}
+
 	p.Lock()
+	p.beginWrite(grid, true)
 
 	// Lazily initialize the map, as most pages might not have anything stored
 	// in them (e.g. water or empty tile)
@@ -308,17 +499,25 @@ func (p *page[T]) addObject(idx uint8, object T) (value uint32) {
 		p.state = make(map[T]uint8)
 	}
 
+	prev, ok := p.state[object]
 	p.state[object] = uint8(idx)
-	value = p.tileAt(idx)
+	value, added = p.tileAt(idx), !ok || prev != idx
 	p.Unlock()
 	return
 }
 
-// delObject removes the object from the set
-func (p *page[T]) delObject(idx uint8, object T) (value uint32) {
+// delObject removes the object from the set, if it is on the tile, and returns whether
+// the set has changed
+func (p *page[T]) delObject(grid *Grid[T], idx uint8, object T) (value uint32, removed bool) {
+	if grid.readOnly() {
+		return p.tileAt(idx), false
+	}
+
 	p.Lock()
-	if p.state != nil {
+	p.beginWrite(grid, true)
+	if at, ok := p.state[object]; ok && at == idx {
 		delete(p.state, object)
+		removed = true
 	}
 	value = p.tileAt(idx)
 	p.Unlock()
@@ -329,9 +528,18 @@ func (p *page[T]) delObject(idx uint8, object T) (value uint32) {
 
 // Tile represents an iterator over all state objects at a particular location.
 type Tile[T comparable] struct {
-	grid *Grid[T] // grid pointer
-	data *page[T] // page pointer
-	idx  uint8    // tile index
+	grid   *Grid[T] // grid pointer
+	data   *page[T] // page pointer
+	idx    uint8    // tile index
+	origin uint32   // origin of the changes made through the tile
+}
+
+// WithOrigin returns a copy of the tile which tags the changes made through it with
+// their origin, such as the identifier of a player or of a replica, which is then
+// carried by each of the updates.
+func (t Tile[T]) WithOrigin(origin uint32) Tile[T] {
+	t.origin = origin
+	return t
 }
 
 // Count returns number of objects at the current tile.
@@ -388,59 +596,73 @@ func (t Tile[T]) Observers(fn func(view Observer[T])) {
 	}, t.data.point)
 }
 
-// Add adds object to the set
+// Add adds object to the set. The observers are only notified if the object was not
+// already on the tile.
 func (t Tile[T]) Add(v T) {
-	value := t.data.addObject(t.idx, v)
-
-	// If observed, notify the observers of the tile
-	if t.data.IsObserved() {
-		at := t.Point()
-		t.grid.observers.Notify1(&Update[T]{
-			Old: ValueAt{
-				Point: at,
-				Value: value,
-			},
-			New: ValueAt{
-				Point: at,
-				Value: value,
-			},
-			Add: v,
-		}, t.data.point)
+	if value, added := t.data.addObject(t.grid, t.idx, v); added {
+		t.notifyObject(value, v, ObjectAdded)
 	}
 }
 
-// Del removes the object from the set
+// Del removes the object from the set. The observers are only notified if the object
+// was on the tile.
 func (t Tile[T]) Del(v T) {
-	value := t.data.delObject(t.idx, v)
-
-	// If observed, notify the observers of the tile
-	if t.data.IsObserved() {
-		at := t.Point()
-		t.grid.observers.Notify1(&Update[T]{
-			Old: ValueAt{
-				Point: at,
-				Value: value,
-			},
-			New: ValueAt{
-				Point: at,
-				Value: value,
-			},
-			Del: v,
-		}, t.data.point)
+	if value, removed := t.data.delObject(t.grid, t.idx, v); removed {
+		t.notifyObject(value, v, ObjectRemoved)
+	}
+}
+
+// notifyObject notifies the observers of the tile, if observed, about an object which
+// was either added or removed.
+func (t Tile[T]) notifyObject(value Value, object T, kind UpdateKind) {
+	if !t.data.IsObserved() {
+		return
+	}
+
+	at := t.Point()
+	update := &Update[T]{
+		Old: ValueAt{
+			Point: at,
+			Value: value,
+		},
+		New: ValueAt{
+			Point: at,
+			Value: value,
+		},
+		Seq:    t.grid.seq.Add(1),
+		Origin: t.origin,
+		Kind:   kind,
+	}
+
+	switch kind {
+	case ObjectAdded:
+		update.Add = object
+	case ObjectRemoved:
+		update.Del = object
 	}
+	t.grid.observers.Notify1(update, t.data.point)
 }
 
-// Move moves an object from the current tile to the destination tile.
+// Move moves an object from the current tile to the destination tile. If the object
+// was not on the current tile, the observers are notified of its addition only, and if
+// it was already on the destination tile, of its removal only.
 func (t Tile[T]) Move(v T, dst Point) bool {
 	d, ok := t.grid.At(dst.X, dst.Y)
-	if !ok {
+	if !ok || t.grid.readOnly() {
 		return false
 	}
 
 	// Move the object from the source to the destination
-	tv := t.data.delObject(d.idx, v)
-	dv := d.data.addObject(d.idx, v)
-	if !t.data.IsObserved() && !d.data.IsObserved() {
+	tv, removed := t.data.delObject(t.grid, t.idx, v)
+	dv, added := d.data.addObject(t.grid, d.idx, v)
+	switch {
+	case removed && !added:
+		t.notifyObject(tv, v, ObjectRemoved)
+		return true
+	case added && !removed:
+		d.WithOrigin(t.origin).notifyObject(dv, v, ObjectAdded)
+		return true
+	case !removed || !t.data.IsObserved() && !d.data.IsObserved():
 		return true
 	}
 
@@ -454,8 +676,11 @@ func (t Tile[T]) Move(v T, dst Point) bool {
 			Point: d.Point(),
 			Value: dv,
 		},
-		Del: v,
-		Add: v,
+		Del:    v,
+		Add:    v,
+		Seq:    t.grid.seq.Add(1),
+		Origin: t.origin,
+		Kind:   ObjectMoved,
 	}
 
 	switch {
@@ -474,20 +699,40 @@ func (t Tile[T]) Move(v T, dst Point) bool {
 
 // Write updates the entire tile value.
 func (t Tile[T]) Write(tile Value) {
-	t.data.writeTile(t.grid, t.idx, tile)
+	t.data.writeTile(t.grid, t.idx, tile, t.origin)
+}
+
+// Swap updates the entire tile value and returns its previous value.
+func (t Tile[T]) Swap(tile Value) Value {
+	return t.data.writeTile(t.grid, t.idx, tile, t.origin)
+}
+
+// CompareAndSwap updates the entire tile value only if it still has the old value, and
+// returns whether the tile was updated.
+func (t Tile[T]) CompareAndSwap(old, new Value) bool {
+	return t.data.swapTile(t.grid, t.idx, old, new, t.origin)
 }
 
 // Merge atomically merges the tile by applying a merging function.
 func (t Tile[T]) Merge(merge func(Value) Value) Value {
-	return t.data.mergeTile(t.grid, t.idx, merge)
+	_, after := t.data.mergeTile(t.grid, t.idx, merge, t.origin)
+	return after
+}
+
+// TryMerge atomically merges the tile by applying a merging function, which can veto
+// the update by returning false. It returns the value of the tile before and after the
+// merge, and whether the tile was updated.
+func (t Tile[T]) TryMerge(merge func(Value) (Value, bool)) (old, new Value, ok bool) {
+	return t.data.updateTile(t.grid, t.idx, merge, t.origin)
 }
 
 // Mask updates the bits of tile. The bits are specified by the mask. The bits
 // that need to be updated should be flipped on in the mask.
 func (t Tile[T]) Mask(tile, mask Value) Value {
-	return t.data.mergeTile(t.grid, t.idx, func(value Value) Value {
+	_, after := t.data.mergeTile(t.grid, t.idx, func(value Value) Value {
 		return (value &^ mask) | (tile & mask)
-	})
+	}, t.origin)
+	return after
 }
 
 // pointOf returns the point given an index
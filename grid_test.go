@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"unsafe"
 
@@ -393,3 +394,93 @@ func TestConcurrentMerge(t *testing.T) {
 	assert.True(t, ok)
 	assert.Equal(t, uint32(count), tile.Value())
 }
+
+func TestSwapAt(t *testing.T) {
+	m := NewGrid(9, 9)
+	assert.Equal(t, Value(0), m.SwapAt(1, 1, 5))
+	assert.Equal(t, Value(5), m.SwapAt(1, 1, 6))
+	assert.Equal(t, Value(0), m.SwapAt(9, 9, 6))
+
+	tile, _ := m.At(1, 1)
+	assert.Equal(t, Value(6), tile.Swap(7))
+	assert.Equal(t, Value(7), tile.Value())
+}
+
+func TestCompareAndSwapAt(t *testing.T) {
+	m := NewGrid(9, 9)
+	v := NewView(m, "view 1")
+	v.Resize(NewRect(0, 0, 9, 9), nil)
+	defer v.Close()
+
+	assert.True(t, m.CompareAndSwapAt(1, 1, 0, 5))
+	assert.False(t, m.CompareAndSwapAt(1, 1, 0, 6))
+	assert.False(t, m.CompareAndSwapAt(-1, 1, 0, 6))
+
+	tile, _ := m.At(1, 1)
+	assert.True(t, tile.CompareAndSwap(5, 7))
+	assert.False(t, tile.CompareAndSwap(5, 8))
+	assert.Equal(t, Value(7), tile.Value())
+
+	// Only the successful swaps are notified
+	assert.Len(t, v.Inbox, 2)
+	assert.Equal(t, Value(5), (<-v.Inbox).New.Value)
+	assert.Equal(t, Value(7), (<-v.Inbox).New.Value)
+}
+
+func TestTryMergeAt(t *testing.T) {
+	m := NewGrid(9, 9)
+	m.WriteAt(1, 1, 5)
+
+	old, new := m.MergeAt(1, 1, func(v Value) Value { return v + 1 })
+	assert.Equal(t, Value(5), old)
+	assert.Equal(t, Value(6), new)
+
+	old, new = m.MaskAt(1, 1, 0b01, 0b11)
+	assert.Equal(t, Value(6), old)
+	assert.Equal(t, Value(5), new)
+
+	// The merge is vetoed, nothing is written
+	old, new, ok := m.TryMergeAt(1, 1, func(v Value) (Value, bool) { return 9, v == 0 })
+	assert.False(t, ok)
+	assert.Equal(t, Value(5), old)
+	assert.Equal(t, Value(5), new)
+
+	tile, _ := m.At(1, 1)
+	old, new, ok = tile.TryMerge(func(v Value) (Value, bool) { return v * 2, v == 5 })
+	assert.True(t, ok)
+	assert.Equal(t, Value(5), old)
+	assert.Equal(t, Value(10), new)
+
+	// Outside of the grid
+	_, _, ok = m.TryMergeAt(9, 1, func(v Value) (Value, bool) { return 9, true })
+	assert.False(t, ok)
+	old, new = m.MergeAt(9, 1, func(v Value) Value { return 9 })
+	assert.Zero(t, old)
+	assert.Zero(t, new)
+}
+
+func TestConcurrentClaim(t *testing.T) {
+	const count = 1000
+	var wg sync.WaitGroup
+	var claimed atomic.Int32
+	wg.Add(count)
+
+	m := NewGrid(9, 9)
+	for i := 0; i < count; i++ {
+		go func(owner Value) {
+			defer wg.Done()
+			if m.CompareAndSwapAt(1, 1, 0, owner) {
+				claimed.Add(1)
+			}
+
+			if _, _, ok := m.TryMergeAt(2, 2, func(v Value) (Value, bool) {
+				return owner, v == 0
+			}); ok {
+				claimed.Add(1)
+			}
+		}(Value(i + 1))
+	}
+
+	wg.Wait()
+	assert.Equal(t, int32(2), claimed.Load())
+}
@@ -0,0 +1,325 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"io"
+	"iter"
+	"math"
+)
+
+// HexGrid represents a grid of pointy-top hexagons, stored in the same pages as the
+// square grid. The tiles are addressed by their offset coordinates, where the odd rows
+// are shifted by half a tile to the right, and the Hex type can be used to convert them
+// to and from axial coordinates. The tile operations of the grid are available, while
+// the neighbors, the searches and the paths follow the six hexagonal directions.
+type HexGrid[T comparable] struct {
+	grid *Grid[T] // The pages of the map
+	Size Point    // The map size
+}
+
+// NewHexGrid returns a new hexagonal map of the specified size. The width and height
+// must be both multiples of 3.
+func NewHexGrid(width, height int16) *HexGrid[string] {
+	return NewHexGridOf[string](width, height)
+}
+
+// NewHexGridOf returns a new hexagonal map of the specified size. The width and height
+// must be both multiples of 3.
+func NewHexGridOf[T comparable](width, height int16) *HexGrid[T] {
+	grid := NewGridOf[T](width, height)
+	return &HexGrid[T]{
+		grid: grid,
+		Size: grid.Size,
+	}
+}
+
+// tiles returns the grid which stores the tiles, so that the views and the observers
+// can be attached to the hexagonal map.
+func (m *HexGrid[T]) tiles() *Grid[T] {
+	return m.grid
+}
+
+// At returns the tile at a specified position
+func (m *HexGrid[T]) At(x, y int16) (Tile[T], bool) {
+	return m.grid.At(x, y)
+}
+
+// WriteAt updates the entire tile value at a specific coordinate
+func (m *HexGrid[T]) WriteAt(x, y int16, tile Value) {
+	m.grid.WriteAt(x, y, tile)
+}
+
+// SwapAt updates the entire tile value at a specific coordinate and returns its
+// previous value, or zero if the tile is outside of the grid.
+func (m *HexGrid[T]) SwapAt(x, y int16, tile Value) Value {
+	return m.grid.SwapAt(x, y, tile)
+}
+
+// CompareAndSwapAt updates the entire tile value at a specific coordinate, only if it
+// still has the old value, and returns whether the tile was updated.
+func (m *HexGrid[T]) CompareAndSwapAt(x, y int16, old, new Value) bool {
+	return m.grid.CompareAndSwapAt(x, y, old, new)
+}
+
+// MaskAt atomically updates the bits of tile at a specific coordinate. The bits are
+// specified by the mask. It returns the value of the tile before and after the update.
+func (m *HexGrid[T]) MaskAt(x, y int16, tile, mask Value) (old, new Value) {
+	return m.grid.MaskAt(x, y, tile, mask)
+}
+
+// MergeAt atomically merges the tile by applying a merging function at a specific
+// coordinate. It returns the value of the tile before and after the merge.
+func (m *HexGrid[T]) MergeAt(x, y int16, merge func(Value) Value) (old, new Value) {
+	return m.grid.MergeAt(x, y, merge)
+}
+
+// TryMergeAt atomically merges the tile by applying a merging function at a specific
+// coordinate, which can veto the update by returning false.
+func (m *HexGrid[T]) TryMergeAt(x, y int16, merge func(Value) (Value, bool)) (old, new Value, ok bool) {
+	return m.grid.TryMergeAt(x, y, merge)
+}
+
+// Batch applies several changes to the tiles atomically, as for the square grid.
+func (m *HexGrid[T]) Batch(fn func(tx *Tx[T]) error) error {
+	return m.grid.Batch(fn)
+}
+
+// Each iterates over all of the tiles in the map.
+func (m *HexGrid[T]) Each(fn func(Point, Tile[T])) {
+	m.grid.Each(fn)
+}
+
+// Within selects the tiles within a specifid bounding box of offset coordinates.
+func (m *HexGrid[T]) Within(nw, se Point, fn func(Point, Tile[T])) {
+	m.grid.Within(nw, se, fn)
+}
+
+// All returns an iterator over all of the tiles in the map.
+func (m *HexGrid[T]) All() iter.Seq2[Point, Tile[T]] {
+	return m.grid.All()
+}
+
+// InRect returns an iterator over the tiles within a rectangle of offset coordinates.
+func (m *HexGrid[T]) InRect(r Rect) iter.Seq2[Point, Tile[T]] {
+	return m.grid.InRect(r)
+}
+
+// WriteTo writes the map to a specific writer, in the same format as the square grid.
+func (m *HexGrid[T]) WriteTo(dst io.Writer) (int64, error) {
+	return m.grid.WriteTo(dst)
+}
+
+// WriteFile writes the map into a flate-compressed binary file.
+func (m *HexGrid[T]) WriteFile(filename string) error {
+	return m.grid.WriteFile(filename)
+}
+
+// Neighbors iterates over the six neighbouring tiles of a hexagon.
+func (m *HexGrid[T]) Neighbors(x, y int16, fn func(Point, Tile[T])) {
+	for p, tile := range m.NeighborsOf(At(x, y)) {
+		fn(p, tile)
+	}
+}
+
+// NeighborsOf returns an iterator over the six neighbouring tiles of a hexagon.
+func (m *HexGrid[T]) NeighborsOf(p Point) iter.Seq2[Point, Tile[T]] {
+	return func(yield func(Point, Tile[T]) bool) {
+		for dir := HexEast; dir <= HexSouthEast; dir++ {
+			next := p.MoveHex(dir)
+			if next.WithinSize(m.Size) && !yield(next, m.grid.pageAt(next.X/3, next.Y/3).At(m.grid, next.X, next.Y)) {
+				return
+			}
+		}
+	}
+}
+
+// Around performs a breadth first search around a hexagon, visiting the tiles which
+// are within a hexagonal distance.
+func (m *HexGrid[T]) Around(from Point, distance uint32, costOf costFn, fn func(Point, Tile[T])) {
+	m.around(from, distance, costOf, func(p Point, t Tile[T]) bool {
+		fn(p, t)
+		return true
+	})
+}
+
+// Reachable returns an iterator over the tiles that are reachable from a hexagon within
+// a specified distance, in breadth first order. It is the iterator of Around().
+func (m *HexGrid[T]) Reachable(from Point, distance uint32, costOf costFn) iter.Seq2[Point, Tile[T]] {
+	return func(yield func(Point, Tile[T]) bool) {
+		m.around(from, distance, costOf, yield)
+	}
+}
+
+// around performs a breadth first search around a hexagon, until the yield function
+// returns false.
+func (m *HexGrid[T]) around(from Point, distance uint32, costOf costFn, yield func(Point, Tile[T]) bool) {
+	start, ok := m.At(from.X, from.Y)
+	if !ok || !yield(from, start) {
+		return
+	}
+
+	// A hexagonal ring of radius r has 6r tiles, so the area is at most 3r(r+1)+1
+	maxArea := int(math.Min(3*float64(distance)*float64(distance+1)+1, float64(m.Size.X)*float64(m.Size.Y)))
+
+	// Acquire a frontier heap for search
+	state := acquire(maxArea)
+	frontier := state.frontier
+	reached := state.edges
+	defer release(state)
+
+	frontier.Push(from.Integer(), 0)
+	reached.Store(from.Integer(), 0)
+	for !frontier.IsEmpty() {
+		current := unpackPoint(frontier.Pop())
+		for next, nextTile := range m.NeighborsOf(current) {
+			if d := HexDistance(from, next); d > distance {
+				continue // Too far
+			}
+
+			if cost := costOf(nextTile.Value()); cost == 0 {
+				continue // Blocked tile, ignore completely
+			}
+
+			// Add to the search queue
+			pNext := next.Integer()
+			if _, ok := reached.Load(pNext); !ok {
+				frontier.Push(pNext, 1)
+				reached.Store(pNext, 1)
+				if !yield(next, nextTile) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Path calculates a short path and the distance between the two hexagons, moving in
+// the six hexagonal directions where each move costs the cost of the tile entered.
+func (m *HexGrid[T]) Path(from, to Point, costOf costFn) ([]Point, int, bool) {
+	return m.grid.search(from, to, func(at Point, dst []edge) []edge {
+		for next, nextTile := range m.NeighborsOf(at) {
+			if cost := costOf(nextTile.Value()); cost > 0 {
+				dst = append(dst, edge{Point: next, Cost: uint32(cost)})
+			}
+		}
+		return dst
+	}, &PathOptions{Heuristic: HexDistance})
+}
+
+// HexDistance returns the number of hexagonal moves between two tiles given in offset
+// coordinates. It is the heuristic of the hexagonal search.
+func HexDistance(from, to Point) uint32 {
+	return HexOf(from).DistanceTo(HexOf(to))
+}
+
+// -----------------------------------------------------------------------------
+
+// Hex represents the axial coordinates of a pointy-top hexagon, where the third cube
+// coordinate is implied as s = -q-r.
+type Hex struct {
+	Q int16 // Q coordinate, along the rows
+	R int16 // R coordinate, which is the row
+}
+
+// HexOf converts the offset coordinates of a tile of a hexagonal grid to the axial
+// coordinates of the hexagon.
+func HexOf(p Point) Hex {
+	return Hex{
+		Q: p.X - (p.Y-(p.Y&1))/2,
+		R: p.Y,
+	}
+}
+
+// Point converts the axial coordinates of a hexagon to the offset coordinates of the
+// tile of a hexagonal grid.
+func (h Hex) Point() Point {
+	return Point{
+		X: h.Q + (h.R-(h.R&1))/2,
+		Y: h.R,
+	}
+}
+
+// Move moves a hexagon by one in the specified direction.
+func (h Hex) Move(direction HexDirection) Hex {
+	switch direction {
+	case HexEast:
+		return Hex{h.Q + 1, h.R}
+	case HexNorthEast:
+		return Hex{h.Q + 1, h.R - 1}
+	case HexNorthWest:
+		return Hex{h.Q, h.R - 1}
+	case HexWest:
+		return Hex{h.Q - 1, h.R}
+	case HexSouthWest:
+		return Hex{h.Q - 1, h.R + 1}
+	case HexSouthEast:
+		return Hex{h.Q, h.R + 1}
+	default:
+		return h
+	}
+}
+
+// DistanceTo calculates the number of moves to the other hexagon
+func (h Hex) DistanceTo(other Hex) uint32 {
+	dq := int32(h.Q) - int32(other.Q)
+	dr := int32(h.R) - int32(other.R)
+	return (abs(dq) + abs(dr) + abs(dq+dr)) / 2
+}
+
+// MoveHex moves the offset coordinates of a hexagon by one in the specified direction.
+func (p Point) MoveHex(direction HexDirection) Point {
+	if direction > HexSouthEast {
+		return p
+	}
+
+	delta := hexOffsets[p.Y&1][direction]
+	return Point{p.X + delta.X, p.Y + delta.Y}
+}
+
+// hexOffsets are the offsets of the neighbors in the even and odd rows
+var hexOffsets = [2][6]Point{
+	{{1, 0}, {0, -1}, {-1, -1}, {-1, 0}, {-1, 1}, {0, 1}}, // Even rows
+	{{1, 0}, {1, -1}, {0, -1}, {-1, 0}, {0, 1}, {1, 1}},   // Odd rows
+}
+
+// -----------------------------------------------------------------------------
+
+// HexDirection represents a direction of a pointy-top hexagon
+type HexDirection byte
+
+// Various hexagonal directions
+const (
+	HexEast HexDirection = iota
+	HexNorthEast
+	HexNorthWest
+	HexWest
+	HexSouthWest
+	HexSouthEast
+)
+
+// String returns a string representation of a hexagonal direction
+func (v HexDirection) String() string {
+	switch v {
+	case HexEast:
+		return "🡲E"
+	case HexNorthEast:
+		return "🡵NE"
+	case HexNorthWest:
+		return "🡴NW"
+	case HexWest:
+		return "🡰W"
+	case HexSouthWest:
+		return "🡷SW"
+	case HexSouthEast:
+		return "🡶SE"
+	default:
+		return ""
+	}
+}
+
+// Opposite returns the opposite hexagonal direction
+func (v HexDirection) Opposite() HexDirection {
+	return (v + 3) % 6
+}
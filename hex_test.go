@@ -0,0 +1,197 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+cpu: Intel(R) Xeon(R) Processor
+BenchmarkHex/neighbors      	17508292	        77.43 ns/op	       0 B/op	       0 allocs/op
+BenchmarkHex/around         	   54078	     20570 ns/op	       0 B/op	       0 allocs/op
+BenchmarkHex/path           	    4026	    314591 ns/op	    3904 B/op	       5 allocs/op
+*/
+func BenchmarkHex(b *testing.B) {
+	var d Tile[string]
+	var p Point
+	defer assert.NotNil(b, d)
+	m := NewHexGrid(300, 300)
+	for i := 0; i < 300; i++ {
+		m.WriteAt(int16(rand(i)), int16(rand(i*7+1)), Value(1))
+	}
+
+	b.Run("neighbors", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			m.Neighbors(101, 101, func(point Point, tile Tile[string]) {
+				p = point
+				d = tile
+			})
+		}
+	})
+
+	b.Run("around", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			m.Around(At(100, 100), 5, costOf, func(point Point, tile Tile[string]) {
+				p = point
+				d = tile
+			})
+		}
+	})
+
+	b.Run("path", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			m.Path(At(10, 10), At(200, 150), costOf)
+		}
+	})
+
+	assert.NotNil(b, p)
+}
+
+func TestHexOf(t *testing.T) {
+	tests := []struct {
+		point Point
+		hex   Hex
+	}{
+		{point: At(0, 0), hex: Hex{0, 0}},
+		{point: At(3, 0), hex: Hex{3, 0}},
+		{point: At(3, 1), hex: Hex{3, 1}},
+		{point: At(3, 2), hex: Hex{2, 2}},
+		{point: At(3, 3), hex: Hex{2, 3}},
+		{point: At(0, -1), hex: Hex{1, -1}},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.hex, HexOf(tc.point))
+		assert.Equal(t, tc.point, tc.hex.Point())
+	}
+}
+
+func TestHexMove(t *testing.T) {
+	for _, at := range []Point{At(4, 4), At(4, 5)} {
+		for dir := HexEast; dir <= HexSouthEast; dir++ {
+			next := at.MoveHex(dir)
+			assert.Equal(t, HexOf(at).Move(dir), HexOf(next), dir.String())
+			assert.Equal(t, at, next.MoveHex(dir.Opposite()))
+			assert.Equal(t, uint32(1), HexDistance(at, next))
+		}
+	}
+
+	assert.Equal(t, At(4, 4), At(4, 4).MoveHex(HexDirection(6)))
+	assert.Equal(t, Hex{4, 4}, Hex{4, 4}.Move(HexDirection(6)))
+	assert.Equal(t, "", HexDirection(6).String())
+}
+
+func TestHexDistance(t *testing.T) {
+	assert.Equal(t, uint32(0), HexDistance(At(2, 2), At(2, 2)))
+	assert.Equal(t, uint32(3), HexDistance(At(0, 0), At(3, 0)))
+	assert.Equal(t, uint32(3), HexDistance(At(0, 0), At(1, 3)))
+	assert.Equal(t, uint32(4), HexDistance(At(0, 0), At(2, 3)))
+	assert.Equal(t, uint32(4), HexDistance(At(0, 0), At(0, 4)))
+	assert.Equal(t, uint32(7), HexDistance(At(5, 4), At(0, 0)))
+}
+
+func TestHexNeighbors(t *testing.T) {
+	tests := []struct {
+		x, y   int16
+		expect []Point
+	}{
+		{x: 4, y: 4, expect: []Point{At(5, 4), At(4, 3), At(3, 3), At(3, 4), At(3, 5), At(4, 5)}},
+		{x: 4, y: 5, expect: []Point{At(5, 5), At(5, 4), At(4, 4), At(3, 5), At(4, 6), At(5, 6)}},
+		{x: 0, y: 0, expect: []Point{At(1, 0), At(0, 1)}},
+		{x: 8, y: 8, expect: []Point{At(8, 7), At(7, 7), At(7, 8)}},
+		{x: 8, y: 7, expect: []Point{At(8, 6), At(7, 7), At(8, 8)}},
+	}
+
+	m := NewHexGrid(9, 9)
+	for _, tc := range tests {
+		var out []Point
+		m.Neighbors(tc.x, tc.y, func(p Point, _ Tile[string]) {
+			out = append(out, p)
+		})
+		assert.Equal(t, tc.expect, out)
+	}
+}
+
+func TestHexAround(t *testing.T) {
+	m := NewHexGrid(9, 9)
+	var out []Point
+	m.Around(At(4, 4), 1, costOf, func(p Point, _ Tile[string]) {
+		out = append(out, p)
+	})
+	assert.Len(t, out, 7)
+
+	// A ring of radius 2 has 12 more tiles, unless some of them are blocked
+	m.WriteAt(6, 4, Value(1))
+	count := 0
+	for p := range m.Reachable(At(4, 4), 2, costOf) {
+		assert.LessOrEqual(t, HexDistance(At(4, 4), p), uint32(2))
+		count++
+	}
+	assert.Equal(t, 18, count)
+}
+
+func TestHexPath(t *testing.T) {
+	m := NewHexGrid(9, 9)
+	path, dist, found := m.Path(At(0, 0), At(0, 4), costOf)
+	assert.True(t, found)
+	assert.Equal(t, 4, dist)
+	assert.Len(t, path, 5)
+	for i := 1; i < len(path); i++ {
+		assert.Equal(t, uint32(1), HexDistance(path[i-1], path[i]))
+	}
+
+	// A wall which leaves a single gap on its right
+	for x := int16(0); x < 8; x++ {
+		m.WriteAt(x, 4, Value(1))
+	}
+
+	path, dist, found = m.Path(At(1, 2), At(1, 6), costOf)
+	assert.True(t, found)
+	assert.Equal(t, 16, dist)
+	assert.Equal(t, `
+         
+         
+ x       
+ xxxxxxx 
+........x
+       x 
+ xxxxxxx 
+         
+         `, plotPath(m.grid, path))
+
+	// Unreachable destination
+	m.WriteAt(8, 4, Value(1))
+	_, _, found = m.Path(At(1, 2), At(1, 6), costOf)
+	assert.False(t, found)
+}
+
+func TestHexView(t *testing.T) {
+	m := NewHexGrid(9, 9)
+	v := NewView(m, "view 1")
+	defer v.Close()
+	v.Resize(NewRect(0, 0, 3, 3), nil)
+
+	// The views observe the tiles of the hexagonal map
+	m.WriteAt(1, 1, 5)
+	m.CompareAndSwapAt(1, 1, 5, 6)
+	assert.Equal(t, Value(5), (<-v.Inbox).New.Value)
+	assert.Equal(t, Value(6), (<-v.Inbox).New.Value)
+
+	tile, ok := m.At(1, 1)
+	assert.True(t, ok)
+	assert.Equal(t, Value(6), tile.Value())
+
+	// The tiles outside of the viewport are not observed
+	m.WriteAt(5, 5, 1)
+	assert.Len(t, v.Inbox, 0)
+}
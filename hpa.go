@@ -0,0 +1,562 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/kelindar/intmap"
+)
+
+var _ Observer[string] = (*Hierarchy[string])(nil)
+
+// Hierarchy represents a hierarchical pathfinding (HPA*) graph over a grid. The grid
+// is split into clusters of pages, with entrances along the borders between them and
+// cached distances between the entrances of each cluster. Long paths are found on
+// this abstract graph first and then refined within each of the clusters.
+//
+// The hierarchy observes the entire grid, so when a tile changes only its cluster is
+// invalidated and recomputed lazily, the next time it is needed by a query. Queries
+// are safe to use concurrently but are serialized.
+type Hierarchy[T comparable] struct {
+	mu       sync.Mutex
+	grid     *Grid[T]    // The associated map
+	costOf   costFn      // The cost function of the tiles
+	size     int16       // The size of a cluster, in tiles
+	width    int16       // The number of clusters horizontally
+	height   int16       // The number of clusters vertically
+	clusters []cluster   // The clusters of the map
+	stale    atomic.Bool // Whether any of the clusters is dirty
+	costs    *intmap.Map // The costs of the abstract search
+	parents  *intmap.Map // The parents of the abstract search
+	queue    *frontier   // The frontier of the abstract search
+	open     *frontier   // The frontier of the local search
+	local    []uint32    // The costs of the local search
+	dirs     []Direction // The directions of the local search
+}
+
+// cluster represents a block of pages along with its entrances
+type cluster struct {
+	bounds Rect        // The bounds of the cluster
+	dirty  atomic.Bool // Whether some of the tiles have changed
+	ready  bool        // Whether the nodes and edges are up to date
+	east   border      // The entrances towards the east neighbor
+	south  border      // The entrances towards the south neighbor
+	nodes  []Point     // The entrances of the cluster
+	edges  [][]edge    // The distances from each of the entrances to the others
+}
+
+// border represents the entrances along a border between two clusters
+type border struct {
+	ready bool   // Whether the entrances are up to date
+	links []link // The entrances of the border
+}
+
+// link represents a pair of adjacent tiles on each side of a border
+type link struct {
+	inner Point // The tile within the cluster
+	outer Point // The tile within the neighbor
+}
+
+// NewHierarchy creates a new hierarchical pathfinding graph for a grid, with clusters
+// of the specified number of pages on each side. The hierarchy subscribes to all of
+// the pages of the grid, so it must be closed once it is no longer needed.
+func NewHierarchy[T comparable](m *Grid[T], size int16, costOf costFn) *Hierarchy[T] {
+	size = max(size, 1) * 3
+	h := &Hierarchy[T]{
+		grid:    m,
+		costOf:  costOf,
+		size:    size,
+		costs:   intmap.NewWithFill(64, .99),
+		parents: intmap.NewWithFill(64, .99),
+		queue:   newFrontier(),
+		open:    newFrontier(),
+		local:   make([]uint32, int(size)*int(size)),
+		dirs:    make([]Direction, int(size)*int(size)),
+	}
+
+	h.clusters = h.split(m.Size)
+
+	// Observe the entire map, so that the clusters can be invalidated
+	if m.observers.SubscribeAll(h) {
+		for i := range m.pages {
+			m.pages[i].SetObserved(true)
+		}
+	}
+	return h
+}
+
+// Viewport returns the viewport of the hierarchy, which is the entire grid.
+func (h *Hierarchy[T]) Viewport() Rect {
+	return Rect{Max: h.grid.Size}
+}
+
+// Resize does nothing, since the hierarchy always observes the entire grid.
+func (h *Hierarchy[T]) Resize(Rect, func(Point, Tile[T])) {}
+
+// split splits a map of a given size into clusters, which are all to be built.
+func (h *Hierarchy[T]) split(size Point) []cluster {
+	h.width = (size.X + h.size - 1) / h.size
+	h.height = (size.Y + h.size - 1) / h.size
+	clusters := make([]cluster, int(h.width)*int(h.height))
+	for i := range clusters {
+		x, y := int16(i%int(h.width))*h.size, int16(i/int(h.width))*h.size
+		clusters[i].bounds = NewRect(x, y, min(x+h.size, size.X), min(y+h.size, size.Y))
+	}
+	return clusters
+}
+
+// onResize occurs when the grid was resized, and splits it into clusters again, which
+// are then built lazily by the next query.
+func (h *Hierarchy[T]) onResize(Point, Point) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clusters = h.split(h.grid.Size)
+}
+
+// Close unsubscribes the hierarchy from the grid.
+func (h *Hierarchy[T]) Close() error {
+	m := h.grid
+	if !m.observers.UnsubscribeAll(h) {
+		return nil // Still observed by others
+	}
+
+	// Only keep the pages which are still in some of the views
+	for i := range m.pages {
+		if !m.observers.Observed(m.pages[i].point) {
+			m.pages[i].SetObserved(false)
+		}
+	}
+	return nil
+}
+
+// onUpdate occurs when a tile has updated, and invalidates its cluster if the cost
+// of the tile has changed.
+func (h *Hierarchy[T]) onUpdate(ev *Update[T]) {
+	if !ev.Old.Point.Equal(ev.New.Point) || h.costOf(ev.Old.Value) == h.costOf(ev.New.Value) {
+		return // Objects were moved or the cost is the same
+	}
+
+	h.clusters[h.clusterOf(ev.New.Point)].dirty.Store(true)
+	h.stale.Store(true)
+}
+
+// Path calculates a path and the distance between the two locations, using the
+// abstract graph of the clusters. The path is not necessarily the shortest one,
+// but it is typically within a few percent of it and is found much faster than
+// with Path() over long distances.
+func (h *Hierarchy[T]) Path(from, to Point) ([]Point, int, bool) {
+	if !h.walkable(from) || !h.walkable(to) {
+		return nil, 0, false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.invalidate()
+
+	// Connect the start and the goal to the entrances of their clusters
+	start := h.connect(from, to)
+	goal := h.connect(to, from)
+	for i := range goal {
+		goal[i].Cost = goal[i].Cost - h.costAt(goal[i].Point) + h.costAt(to)
+	}
+
+	// Find the path in the abstract graph, then refine each of its hops
+	hops, dist, ok := h.search(from, to, start, goal)
+	if !ok {
+		return nil, 0, false
+	}
+
+	path := make([]Point, 0, 64)
+	path = append(path, from)
+	for i := 1; i < len(hops); i++ {
+		a, b := hops[i-1], hops[i]
+		if h.clusterOf(a) != h.clusterOf(b) {
+			path = append(path, b)
+			continue // Crossing the border
+		}
+
+		c := &h.clusters[h.clusterOf(a)]
+		h.flood(c.bounds, a, b)
+		path = h.trace(path, c.bounds, a, b)
+	}
+
+	return path, int(dist), true
+}
+
+// search performs an A* search over the abstract graph, given the edges from the
+// start and the edges towards the goal.
+func (h *Hierarchy[T]) search(from, to Point, start, goal []edge) ([]Point, uint32, bool) {
+	costs, parents, frontier := h.costs, h.parents, h.queue
+	if costs.Count() > 0 {
+		costs.Clear()
+		parents.Clear()
+	}
+	frontier.Reset()
+	defer frontier.Reset()
+
+	frontier.Push(from.Integer(), 0)
+	costs.Store(from.Integer(), encode(0, 0))
+
+	target := h.clusterOf(to)
+	for !frontier.IsEmpty() {
+		pCurr := frontier.Pop()
+		current := unpackPoint(pCurr)
+		currentEncoded, _ := costs.Load(pCurr)
+		currentCost, flags := decode(currentEncoded)
+		switch {
+		case flags&settled != 0:
+			continue // Already expanded with a lower cost
+		case current.Equal(to):
+			return h.hops(from, to), currentCost, true
+		}
+
+		// Mark the node as settled, since its cost can no longer decrease
+		costs.Store(pCurr, encode(currentCost, settled))
+
+		// Intra-cluster edges, from the start or between the entrances
+		c := h.clusterOf(current)
+		edges := start
+		if !current.Equal(from) {
+			edges = h.edgesOf(c, current)
+		}
+		for _, e := range edges {
+			h.relax(pCurr, currentCost, e.Point, e.Cost, to)
+		}
+
+		// Inter-cluster edges, across the borders
+		h.linksOf(c, current, func(next Point) {
+			h.relax(pCurr, currentCost, next, h.costAt(next), to)
+		})
+
+		// Edges towards the goal, from the entrances of its cluster
+		if c == target {
+			for _, e := range goal {
+				if e.Point.Equal(current) {
+					h.relax(pCurr, currentCost, to, e.Cost, to)
+				}
+			}
+		}
+	}
+
+	return nil, 0, false
+}
+
+// relax updates the cost of a node in the abstract search, if it was improved
+func (h *Hierarchy[T]) relax(pCurr, currentCost uint32, next Point, cost uint32, to Point) {
+	pNext := next.Integer()
+	nextCost := currentCost + cost
+	existingEncoded, visited := h.costs.Load(pNext)
+	if existing, flags := decode(existingEncoded); !visited || (flags&settled == 0 && nextCost < existing) {
+		h.costs.Store(pNext, encode(nextCost, 0))
+		h.parents.Store(pNext, pCurr)
+		h.queue.Push(pNext, nextCost+next.DistanceTo(to))
+	}
+}
+
+// hops reconstructs the path through the abstract graph
+func (h *Hierarchy[T]) hops(from, to Point) []Point {
+	hops := make([]Point, 0, 16)
+	for current := to; ; {
+		hops = append(hops, current)
+		if current.Equal(from) {
+			break
+		}
+
+		parent, _ := h.parents.Load(current.Integer())
+		current = unpackPoint(parent)
+	}
+
+	// Reverse the hops to get from source to destination
+	for i, j := 0, len(hops)-1; i < j; i, j = i+1, j-1 {
+		hops[i], hops[j] = hops[j], hops[i]
+	}
+	return hops
+}
+
+// connect returns the distances from a point to the entrances of its cluster, and
+// to the other point if it is located within the same cluster.
+func (h *Hierarchy[T]) connect(from, other Point) []edge {
+	c := h.cluster(h.clusterOf(from))
+	h.flood(c.bounds, from, At(-1, -1))
+
+	out := make([]edge, 0, len(c.nodes)+1)
+	for _, node := range c.nodes {
+		if cost := h.local[h.indexOf(c.bounds, node)]; cost != math.MaxUint32 {
+			out = append(out, edge{Point: node, Cost: cost})
+		}
+	}
+
+	// The other point might be reachable directly, without leaving the cluster
+	if c.bounds.Contains(other) {
+		if cost := h.local[h.indexOf(c.bounds, other)]; cost != math.MaxUint32 {
+			out = append(out, edge{Point: other, Cost: cost})
+		}
+	}
+	return out
+}
+
+// edgesOf returns the cached distances from an entrance to the other entrances
+// of its cluster.
+func (h *Hierarchy[T]) edgesOf(idx int, at Point) []edge {
+	c := h.cluster(idx)
+	for i, node := range c.nodes {
+		if node.Equal(at) {
+			return c.edges[i]
+		}
+	}
+	return nil
+}
+
+// linksOf iterates over the tiles across the borders which are linked to an entrance
+func (h *Hierarchy[T]) linksOf(idx int, at Point, fn func(Point)) {
+	x, y := idx%int(h.width), idx/int(h.width)
+	for _, l := range h.border(idx, false).links {
+		if l.inner.Equal(at) {
+			fn(l.outer)
+		}
+	}
+	for _, l := range h.border(idx, true).links {
+		if l.inner.Equal(at) {
+			fn(l.outer)
+		}
+	}
+	if x > 0 {
+		for _, l := range h.border(idx-1, false).links {
+			if l.outer.Equal(at) {
+				fn(l.inner)
+			}
+		}
+	}
+	if y > 0 {
+		for _, l := range h.border(idx-int(h.width), true).links {
+			if l.outer.Equal(at) {
+				fn(l.inner)
+			}
+		}
+	}
+}
+
+// ---------------------------------- Clusters ----------------------------------
+
+// invalidate invalidates the clusters whose tiles have changed, along with the
+// borders around them and their neighbors, which share these borders.
+func (h *Hierarchy[T]) invalidate() {
+	if !h.stale.Swap(false) {
+		return
+	}
+
+	for i := range h.clusters {
+		if !h.clusters[i].dirty.Swap(false) {
+			continue
+		}
+
+		x, y := i%int(h.width), i/int(h.width)
+		h.clusters[i].ready = false
+		h.clusters[i].east.ready = false
+		h.clusters[i].south.ready = false
+		if x > 0 {
+			h.clusters[i-1].ready = false
+			h.clusters[i-1].east.ready = false
+		}
+		if y > 0 {
+			h.clusters[i-int(h.width)].ready = false
+			h.clusters[i-int(h.width)].south.ready = false
+		}
+		if x < int(h.width)-1 {
+			h.clusters[i+1].ready = false
+		}
+		if y < int(h.height)-1 {
+			h.clusters[i+int(h.width)].ready = false
+		}
+	}
+}
+
+// cluster returns a cluster, rebuilding its entrances and edges if necessary
+func (h *Hierarchy[T]) cluster(idx int) *cluster {
+	c := &h.clusters[idx]
+	if c.ready {
+		return c
+	}
+
+	// Collect the entrances along all of the borders of the cluster
+	x, y := idx%int(h.width), idx/int(h.width)
+	c.nodes = c.nodes[:0]
+	for _, l := range h.border(idx, false).links {
+		c.nodes = appendNode(c.nodes, l.inner)
+	}
+	for _, l := range h.border(idx, true).links {
+		c.nodes = appendNode(c.nodes, l.inner)
+	}
+	if x > 0 {
+		for _, l := range h.border(idx-1, false).links {
+			c.nodes = appendNode(c.nodes, l.outer)
+		}
+	}
+	if y > 0 {
+		for _, l := range h.border(idx-int(h.width), true).links {
+			c.nodes = appendNode(c.nodes, l.outer)
+		}
+	}
+
+	// Compute the distances between each pair of entrances
+	c.edges = c.edges[:0]
+	for _, from := range c.nodes {
+		h.flood(c.bounds, from, At(-1, -1))
+		edges := make([]edge, 0, len(c.nodes))
+		for _, to := range c.nodes {
+			if cost := h.local[h.indexOf(c.bounds, to)]; !to.Equal(from) && cost != math.MaxUint32 {
+				edges = append(edges, edge{Point: to, Cost: cost})
+			}
+		}
+		c.edges = append(c.edges, edges)
+	}
+
+	c.ready = true
+	return c
+}
+
+// border returns the east or the south border of a cluster, finding its entrances if
+// necessary. Each maximal run of passable tiles on both sides of the border gets an
+// entrance in its middle, or two entrances at its ends if the run is long.
+func (h *Hierarchy[T]) border(idx int, south bool) *border {
+	c := &h.clusters[idx]
+	b, step, side := &c.east, At(0, 1), At(1, 0)
+	at := At(c.bounds.Max.X-1, c.bounds.Min.Y)
+	length := c.bounds.Max.Y - c.bounds.Min.Y
+	if south {
+		b, step, side = &c.south, At(1, 0), At(0, 1)
+		at = At(c.bounds.Min.X, c.bounds.Max.Y-1)
+		length = c.bounds.Max.X - c.bounds.Min.X
+	}
+
+	if b.ready {
+		return b
+	}
+
+	b.ready = true
+	b.links = b.links[:0]
+	if !at.Add(side).WithinSize(h.grid.Size) {
+		return b // No neighbor on this side
+	}
+
+	const long = 6
+	run := int16(0)
+	for i := int16(0); i <= length; i++ {
+		inner := at.Add(step.MultiplyScalar(i))
+		if i < length && h.walkable(inner) && h.walkable(inner.Add(side)) {
+			run++
+			continue
+		}
+
+		// The run has ended, add its entrances
+		switch {
+		case run == 0:
+		case run < long:
+			mid := inner.Subtract(step.MultiplyScalar(run - run/2))
+			b.links = append(b.links, link{inner: mid, outer: mid.Add(side)})
+		default:
+			first := inner.Subtract(step.MultiplyScalar(run))
+			last := inner.Subtract(step)
+			b.links = append(b.links,
+				link{inner: first, outer: first.Add(side)},
+				link{inner: last, outer: last.Add(side)},
+			)
+		}
+		run = 0
+	}
+	return b
+}
+
+// ---------------------------------- Local Search ----------------------------------
+
+// flood performs a Dijkstra search from a point which is restricted to the bounds
+// of a cluster, until the target is reached. The resulting costs and directions are
+// kept in the local buffers of the hierarchy.
+func (h *Hierarchy[T]) flood(bounds Rect, from, to Point) {
+	size := bounds.Size()
+	local := h.local[:int(size.X)*int(size.Y)]
+	for i := range local {
+		local[i] = math.MaxUint32
+	}
+
+	frontier := h.open
+	frontier.Reset()
+	defer frontier.Reset()
+
+	frontier.Push(from.Integer(), 0)
+	local[h.indexOf(bounds, from)] = 0
+	for !frontier.IsEmpty() {
+		current := unpackPoint(frontier.Pop())
+		if current.Equal(to) {
+			return
+		}
+
+		currentCost := local[h.indexOf(bounds, current)]
+		for next, nextTile := range h.grid.NeighborsOf(current) {
+			if !bounds.Contains(next) {
+				continue // Outside of the cluster
+			}
+
+			cost := h.costOf(nextTile.Value())
+			if cost == 0 {
+				continue // Blocked tile
+			}
+
+			i := h.indexOf(bounds, next)
+			if nextCost := currentCost + uint32(cost); nextCost < local[i] {
+				local[i] = nextCost
+				h.dirs[i] = angleOf(current, next)
+				frontier.Push(next.Integer(), nextCost)
+			}
+		}
+	}
+}
+
+// trace appends the path between two points of a cluster, after the local search
+func (h *Hierarchy[T]) trace(path []Point, bounds Rect, from, to Point) []Point {
+	offset := len(path)
+	for current := to; !current.Equal(from); {
+		path = append(path, current)
+		current = current.Move(oppositeDirection(h.dirs[h.indexOf(bounds, current)]))
+	}
+
+	// Reverse the appended part to get from source to destination
+	for i, j := offset, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// indexOf returns the index of a point within the local buffers
+func (h *Hierarchy[T]) indexOf(bounds Rect, p Point) int {
+	return int(p.X-bounds.Min.X) + int(p.Y-bounds.Min.Y)*int(bounds.Max.X-bounds.Min.X)
+}
+
+// clusterOf returns the index of the cluster which contains a point
+func (h *Hierarchy[T]) clusterOf(p Point) int {
+	return int(p.X/h.size) + int(p.Y/h.size)*int(h.width)
+}
+
+// walkable returns whether a point is within the grid and can be moved to
+func (h *Hierarchy[T]) walkable(p Point) bool {
+	return p.WithinSize(h.grid.Size) && h.costAt(p) != 0
+}
+
+// costAt returns the cost of a tile, which must be within the grid
+func (h *Hierarchy[T]) costAt(p Point) uint32 {
+	return uint32(h.costOf(h.grid.valueAt(p.X, p.Y)))
+}
+
+// appendNode appends a point to the set of nodes, unless it is already there
+func appendNode(nodes []Point, p Point) []Point {
+	for _, node := range nodes {
+		if node.Equal(p) {
+			return nodes
+		}
+	}
+	return append(nodes, p)
+}
@@ -0,0 +1,210 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+cpu: Intel(R) Xeon(R) Processor
+BenchmarkHierarchy/path         	      31	  36918067 ns/op	  104064 B/op	      19 allocs/op
+BenchmarkHierarchy/update       	      31	  40023618 ns/op	  104483 B/op	      31 allocs/op
+*/
+func BenchmarkHierarchy(b *testing.B) {
+	m := mapTiled("300x300.png", 10)
+	h := NewHierarchy(m, 8, costOf)
+	defer h.Close()
+
+	b.Run("path", func(b *testing.B) {
+		h.Path(At(0, 0), At(2999, 2999))
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			h.Path(At(0, 0), At(2999, 2999))
+		}
+	})
+
+	b.Run("update", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			m.WriteAt(1500, 1500, Value(n%2))
+			h.Path(At(0, 0), At(2999, 2999))
+		}
+	})
+}
+
+func TestHierarchy(t *testing.T) {
+	m := mapFrom("300x300.png")
+	h := NewHierarchy(m, 4, costOf)
+	defer h.Close()
+
+	path, dist, found := h.Path(At(115, 20), At(160, 270))
+	assert.True(t, found)
+	assertHierarchy(t, m, path, dist)
+
+	// Should be close to the shortest path
+	_, expect, _ := m.Path(At(115, 20), At(160, 270), costOf)
+	assert.GreaterOrEqual(t, dist, expect)
+	assert.LessOrEqual(t, dist, expect*12/10)
+}
+
+func TestHierarchyOptimal(t *testing.T) {
+	for _, name := range []string{"9x9.png", "300x300.png"} {
+		m := mapFrom(name)
+		h := NewHierarchy(m, 2, costOf)
+
+		// Collect all of the passable tiles
+		var open []Point
+		m.Each(func(p Point, tile Tile[string]) {
+			if costOf(tile.Value()) > 0 {
+				open = append(open, p)
+			}
+		})
+
+		for i := 0; i < 50; i++ {
+			from := open[int(rand(i*7))*len(open)/256]
+			goal := open[int(rand(i*13+1))*len(open)/256]
+
+			_, expect, ok := m.Path(from, goal, costOf)
+			path, dist, found := h.Path(from, goal)
+			assert.Equal(t, ok, found, "%v: %v -> %v", name, from, goal)
+			if found {
+				assert.GreaterOrEqual(t, dist, expect, "%v: %v -> %v", name, from, goal)
+				assert.Equal(t, from, path[0])
+				assert.Equal(t, goal, path[len(path)-1])
+				assertHierarchy(t, m, path, dist)
+			}
+		}
+		assert.NoError(t, h.Close())
+	}
+}
+
+func TestHierarchyUpdate(t *testing.T) {
+	m := NewGrid(30, 30)
+	h := NewHierarchy(m, 2, costOf)
+	defer h.Close()
+
+	// Line on an empty map, with a small detour through the entrances
+	path, dist, found := h.Path(At(0, 15), At(29, 15))
+	assert.True(t, found)
+	assert.Equal(t, 33, dist)
+	assertHierarchy(t, m, path, dist)
+
+	// Build a wall with a single gap, which only invalidates a column of clusters
+	for y := int16(0); y < 30; y++ {
+		if y != 2 {
+			m.WriteAt(14, y, Value(0xff))
+		}
+	}
+
+	dirty := 0
+	for i := range h.clusters {
+		if h.clusters[i].dirty.Load() {
+			dirty++
+		}
+	}
+	assert.Equal(t, 5, dirty)
+
+	// The path should now go through the gap
+	path, dist, found = h.Path(At(0, 15), At(29, 15))
+	assert.True(t, found)
+	assert.True(t, pointInPath(At(14, 2), path))
+	assertHierarchy(t, m, path, dist)
+
+	_, expect, _ := m.Path(At(0, 15), At(29, 15), costOf)
+	assert.GreaterOrEqual(t, dist, expect)
+	assert.LessOrEqual(t, dist, expect*12/10)
+
+	// Close the gap, making the goal unreachable
+	m.WriteAt(14, 2, Value(0xff))
+	_, _, found = h.Path(At(0, 15), At(29, 15))
+	assert.False(t, found)
+
+	// Objects do not affect the cost of the tiles
+	tile, _ := m.At(3, 3)
+	tile.Add("A")
+	assert.False(t, h.clusters[0].dirty.Load())
+}
+
+func TestHierarchyMiss(t *testing.T) {
+	m := mapFrom("9x9.png")
+	h := NewHierarchy(m, 1, costOf)
+	defer h.Close()
+
+	// Blocked destination
+	_, _, found := h.Path(At(1, 1), At(0, 0))
+	assert.False(t, found)
+
+	// Outside of the grid
+	_, _, found = h.Path(At(1, 1), At(20, 20))
+	assert.False(t, found)
+
+	// Same point
+	path, dist, found := h.Path(At(1, 1), At(1, 1))
+	assert.True(t, found)
+	assert.Equal(t, 0, dist)
+	assert.Equal(t, []Point{At(1, 1)}, path)
+}
+
+func TestHierarchyClose(t *testing.T) {
+	m := NewGrid(9, 9)
+	h := NewHierarchy(m, 1, costOf)
+	at, _ := m.At(4, 4)
+	assert.True(t, at.IsObserved())
+
+	v := NewView(m, "view 1")
+	v.Resize(NewRect(0, 0, 3, 3), nil)
+	defer v.Close()
+
+	// Pages which are still in view are observed
+	assert.NoError(t, h.Close())
+	assert.False(t, at.IsObserved())
+	at, _ = m.At(1, 1)
+	assert.True(t, at.IsObserved())
+}
+
+// assertHierarchy checks that the path is continuous, passable and of a given cost
+func assertHierarchy(t *testing.T, m *Grid[string], path []Point, dist int) {
+	cost := 0
+	for i := 1; i < len(path); i++ {
+		prev, next := path[i-1], path[i]
+		assert.Equal(t, uint32(1), prev.DistanceTo(next), "path is not continuous")
+
+		tile, ok := m.At(next.X, next.Y)
+		assert.True(t, ok)
+		assert.NotZero(t, costOf(tile.Value()), "path crosses a blocked tile")
+		cost += int(costOf(tile.Value()))
+	}
+	assert.Equal(t, dist, cost)
+}
+
+func TestHierarchySwamp(t *testing.T) {
+	m := NewGrid(18, 18)
+	for x := int16(0); x < 18; x++ {
+		for y := int16(6); y < 12; y++ {
+			m.WriteAt(x, y, Value(0x2))
+		}
+	}
+
+	h := NewHierarchy(m, 2, costOfSwamp)
+	defer h.Close()
+
+	// The swamp can not be avoided, and the goal itself is in the swamp
+	path, dist, found := h.Path(At(2, 2), At(15, 10))
+	assert.True(t, found)
+
+	cost := 0
+	for _, p := range path[1:] {
+		tile, _ := m.At(p.X, p.Y)
+		cost += int(costOfSwamp(tile.Value()))
+	}
+	assert.Equal(t, cost, dist)
+
+	_, expect, _ := m.Path(At(2, 2), At(15, 10), costOfSwamp)
+	assert.GreaterOrEqual(t, dist, expect)
+}
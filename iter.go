@@ -0,0 +1,125 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"iter"
+)
+
+// All returns an iterator over all of the tiles in the map.
+func (m *Grid[T]) All() iter.Seq2[Point, Tile[T]] {
+	return func(yield func(Point, Tile[T]) bool) {
+		until := int(m.pageHeight) * int(m.pageWidth)
+		for i := 0; i < until; i++ {
+			if !m.page(i).all(m, yield) {
+				return
+			}
+		}
+	}
+}
+
+// InRect returns an iterator over the tiles within a specified rectangle. Similarly
+// to Within(), the bottom-right corner of the rectangle is exclusive.
+func (m *Grid[T]) InRect(r Rect) iter.Seq2[Point, Tile[T]] {
+	return func(yield func(Point, Tile[T]) bool) {
+		stop := false
+		m.split(r.Min, r.Max, func(nw, se Point) {
+			if !se.WithinSize(m.Size) {
+				se = At(m.Size.X-1, m.Size.Y-1)
+			}
+
+			for x := nw.X / 3; x <= se.X/3 && !stop; x++ {
+				for y := nw.Y / 3; y <= se.Y/3 && !stop; y++ {
+					page := m.pageAt(x, y)
+					if page == nil {
+						continue
+					}
+
+					stop = !page.all(m, func(p Point, v Tile[T]) bool {
+						return !m.contains(r, p) || yield(p, v)
+					})
+				}
+			}
+		})
+	}
+}
+
+// NeighborsOf returns an iterator over the direct neighbouring tiles of a point.
+func (m *Grid[T]) NeighborsOf(p Point) iter.Seq2[Point, Tile[T]] {
+	return func(yield func(Point, Tile[T]) bool) {
+		x, y := p.X, p.Y
+		if m.wrap != (Point{}) {
+			m.wrappedNeighbors(p, yield)
+			return
+		}
+
+		if y > 0 && !yield(At(x, y-1), m.pageAt(x/3, (y-1)/3).At(m, x, y-1)) {
+			return // North
+		}
+
+		if (x+1)/3 < m.pageWidth && !yield(At(x+1, y), m.pageAt((x+1)/3, y/3).At(m, x+1, y)) {
+			return // East
+		}
+
+		if (y+1)/3 < m.pageHeight && !yield(At(x, y+1), m.pageAt(x/3, (y+1)/3).At(m, x, y+1)) {
+			return // South
+		}
+
+		if x > 0 {
+			yield(At(x-1, y), m.pageAt((x-1)/3, y/3).At(m, x-1, y)) // West
+		}
+	}
+}
+
+// wrappedNeighbors iterates over the direct neighbouring tiles of a point, across the
+// edges of a grid which wraps around.
+func (m *Grid[T]) wrappedNeighbors(p Point, yield func(Point, Tile[T]) bool) {
+	for dir := North; dir <= NorthWest; dir += 2 {
+		next := m.wrapPoint(p.Move(dir))
+		if tile, ok := m.At(next.X, next.Y); ok && next != p && !yield(next, tile) {
+			return
+		}
+	}
+}
+
+// Reachable returns an iterator over the tiles that are reachable from a point within
+// a specified distance, in breadth first order. It is the iterator of Around().
+func (m *Grid[T]) Reachable(from Point, distance uint32, costOf costFn) iter.Seq2[Point, Tile[T]] {
+	return func(yield func(Point, Tile[T]) bool) {
+		m.around(from, distance, costOf, yield)
+	}
+}
+
+// All returns an iterator over all of the tiles in the view.
+func (v *View[S, T]) All() iter.Seq2[Point, Tile[T]] {
+	return v.Grid.InRect(v.Viewport())
+}
+
+// Objects returns an iterator over all of the objects in the tile. The tile page
+// is locked during the iteration, so the tile must not be modified within the loop.
+func (t Tile[T]) Objects() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		t.data.Lock()
+		defer t.data.Unlock()
+		for v, idx := range t.data.state {
+			if idx == t.idx && !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+// all iterates over all of the tiles in the page, until the yield function returns false.
+func (p *page[T]) all(grid *Grid[T], yield func(Point, Tile[T]) bool) bool {
+	x, y := p.point.X, p.point.Y
+	return yield(Point{x, y}, Tile[T]{grid: grid, data: p, idx: 0}) && // NW
+		yield(Point{x + 1, y}, Tile[T]{grid: grid, data: p, idx: 1}) && // N
+		yield(Point{x + 2, y}, Tile[T]{grid: grid, data: p, idx: 2}) && // NE
+		yield(Point{x, y + 1}, Tile[T]{grid: grid, data: p, idx: 3}) && // W
+		yield(Point{x + 1, y + 1}, Tile[T]{grid: grid, data: p, idx: 4}) && // C
+		yield(Point{x + 2, y + 1}, Tile[T]{grid: grid, data: p, idx: 5}) && // E
+		yield(Point{x, y + 2}, Tile[T]{grid: grid, data: p, idx: 6}) && // SW
+		yield(Point{x + 1, y + 2}, Tile[T]{grid: grid, data: p, idx: 7}) && // S
+		yield(Point{x + 2, y + 2}, Tile[T]{grid: grid, data: p, idx: 8}) // SE
+}
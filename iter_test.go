@@ -0,0 +1,205 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+cpu: Intel(R) Xeon(R) Processor
+BenchmarkIter/all         	     393	   2781537 ns/op	       0 B/op	       0 allocs/op
+BenchmarkIter/rect        	   15504	     77924 ns/op	       0 B/op	       0 allocs/op
+BenchmarkIter/neighbors   	196492666	         6.463 ns/op	       0 B/op	       0 allocs/op
+*/
+func BenchmarkIter(b *testing.B) {
+	var d Tile[uint32]
+	var p Point
+	defer assert.NotNil(b, d)
+	m := NewGridOf[uint32](768, 768)
+
+	b.Run("all", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			for point, tile := range m.All() {
+				p = point
+				d = tile
+			}
+		}
+	})
+
+	b.Run("rect", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			for point, tile := range m.InRect(NewRect(100, 100, 200, 200)) {
+				p = point
+				d = tile
+			}
+		}
+	})
+
+	b.Run("neighbors", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			for point, tile := range m.NeighborsOf(At(300, 300)) {
+				p = point
+				d = tile
+			}
+		}
+	})
+
+	assert.NotZero(b, p.X)
+}
+
+func TestAll(t *testing.T) {
+	m := NewGrid(9, 9)
+
+	var expect, actual []string
+	m.Each(func(p Point, _ Tile[string]) {
+		expect = append(expect, p.String())
+	})
+
+	for p := range m.All() {
+		actual = append(actual, p.String())
+	}
+	assert.Equal(t, expect, actual)
+}
+
+func TestAllBreak(t *testing.T) {
+	m := NewGrid(9, 9)
+
+	count := 0
+	for p, tile := range m.All() {
+		count++
+		if p.Equal(At(1, 2)) {
+			assert.Equal(t, At(1, 2), tile.Point())
+			break
+		}
+	}
+	assert.Equal(t, 8, count)
+}
+
+func TestInRect(t *testing.T) {
+	m := NewGrid(9, 9)
+
+	var path []string
+	for p := range m.InRect(NewRect(7, 6, 10, 10)) {
+		path = append(path, p.String())
+	}
+	assert.ElementsMatch(t, []string{
+		"7,6", "8,6", "7,7",
+		"8,7", "7,8", "8,8",
+	}, path)
+
+	// Must match the results of Within()
+	var within []string
+	m.Within(At(1, 1), At(5, 5), func(p Point, _ Tile[string]) {
+		within = append(within, p.String())
+	})
+
+	path = path[:0]
+	for p := range m.InRect(NewRect(1, 1, 5, 5)) {
+		path = append(path, p.String())
+	}
+	assert.Equal(t, within, path)
+}
+
+func TestInRectBreak(t *testing.T) {
+	m := NewGrid(9, 9)
+
+	count := 0
+	for range m.InRect(NewRect(1, 1, 5, 5)) {
+		if count++; count == 5 {
+			break
+		}
+	}
+	assert.Equal(t, 5, count)
+}
+
+func TestNeighborsOf(t *testing.T) {
+	m := NewGrid(9, 9)
+	for _, tc := range []Point{At(0, 0), At(1, 0), At(1, 1), At(2, 2), At(8, 8)} {
+		var expect, actual []Point
+		m.Neighbors(tc.X, tc.Y, func(p Point, _ Tile[string]) {
+			expect = append(expect, p)
+		})
+
+		for p, tile := range m.NeighborsOf(tc) {
+			assert.Equal(t, p, tile.Point())
+			actual = append(actual, p)
+		}
+		assert.Equal(t, expect, actual)
+	}
+
+	// Stop after the first neighbor
+	count := 0
+	for range m.NeighborsOf(At(1, 1)) {
+		count++
+		break
+	}
+	assert.Equal(t, 1, count)
+}
+
+func TestReachable(t *testing.T) {
+	m := mapFrom("9x9.png")
+
+	var path []string
+	for p := range m.Reachable(At(2, 2), 3, costOf) {
+		path = append(path, p.String())
+	}
+	assert.ElementsMatch(t, []string{
+		"2,2", "2,1", "2,3", "1,2", "3,1",
+		"1,1", "1,3", "3,3", "4,3", "3,4",
+	}, path)
+
+	// Find the first tile which is on the same column
+	for p := range m.Reachable(At(2, 2), 3, costOf) {
+		if p.X == 2 && p.Y != 2 {
+			assert.Equal(t, int16(2), p.X)
+			break
+		}
+	}
+}
+
+func TestObjects(t *testing.T) {
+	m := NewGrid(9, 9)
+	at, _ := m.At(4, 4)
+	at.Add("A")
+	at.Add("B")
+	at.Add("C")
+
+	other, _ := m.At(3, 4)
+	other.Add("D")
+
+	var objects []string
+	for v := range at.Objects() {
+		objects = append(objects, v)
+	}
+	assert.ElementsMatch(t, []string{"A", "B", "C"}, objects)
+
+	// Break early and make sure the page is unlocked
+	for range at.Objects() {
+		break
+	}
+	assert.Equal(t, 3, at.Count())
+}
+
+func TestViewAll(t *testing.T) {
+	m := mapFrom("300x300.png")
+	v := NewView(m, "view 1")
+	v.Resize(NewRect(10, 10, 20, 20), nil)
+	defer v.Close()
+
+	count := 0
+	for p := range v.All() {
+		assert.True(t, v.Viewport().Contains(p))
+		count++
+	}
+	assert.Equal(t, 100, count)
+}
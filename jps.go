@@ -0,0 +1,443 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"math"
+
+	"github.com/kelindar/intmap"
+)
+
+// PathJPS calculates a short path and the distance between the two locations using
+// the Jump Point Search algorithm. It expands significantly fewer tiles than A* on
+// uniform-cost grids, so the cost function must return either 0 for blocked tiles
+// or the same constant for every passable tile. The search allows diagonal moves
+// without cutting corners, so the path and the distance are equivalent to the ones
+// of PathDiagonal() with DiagonalNoCorners policy.
+func (m *Grid[T]) PathJPS(from, to Point, costOf costFn) ([]Point, int, bool) {
+	search := jps[T]{grid: m, costOf: costOf, goal: to}
+	if !search.walkable(from.X, from.Y) || !search.walkable(to.X, to.Y) {
+		return nil, 0, false
+	}
+
+	// For pre-allocating, we use the perimeter of the search area since jump points
+	// are typically found along the obstacles.
+	distance := float64(from.DistanceTo(to))
+	state := acquire(int(math.Ceil(2 * math.Pi * distance)))
+	edges := state.edges
+	frontier := state.frontier
+	defer release(state)
+
+	frontier.Push(from.Integer(), 0)
+	edges.Store(from.Integer(), encode(0, Direction(0))) // Starting point has no direction
+
+	dirs := make([]Direction, 0, 8)
+	for !frontier.IsEmpty() {
+		pCurr := frontier.Pop()
+		current := unpackPoint(pCurr)
+
+		// Decode the cost to reach the current point
+		currentEncoded, _ := edges.Load(pCurr)
+		currentCost, currentDir := decode(currentEncoded)
+		if currentDir&settled != 0 {
+			continue // Already expanded with a lower cost
+		}
+
+		if current.Equal(to) {
+			return search.reconstruct(edges, from, to), int(currentCost), true
+		}
+
+		// Mark the point as settled, since the heuristic is consistent its cost can
+		// no longer decrease
+		edges.Store(pCurr, encode(currentCost, currentDir|settled))
+
+		// Once nothing blocks the shortest path towards the goal, no other path through
+		// the current point can be shorter, so its neighbors are not explored. The turn
+		// of this path is kept for the reconstruction, but it is not expanded.
+		if turn, ok := search.direct(current); ok {
+			turnCost, ok := currentCost, true
+			if !turn.Equal(current) {
+				turnCost, ok = search.relax(edges, frontier, current, currentCost, turn, turn.Equal(to))
+			}
+			if ok {
+				search.relax(edges, frontier, turn, turnCost, to, true)
+				continue
+			}
+		}
+
+		// Jump towards each of the pruned neighbors
+		for _, dir := range search.successors(current, currentDir, current.Equal(from), dirs[:0]) {
+			if next, ok := search.jump(current, dir); ok {
+				search.relax(edges, frontier, current, currentCost, next, true)
+			}
+		}
+	}
+
+	return nil, 0, false
+}
+
+// jps represents the state of a jump point search
+type jps[T comparable] struct {
+	grid   *Grid[T]
+	costOf costFn
+	goal   Point
+}
+
+// walkable reads the tile straight from its page and returns whether it can be
+// moved to or not.
+func (s *jps[T]) walkable(x, y int16) bool {
+	m := s.grid
+	if x < 0 || y < 0 || x >= m.Size.X || y >= m.Size.Y {
+		return false
+	}
+
+	return s.costOf(m.valueAt(x, y)) != 0
+}
+
+// relax stores the cost of the jump towards a point, unless the point was already reached
+// with a lower cost, in which case it returns false. The point is only pushed to the
+// frontier if it needs to be expanded.
+func (s *jps[T]) relax(edges *intmap.Map, frontier *frontier, from Point, cost uint32, to Point, push bool) (uint32, bool) {
+	if from.Equal(to) {
+		return cost, true
+	}
+
+	dir := directionOf(sign(to.X-from.X), sign(to.Y-from.Y))
+	nextCost := cost + s.costOfJump(from, to, dir)
+	pNext := to.Integer()
+
+	existingEncoded, visited := edges.Load(pNext)
+	if existingCost, existingDir := decode(existingEncoded); visited && (existingDir&settled != 0 || nextCost >= existingCost) {
+		return existingCost, false
+	}
+
+	edges.Store(pNext, encode(nextCost, dir))
+	if push {
+		frontier.Push(pNext, nextCost+Octile(to, s.goal))
+	}
+	return nextCost, true
+}
+
+// direct returns the turn of the shortest path from a point towards the goal, if none of
+// its tiles are blocked. This path moves diagonally without cutting corners until it is
+// aligned with the goal, then straight towards it, and its distance is the heuristic.
+func (s *jps[T]) direct(from Point) (Point, bool) {
+	dx, dy := sign(s.goal.X-from.X), sign(s.goal.Y-from.Y)
+	x, y := from.X, from.Y
+	for ; x != s.goal.X && y != s.goal.Y; x, y = x+dx, y+dy {
+		if !s.walkable(x+dx, y) || !s.walkable(x, y+dy) || !s.walkable(x+dx, y+dy) {
+			return Point{}, false
+		}
+	}
+
+	turn := At(x, y)
+	for x != s.goal.X || y != s.goal.Y {
+		x, y = x+sign(s.goal.X-x), y+sign(s.goal.Y-y)
+		if !s.walkable(x, y) {
+			return Point{}, false
+		}
+	}
+	return turn, true
+}
+
+// successors appends the directions of the neighbors which need to be explored,
+// given the direction in which the point was reached.
+func (s *jps[T]) successors(at Point, dir Direction, start bool, dst []Direction) []Direction {
+	x, y := at.X, at.Y
+
+	// The starting point has no direction, so all of the neighbors are explored
+	if start {
+		for dir := North; dir <= NorthWest; dir++ {
+			v := dir.Vector(1)
+			switch {
+			case !s.walkable(x+v.X, y+v.Y):
+			case dir%2 == 1 && !(s.walkable(x+v.X, y) && s.walkable(x, y+v.Y)):
+			default:
+				dst = append(dst, dir)
+			}
+		}
+		return dst
+	}
+
+	v := dir.Vector(1)
+	dx, dy := v.X, v.Y
+	switch {
+
+	// Moving diagonally, the straight components and the diagonal itself
+	case dx != 0 && dy != 0:
+		vertical := s.walkable(x, y+dy)
+		horizontal := s.walkable(x+dx, y)
+		if vertical {
+			dst = append(dst, directionOf(0, dy))
+		}
+		if horizontal {
+			dst = append(dst, directionOf(dx, 0))
+		}
+		if vertical && horizontal {
+			dst = append(dst, dir)
+		}
+
+	// Moving horizontally, forward and the forced neighbors. A side is forced when the
+	// tile behind it is blocked, otherwise it is reached by a diagonal move instead.
+	case dx != 0:
+		forward := s.walkable(x+dx, y)
+		up := s.walkable(x, y-1) && !s.walkable(x-dx, y-1)
+		down := s.walkable(x, y+1) && !s.walkable(x-dx, y+1)
+		if forward {
+			dst = append(dst, dir)
+		}
+		if up {
+			dst = append(dst, North)
+			if forward {
+				dst = append(dst, directionOf(dx, -1))
+			}
+		}
+		if down {
+			dst = append(dst, South)
+			if forward {
+				dst = append(dst, directionOf(dx, 1))
+			}
+		}
+
+	// Moving vertically, forward and the forced neighbors
+	default:
+		forward := s.walkable(x, y+dy)
+		left := s.walkable(x-1, y) && !s.walkable(x-1, y-dy)
+		right := s.walkable(x+1, y) && !s.walkable(x+1, y-dy)
+		if forward {
+			dst = append(dst, dir)
+		}
+		if left {
+			dst = append(dst, West)
+			if forward {
+				dst = append(dst, directionOf(-1, dy))
+			}
+		}
+		if right {
+			dst = append(dst, East)
+			if forward {
+				dst = append(dst, directionOf(1, dy))
+			}
+		}
+	}
+	return dst
+}
+
+// jump moves from a point in a direction until it finds a jump point, which is either
+// the goal or a point with a forced neighbor. It returns false if it hits an obstacle.
+func (s *jps[T]) jump(from Point, dir Direction) (Point, bool) {
+	v := dir.Vector(1)
+	dx, dy := v.X, v.Y
+	switch {
+	case dx == 0:
+		return s.jumpStraight(from, 0, dy)
+	case dy == 0:
+		return s.jumpStraight(from, dx, 0)
+	}
+
+	x, y := from.X+dx, from.Y+dy
+	for {
+		switch {
+		case !s.walkable(x, y):
+			return Point{}, false
+		case x == s.goal.X && y == s.goal.Y:
+			return At(x, y), true
+		}
+
+		// Diagonal move is a jump point if any of the straight jumps finds one
+		if _, ok := s.jumpStraight(At(x, y), dx, 0); ok {
+			return At(x, y), true
+		}
+		if _, ok := s.jumpStraight(At(x, y), 0, dy); ok {
+			return At(x, y), true
+		}
+
+		// Since corners can not be cut, both sides need to be open to continue
+		if !s.walkable(x+dx, y) || !s.walkable(x, y+dy) {
+			return Point{}, false
+		}
+
+		x += dx
+		y += dy
+	}
+}
+
+// jumpStraight moves horizontally or vertically until it finds a jump point. Since these
+// scans are the hot loop of the search, the three lanes (both sides and the center) are
+// read from pages that are only located again at their boundaries, instead of locating
+// the page of every tile.
+func (s *jps[T]) jumpStraight(from Point, dx, dy int16) (Point, bool) {
+	m := s.grid
+
+	// Split the coordinates into the moving and the fixed axis
+	at, step, size, goal := from.X, dx, m.Size.X, s.goal.X
+	fixed, fixedSize, fixedGoal := from.Y, m.Size.Y, s.goal.Y
+	pageStride, tileStride := 1, 1
+	fixedPageStride, fixedTileStride := int(m.pageWidth), 3
+	if dx == 0 {
+		at, step, size, goal = from.Y, dy, m.Size.Y, s.goal.Y
+		fixed, fixedSize, fixedGoal = from.X, m.Size.X, s.goal.X
+		pageStride, tileStride, fixedPageStride, fixedTileStride = fixedPageStride, fixedTileStride, pageStride, tileStride
+	}
+
+	// Locate the lanes along the fixed axis, a lane outside of the grid is blocked
+	var lanes [3]lane[T]
+	for i := range lanes {
+		if f := fixed + int16(i) - 1; f >= 0 && f < fixedSize {
+			lanes[i] = lane[T]{
+				page: int(f/3) * fixedPageStride,
+				tile: int(f%3) * fixedTileStride,
+				ok:   true,
+			}
+		}
+	}
+
+	// Offsets of the current position along the moving axis
+	costOf := s.costOf
+	page, tile := int(at/3)*pageStride, int(at%3)*tileStride
+	for i := range lanes {
+		lanes[i].seek(m, page)
+	}
+
+	left := lanes[0].walkable(tile, costOf)
+	right := lanes[2].walkable(tile, costOf)
+	for {
+		if at += step; at < 0 || at >= size {
+			return Point{}, false
+		}
+
+		// Move the offsets, switching to the next page at its boundary
+		switch tile += int(step) * tileStride; {
+		case tile < 0:
+			tile += 3 * tileStride
+			page -= pageStride
+			for i := range lanes {
+				lanes[i].seek(m, page)
+			}
+		case tile >= 3*tileStride:
+			tile -= 3 * tileStride
+			page += pageStride
+			for i := range lanes {
+				lanes[i].seek(m, page)
+			}
+		}
+
+		switch {
+		case !lanes[1].walkable(tile, costOf):
+			return Point{}, false
+		case at == goal && fixed == fixedGoal: // Goal itself
+			return s.pointOf(at, fixed, dx), true
+		}
+
+		// A side which opens up after being blocked is a forced neighbor
+		nextLeft := lanes[0].walkable(tile, costOf)
+		nextRight := lanes[2].walkable(tile, costOf)
+		if (nextLeft && !left) || (nextRight && !right) {
+			return s.pointOf(at, fixed, dx), true
+		}
+
+		left, right = nextLeft, nextRight
+	}
+}
+
+// lane represents a row or a column which is read during a straight jump, with the
+// offsets of its page and tile along the fixed axis.
+type lane[T comparable] struct {
+	page, tile int      // The offsets along the fixed axis
+	ok         bool     // Whether the lane is within the grid
+	current    *page[T] // The page at the current position
+	value      Value    // The last value read
+	open       bool     // Whether the last value can be moved to
+	read       bool     // Whether a value was read
+}
+
+// seek locates the page of the lane at the page offset of the moving axis. The page is
+// read through the grid, so that the pages of a snapshot are copied before being read.
+func (l *lane[T]) seek(m *Grid[T], page int) {
+	if l.ok {
+		l.current = m.page(l.page + page)
+	}
+}
+
+// walkable returns whether the tile of the lane at the tile offset of the moving axis
+// can be moved to or not. Since the tiles of a lane often share the same value, the
+// cost function is only called when the value changes.
+func (l *lane[T]) walkable(tile int, costOf costFn) bool {
+	if !l.ok {
+		return false
+	}
+
+	if v := l.current.tileAt(uint8(l.tile + tile)); !l.read || v != l.value {
+		l.value, l.open, l.read = v, costOf(v) != 0, true
+	}
+	return l.open
+}
+
+// pointOf returns the point for the moving and the fixed coordinates of a scan
+func (s *jps[T]) pointOf(at, fixed, dx int16) Point {
+	if dx == 0 {
+		return At(fixed, at)
+	}
+	return At(at, fixed)
+}
+
+// costOfJump returns the fixed-point cost of a jump between two points, given that
+// every tile along the jump has the same cost.
+func (s *jps[T]) costOfJump(from, to Point, dir Direction) uint32 {
+	steps := max(abs(int32(to.X)-int32(from.X)), abs(int32(to.Y)-int32(from.Y)))
+	tile, _ := s.grid.At(to.X, to.Y)
+	cost := uint32(s.costOf(tile.Value()))
+	if dir%2 == 1 {
+		return steps * cost * costDiagonal
+	}
+	return steps * cost * costStraight
+}
+
+// reconstruct reconstructs the complete path, including the tiles between the jump
+// points. Since a jump always follows a straight line, the previous jump point is
+// the first point on the line whose cost matches the cost of the jump.
+func (s *jps[T]) reconstruct(edges *intmap.Map, from, to Point) []Point {
+	current := to
+	path := make([]Point, 0, 64)
+	path = append(path, current)
+	for !current.Equal(from) {
+		currentEncoded, _ := edges.Load(current.Integer())
+		currentCost, dir := decode(currentEncoded)
+		dir &^= settled
+		back := oppositeDirection(dir)
+
+		for prev := current.Move(back); ; prev = prev.Move(back) {
+			path = append(path, prev)
+			if prevEncoded, ok := edges.Load(prev.Integer()); ok {
+				if prevCost, _ := decode(prevEncoded); prevCost+s.costOfJump(prev, current, dir) == currentCost {
+					current = prev
+					break
+				}
+			}
+		}
+	}
+
+	// Reverse the path to get from source to destination
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// sign returns the sign of a coordinate difference
+func sign(v int16) int16 {
+	switch {
+	case v < 0:
+		return -1
+	case v > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// directionOf returns the direction of a unit vector
+func directionOf(dx, dy int16) Direction {
+	return angleOf(Point{}, Point{X: dx, Y: dy})
+}
@@ -0,0 +1,144 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+cpu: Intel(R) Xeon(R) Processor
+BenchmarkPathJPS/300x300         	    3835	    313370 ns/op	    3840 B/op	       4 allocs/op
+BenchmarkPathJPS/3000x3000       	      32	  36315980 ns/op	   45332 B/op	      10 allocs/op
+BenchmarkPathJPS/3072x3072       	   35275	     30529 ns/op	    7299 B/op	       5 allocs/op
+*/
+func BenchmarkPathJPS(b *testing.B) {
+	b.Run("300x300", func(b *testing.B) {
+		m := mapFrom("300x300.png")
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			m.PathJPS(At(115, 20), At(160, 270), costOf)
+		}
+	})
+
+	b.Run("3000x3000", func(b *testing.B) {
+		m := mapTiled("300x300.png", 10)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			m.PathJPS(At(0, 1500), At(2999, 1400), costOf)
+		}
+	})
+
+	b.Run("3072x3072", func(b *testing.B) {
+		m := NewGrid(3072, 3072)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			m.PathJPS(At(0, 0), At(700, 700), costOf)
+		}
+	})
+}
+
+func TestPathJPS(t *testing.T) {
+	m := mapFrom("9x9.png")
+	path, dist, found := m.PathJPS(At(1, 1), At(7, 7), costOf)
+	assert.True(t, found)
+	assert.Equal(t, 54, dist)
+	assert.Equal(t, At(1, 1), path[0])
+	assert.Equal(t, At(7, 7), path[len(path)-1])
+	assertDiagonal(t, m, path, DiagonalNoCorners)
+}
+
+func TestPathJPSMiss(t *testing.T) {
+	m := mapFrom("9x9.png")
+
+	// Blocked destination
+	_, _, found := m.PathJPS(At(1, 1), At(0, 0), costOf)
+	assert.False(t, found)
+
+	// Outside of the grid
+	_, _, found = m.PathJPS(At(1, 1), At(20, 20), costOf)
+	assert.False(t, found)
+
+	// Walled off destination
+	m.WriteAt(6, 7, Value(0xff))
+	m.WriteAt(7, 6, Value(0xff))
+	_, _, found = m.PathJPS(At(1, 1), At(7, 7), costOf)
+	assert.False(t, found)
+}
+
+func TestPathJPSSame(t *testing.T) {
+	m := mapFrom("9x9.png")
+	path, dist, found := m.PathJPS(At(1, 1), At(1, 1), costOf)
+	assert.True(t, found)
+	assert.Equal(t, 0, dist)
+	assert.Equal(t, []Point{At(1, 1)}, path)
+}
+
+func TestPathJPSOpen(t *testing.T) {
+	m := NewGrid(30, 30)
+	path, dist, found := m.PathJPS(At(0, 0), At(20, 10), costOf)
+	assert.True(t, found)
+	assert.Equal(t, 10*costDiagonal+10*costStraight, dist)
+	assert.Len(t, path, 21)
+	assertDiagonal(t, m, path, DiagonalNoCorners)
+
+	// Straight and diagonal lines towards the goal
+	path, dist, found = m.PathJPS(At(0, 5), At(20, 5), costOf)
+	assert.True(t, found)
+	assert.Equal(t, 20*costStraight, dist)
+	assert.Len(t, path, 21)
+
+	path, dist, found = m.PathJPS(At(29, 29), At(9, 9), costOf)
+	assert.True(t, found)
+	assert.Equal(t, 20*costDiagonal, dist)
+	assert.Len(t, path, 21)
+	assertDiagonal(t, m, path, DiagonalNoCorners)
+}
+
+func TestPathJPSOptimal(t *testing.T) {
+	for name, m := range map[string]*Grid[string]{
+		"9x9":     mapFrom("9x9.png"),
+		"300x300": mapFrom("300x300.png"),
+	} {
+		// Collect all of the passable tiles
+		var open []Point
+		m.Each(func(p Point, tile Tile[string]) {
+			if costOf(tile.Value()) > 0 {
+				open = append(open, p)
+			}
+		})
+
+		for i := 0; i < 50; i++ {
+			from := open[int(rand(i*7))*len(open)/256]
+			goal := open[int(rand(i*13+1))*len(open)/256]
+
+			expect, dist, found := m.PathDiagonal(from, goal, costOf, DiagonalNoCorners)
+			path, actual, ok := m.PathJPS(from, goal, costOf)
+			assert.Equal(t, found, ok, "%v: %v -> %v", name, from, goal)
+			if found {
+				assert.Equal(t, dist, actual, "%v: %v -> %v", name, from, goal)
+				assert.Equal(t, len(expect) > 0, len(path) > 0)
+				assert.Equal(t, from, path[0])
+				assert.Equal(t, goal, path[len(path)-1])
+				assertDiagonal(t, m, path, DiagonalNoCorners)
+			}
+		}
+	}
+}
+
+// mapTiled creates a larger map by repeating a fixture in both directions
+func mapTiled(name string, n int16) *Grid[string] {
+	src := mapFrom(name)
+	m := NewGrid(src.Size.X*n, src.Size.Y*n)
+	m.Each(func(p Point, _ Tile[string]) {
+		tile, _ := src.At(p.X%src.Size.X, p.Y%src.Size.Y)
+		m.WriteAt(p.X, p.Y, tile.Value())
+	})
+	return m
+}
@@ -0,0 +1,134 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"sync/atomic"
+)
+
+var _ Observer[string] = (*ObserverFunc[string])(nil)
+
+// ObserverFunc represents an observer which calls a function with each update of the
+// tiles within its viewport. Unlike a view, there is no inbox in between, as the
+// function is called on the goroutine of the writer once the tile was updated, so it
+// should return quickly and be safe to call from several goroutines at once.
+type ObserverFunc[T comparable] struct {
+	Grid *Grid[T]        // The associated map
+	rect atomic.Uint64   // The view box
+	fn   func(Update[T]) // The function to call with each update
+}
+
+// NewObserverFunc creates a new observer for a map, either a Grid or a HexGrid, which
+// calls the function with each update of the tiles within its viewport. The observer
+// does not observe any tile until it is resized.
+func NewObserverFunc[T comparable](m tiled[T], fn func(Update[T])) *ObserverFunc[T] {
+	o := &ObserverFunc[T]{
+		Grid: m.tiles(),
+		fn:   fn,
+	}
+	o.rect.Store(NewRect(-1, -1, -1, -1).pack())
+	return o
+}
+
+// Viewport returns the current viewport of the observer.
+func (o *ObserverFunc[T]) Viewport() Rect {
+	return unpackRect(o.rect.Load())
+}
+
+// Resize resizes the viewport of the observer. The iterator is called for each of the
+// tiles which entered the viewport.
+func (o *ObserverFunc[T]) Resize(view Rect, fn func(Point, Tile[T])) {
+	view = o.Grid.wrapRect(view)
+	prev := unpackRect(o.rect.Swap(view.pack()))
+	o.Grid.observe(o, prev, view, fn)
+}
+
+// MoveBy moves the viewport towards a particular direction.
+func (o *ObserverFunc[T]) MoveBy(x, y int16, fn func(Point, Tile[T])) {
+	r := o.Viewport()
+	o.Resize(Rect{
+		Min: r.Min.Add(At(x, y)),
+		Max: r.Max.Add(At(x, y)),
+	}, fn)
+}
+
+// MoveAt moves the viewport to a specific coordinate.
+func (o *ObserverFunc[T]) MoveAt(nw Point, fn func(Point, Tile[T])) {
+	r := o.Viewport()
+	o.Resize(Rect{
+		Min: nw,
+		Max: nw.Add(r.Max.Subtract(r.Min)),
+	}, fn)
+}
+
+// Close unsubscribes the observer from everything.
+func (o *ObserverFunc[T]) Close() error {
+	o.Grid.unobserve(o, o.Viewport())
+	return nil
+}
+
+// onUpdate occurs when a tile has updated.
+func (o *ObserverFunc[T]) onUpdate(ev *Update[T]) {
+	o.fn(*ev)
+}
+
+// ---------------------------------- Subscription ----------------------------------
+
+// observe subscribes an observer to the pages which entered its viewport, and
+// unsubscribes it from the pages which left it. The iterator is called for each of
+// the tiles which entered the viewport.
+func (m *Grid[T]) observe(sub Observer[T], prev, view Rect, fn func(Point, Tile[T])) {
+	for _, diff := range view.Difference(prev) {
+		if diff.IsZero() {
+			continue // Skip zero-value rectangles
+		}
+
+		m.pagesWithin(diff.Min, diff.Max, func(page *page[T]) {
+			r := page.Bounds()
+			switch {
+
+			// Page is now in view
+			case m.intersects(view, r) && !m.intersects(prev, r):
+				if m.observers.Subscribe(page.point, sub) {
+					page.SetObserved(true) // Mark the page as being observed
+				}
+
+			// Page is no longer in view
+			case !m.intersects(view, r) && m.intersects(prev, r):
+				if m.observers.Unsubscribe(page.point, sub) {
+					page.SetObserved(false) // Mark the page as not being observed
+				}
+			}
+
+			// Callback for each new tile in the view
+			if fn != nil {
+				page.Each(m, func(p Point, tile Tile[T]) {
+					if m.contains(view, p) && !m.contains(prev, p) {
+						fn(p, tile)
+					}
+				})
+			}
+		})
+	}
+
+	// The difference of two disjoint rectangles is the new one alone, so the pages left
+	// behind, such as when the viewport jumps across the seam of a wrapped grid, need to
+	// be released separately.
+	if !view.Intersects(prev) && !prev.IsZero() {
+		m.pagesWithin(prev.Min, prev.Max, func(page *page[T]) {
+			if !m.intersects(view, page.Bounds()) && m.observers.Unsubscribe(page.point, sub) {
+				page.SetObserved(false) // Mark the page as not being observed
+			}
+		})
+	}
+}
+
+// unobserve unsubscribes an observer from the pages within its viewport
+func (m *Grid[T]) unobserve(sub Observer[T], view Rect) {
+	m.pagesWithin(view.Min, view.Max, func(page *page[T]) {
+		if m.observers.Unsubscribe(page.point, sub) {
+			page.SetObserved(false) // Mark the page as not being observed
+		}
+	})
+}
@@ -0,0 +1,151 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+cpu: Intel(R) Xeon(R) Processor
+BenchmarkObserver/write         	11802192	       111.2 ns/op	      48 B/op	       1 allocs/op
+BenchmarkObserver/move          	    9993	    209776 ns/op	   54975 B/op	       1 allocs/op
+*/
+func BenchmarkObserver(b *testing.B) {
+	m := mapFrom("300x300.png")
+	var count atomic.Int64
+	o := NewObserverFunc(m, func(Update[string]) {
+		count.Add(1)
+	})
+	o.Resize(NewRect(100, 0, 200, 100), nil)
+
+	b.Run("write", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			m.WriteAt(152, 52, Value(0))
+		}
+	})
+
+	b.Run("move", func(b *testing.B) {
+		locs := []Point{
+			At(100, 0),
+			At(200, 100),
+		}
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			o.MoveAt(locs[n%2], nil)
+		}
+	})
+}
+
+func TestObserverFunc(t *testing.T) {
+	m := NewGrid(9, 9)
+	var updates []Update[string]
+	o := NewObserverFunc(m, func(ev Update[string]) {
+		updates = append(updates, ev)
+	})
+
+	// Nothing is observed until the observer is resized
+	m.WriteAt(1, 1, 1)
+	assert.Empty(t, updates)
+
+	count := 0
+	o.Resize(NewRect(0, 0, 3, 3), func(p Point, tile Tile[string]) {
+		count++
+	})
+	assert.Equal(t, 9, count)
+	assert.True(t, m.pages[0].IsObserved())
+
+	// Only the tiles within the viewport are observed
+	m.WriteAt(2, 2, 2)
+	m.WriteAt(5, 5, 3)
+	tile, _ := m.At(1, 1)
+	tile.Add("A")
+	assert.Equal(t, []Update[string]{
+		{Old: ValueAt{At(2, 2), 0}, New: ValueAt{At(2, 2), 2}, Seq: 1, Kind: ValueChanged},
+		{Old: ValueAt{At(1, 1), 1}, New: ValueAt{At(1, 1), 1}, Add: "A", Seq: 2, Kind: ObjectAdded},
+	}, updates)
+
+	// Moving the observer changes the tiles it observes
+	updates = nil
+	o.MoveBy(3, 3, nil)
+	assert.Equal(t, NewRect(3, 3, 6, 6), o.Viewport())
+	m.WriteAt(2, 2, 4)
+	m.WriteAt(5, 5, 5)
+	assert.Len(t, updates, 1)
+	assert.Equal(t, ValueAt{At(5, 5), 3}, updates[0].Old)
+	assert.Equal(t, ValueAt{At(5, 5), 5}, updates[0].New)
+
+	// A batch delivers each of its updates
+	updates = nil
+	assert.NoError(t, m.Batch(func(tx *Tx[string]) error {
+		tx.WriteAt(4, 4, 6)
+		tx.WriteAt(4, 5, 7)
+		return nil
+	}))
+	assert.Len(t, updates, 2)
+
+	// Once closed, nothing is observed anymore
+	updates = nil
+	assert.NoError(t, o.Close())
+	assert.False(t, m.pages[4].IsObserved())
+	m.WriteAt(5, 5, 8)
+	assert.Empty(t, updates)
+}
+
+func TestObserverFuncWithView(t *testing.T) {
+	m := NewGrid(9, 9)
+	v := NewView(m, "view 1")
+	v.Resize(NewRect(0, 0, 9, 9), nil)
+	defer v.Close()
+
+	var count atomic.Int64
+	o := NewObserverFunc(m, func(Update[string]) {
+		count.Add(1)
+	})
+	o.MoveAt(At(0, 0), nil)
+	o.Resize(NewRect(0, 0, 9, 9), nil)
+
+	// Closing the observer keeps the pages observed by the view
+	m.WriteAt(1, 1, 1)
+	assert.NoError(t, o.Close())
+	m.WriteAt(1, 1, 2)
+	assert.Equal(t, int64(1), count.Load())
+	assert.True(t, m.pages[0].IsObserved())
+	assert.Equal(t, Value(1), (<-v.Inbox).New.Value)
+	assert.Equal(t, Value(2), (<-v.Inbox).New.Value)
+}
+
+func TestObserverFuncConcurrent(t *testing.T) {
+	const writers, writes = 4, 1000
+	m := NewGrid(9, 9)
+
+	var count atomic.Int64
+	o := NewObserverFunc(m, func(ev Update[string]) {
+		count.Add(1)
+	})
+	o.Resize(NewRect(0, 0, 9, 9), nil)
+	defer o.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for n := 0; n < writes; n++ {
+				m.WriteAt(int16(i), int16(n%9), Value(n))
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	assert.Equal(t, int64(writers*writes), count.Load())
+}
@@ -21,13 +21,21 @@ type edge struct {
 
 // Around performs a breadth first search around a point.
 func (m *Grid[T]) Around(from Point, distance uint32, costOf costFn, fn func(Point, Tile[T])) {
+	m.around(from, distance, costOf, func(p Point, t Tile[T]) bool {
+		fn(p, t)
+		return true
+	})
+}
+
+// around performs a breadth first search around a point, until the yield function
+// returns false.
+func (m *Grid[T]) around(from Point, distance uint32, costOf costFn, yield func(Point, Tile[T]) bool) {
+	from = m.wrapPoint(from)
 	start, ok := m.At(from.X, from.Y)
-	if !ok {
+	if !ok || !yield(from, start) {
 		return
 	}
 
-	fn(from, start)
-
 	// For pre-allocating, we use πr2 since BFS will result in a approximation
 	// of a circle, in the worst case.
 	maxArea := int(math.Ceil(math.Pi * float64(distance*distance)))
@@ -45,13 +53,13 @@ func (m *Grid[T]) Around(from Point, distance uint32, costOf costFn, fn func(Poi
 		current := unpackPoint(pCurr)
 
 		// Get all of the neighbors
-		m.Neighbors(current.X, current.Y, func(next Point, nextTile Tile[T]) {
-			if d := from.DistanceTo(next); d > distance {
-				return // Too far
+		for next, nextTile := range m.NeighborsOf(current) {
+			if d := from.DistanceTo(m.nearest(from, next)); d > distance {
+				continue // Too far
 			}
 
 			if cost := costOf(nextTile.Value()); cost == 0 {
-				return // Blocked tile, ignore completely
+				continue // Blocked tile, ignore completely
 			}
 
 			// Add to the search queue
@@ -59,14 +67,190 @@ func (m *Grid[T]) Around(from Point, distance uint32, costOf costFn, fn func(Poi
 			if _, ok := reached.Load(pNext); !ok {
 				frontier.Push(pNext, 1)
 				reached.Store(pNext, 1)
-				fn(next, nextTile)
+				if !yield(next, nextTile) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Flood performs a Dijkstra search around a point, visiting every tile which can be
+// reached within a cost budget, in the order of increasing cost. For each tile, the
+// callback receives the accumulated cost of reaching it and its predecessor on the
+// cheapest path, which can be used to reconstruct the path to any of the tiles.
+func (m *Grid[T]) Flood(from Point, budget uint32, costOf costFn, fn func(at Point, tile Tile[T], cost uint32, prev Point)) {
+	from = m.wrapPoint(from)
+	if _, ok := m.At(from.X, from.Y); !ok {
+		return
+	}
+
+	// For pre-allocating, we use πr2 since each step costs at least 1, the search
+	// can not go further than the budget in the worst case.
+	maxArea := int(math.Ceil(math.Pi * float64(budget) * float64(budget)))
+	maxArea = min(maxArea, int(m.Size.X)*int(m.Size.Y))
+
+	// Acquire a frontier heap for search
+	state := acquire(maxArea)
+	frontier := state.frontier
+	edges := state.edges
+	defer release(state)
+
+	frontier.Push(from.Integer(), 0)
+	edges.Store(from.Integer(), encode(0, Direction(0)))
+	for !frontier.IsEmpty() {
+		pCurr := frontier.Pop()
+		currentEncoded, _ := edges.Load(pCurr)
+		currentCost, dir := decode(currentEncoded)
+		if dir&settled != 0 {
+			continue // Already visited with a lower cost
+		}
+
+		// Mark the tile as settled, since its cost can no longer decrease
+		edges.Store(pCurr, encode(currentCost, dir|settled))
+		current := unpackPoint(pCurr)
+		prev := current
+		if !current.Equal(from) {
+			prev = m.wrapPoint(current.Move(oppositeDirection(dir)))
+		}
+
+		tile, _ := m.At(current.X, current.Y)
+		fn(current, tile, currentCost, prev)
+
+		// Explore neighbors
+		for next, nextTile := range m.NeighborsOf(current) {
+			cost := costOf(nextTile.Value())
+			if cost == 0 {
+				continue // Blocked tile
+			}
+
+			nextCost := currentCost + uint32(cost)
+			if nextCost > budget {
+				continue // Too expensive
+			}
+
+			pNext := next.Integer()
+			existingEncoded, visited := edges.Load(pNext)
+			existingCost, existingDir := decode(existingEncoded)
+			if !visited || (existingDir&settled == 0 && nextCost < existingCost) {
+				edges.Store(pNext, encode(nextCost, angleOf(current, m.nearest(current, next))))
+				frontier.Push(pNext, nextCost)
 			}
-		})
+		}
 	}
 }
 
+// DiagonalPolicy specifies whether a diagonal move is allowed to pass by the corner
+// of a blocked tile.
+type DiagonalPolicy uint8
+
+// Various diagonal policies
+const (
+	DiagonalAlways    DiagonalPolicy = iota // Diagonal moves are always allowed
+	DiagonalNoSqueeze                       // Forbidden when both adjacent sides are blocked
+	DiagonalNoCorners                       // Forbidden when either adjacent side is blocked
+)
+
+// Fixed-point movement costs of the eight-directional search, so that a diagonal
+// step costs roughly √2 times as much as a straight one.
+const (
+	costStraight = 5
+	costDiagonal = 7
+)
+
+// Heuristic estimates the cost of the cheapest path between two points. In order
+// for the search to find the shortest path, it must never overestimate the cost.
+type Heuristic func(from, to Point) uint32
+
+// Manhattan returns the manhattan distance between two points, which is the default
+// heuristic of the four-directional search.
+func Manhattan(from, to Point) uint32 {
+	return from.DistanceTo(to)
+}
+
+// Octile returns the octile distance between two points, expressed in the same
+// fixed-point units as the eight-directional search and is its default heuristic.
+func Octile(from, to Point) uint32 {
+	dx := abs(int32(from.X) - int32(to.X))
+	dy := abs(int32(from.Y) - int32(to.Y))
+	return costStraight*max(dx, dy) + (costDiagonal-costStraight)*min(dx, dy)
+}
+
+// Neighborhood specifies which neighbors of a tile are explored by the search.
+type Neighborhood uint8
+
+// Various neighborhoods
+const (
+	FourWay  Neighborhood = iota // North, east, south and west neighbors
+	EightWay                     // All of the neighbors, including diagonals
+)
+
+// PathOptions represents a set of options for the path search.
+type PathOptions struct {
+	Heuristic    Heuristic      // The heuristic, defaults to Manhattan or Octile
+	Neighbors    Neighborhood   // The neighborhood to explore, defaults to FourWay
+	Diagonal     DiagonalPolicy // The policy for diagonal moves of the EightWay neighborhood
+	MaxCost      uint32         // The maximum cost of the path, zero if unlimited
+	MaxExpanded  int            // The maximum number of tiles to expand, zero if unlimited
+	AllowPartial bool           // Whether to return the best partial path if the goal is not reached
+}
+
 // Path calculates a short path and the distance between the two locations
 func (m *Grid[T]) Path(from, to Point, costOf costFn) ([]Point, int, bool) {
+	return m.PathWith(from, to, costOf, PathOptions{})
+}
+
+// PathDiagonal calculates a short path and the distance between the two locations,
+// allowing diagonal moves. The cost of a straight move is 5 times the tile cost and
+// the cost of a diagonal move is 7 times the tile cost, so the returned distance is
+// expressed in these fixed-point units. The policy specifies whether diagonal moves
+// can pass by the corners of blocked tiles.
+func (m *Grid[T]) PathDiagonal(from, to Point, costOf costFn, policy DiagonalPolicy) ([]Point, int, bool) {
+	return m.PathWith(from, to, costOf, PathOptions{
+		Neighbors: EightWay,
+		Diagonal:  policy,
+	})
+}
+
+// PathWith calculates a short path and the distance between the two locations, given
+// a set of options. If the search exceeds its budget or the goal is unreachable, and
+// partial paths are allowed, it returns the path to the tile which is the closest to
+// the goal according to the heuristic, along with its distance and false.
+func (m *Grid[T]) PathWith(from, to Point, costOf costFn, opts PathOptions) ([]Point, int, bool) {
+	from, to = m.wrapPoint(from), m.wrapPoint(to)
+	var expand func(Point, []edge) []edge
+	switch opts.Neighbors {
+	case EightWay:
+		if opts.Heuristic == nil {
+			opts.Heuristic = Octile
+		}
+
+		expand = func(at Point, dst []edge) []edge {
+			return m.diagonal(at, costOf, opts.Diagonal, dst)
+		}
+	default:
+		if opts.Heuristic == nil {
+			opts.Heuristic = Manhattan
+		}
+
+		expand = func(at Point, dst []edge) []edge {
+			return m.orthogonal(at, costOf, dst)
+		}
+	}
+
+	// On a grid which wraps around, the heuristic is given the closest copy of the goal
+	if heuristic := opts.Heuristic; m.wrap != (Point{}) {
+		opts.Heuristic = func(a, b Point) uint32 {
+			return heuristic(a, m.nearest(a, b))
+		}
+	}
+
+	return m.search(from, to, expand, &opts)
+}
+
+// search performs an A* search between two locations, given a function which appends
+// the neighbors of a point along with the cost of the move.
+func (m *Grid[T]) search(from, to Point, expand func(Point, []edge) []edge, opts *PathOptions) ([]Point, int, bool) {
 	distance := float64(from.DistanceTo(to))
 	maxArea := int(math.Ceil(math.Pi * float64(distance*distance)))
 
@@ -80,63 +264,153 @@ func (m *Grid[T]) Path(from, to Point, costOf costFn) ([]Point, int, bool) {
 	frontier.Push(from.Integer(), 0)
 	edges.Store(from.Integer(), encode(0, Direction(0))) // Starting point has no direction
 
-	for !frontier.IsEmpty() {
+	// Keep track of the closest point to the goal, for partial paths
+	heuristic := opts.Heuristic
+	closest, closestCost, closestDist := from, uint32(0), heuristic(from, to)
+
+	next := make([]edge, 0, 8)
+	for expanded := 0; !frontier.IsEmpty(); {
 		pCurr := frontier.Pop()
 		current := unpackPoint(pCurr)
 
 		// Decode the cost to reach the current point
 		currentEncoded, _ := edges.Load(pCurr)
-		currentCost, _ := decode(currentEncoded)
+		currentCost, dir := decode(currentEncoded)
+		if dir&settled != 0 {
+			continue // Already expanded with a lower cost
+		}
 
 		// Check if we've reached the destination
 		if current.Equal(to) {
+			return m.reconstruct(edges, from, to), int(currentCost), true
+		}
 
-			// Reconstruct the path
-			path := make([]Point, 0, 64)
-			path = append(path, current)
-			for !current.Equal(from) {
-				currentEncoded, _ := edges.Load(current.Integer())
-				_, dir := decode(currentEncoded)
-				current = current.Move(oppositeDirection(dir))
-				path = append(path, current)
-			}
+		// Only the tiles which are actually expanded count towards the budget
+		if opts.MaxExpanded > 0 && expanded >= opts.MaxExpanded {
+			break // Out of budget
+		}
 
-			// Reverse the path to get from source to destination
-			for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
-				path[i], path[j] = path[j], path[i]
-			}
+		// Mark the tile as expanded, so that its stale copies in the frontier are skipped.
+		// With a heuristic which is not consistent, its cost can still decrease later on,
+		// in which case it is expanded again.
+		edges.Store(pCurr, encode(currentCost, dir|settled))
+		expanded++
 
-			return path, int(currentCost), true
+		// Keep the closest point to the goal, and the cheapest one on a tie
+		if dist := heuristic(current, to); dist < closestDist || (dist == closestDist && currentCost < closestCost) {
+			closest, closestCost, closestDist = current, currentCost, dist
 		}
 
 		// Explore neighbors
-		m.Neighbors(current.X, current.Y, func(next Point, nextTile Tile[T]) {
-			cNext := costOf(nextTile.Value())
-			if cNext == 0 {
-				return // Blocked tile
+		for _, next := range expand(current, next[:0]) {
+			nextCost := currentCost + next.Cost
+			if opts.MaxCost > 0 && nextCost > opts.MaxCost {
+				continue // Too expensive
 			}
 
-			nextCost := currentCost + uint32(cNext)
 			pNext := next.Integer()
-
 			existingEncoded, visited := edges.Load(pNext)
 			existingCost, _ := decode(existingEncoded)
 
 			// If we haven't visited this node or we found a better path
 			if !visited || nextCost < existingCost {
-				angle := angleOf(current, next)
-				priority := nextCost + next.DistanceTo(to)
+				angle := angleOf(current, m.nearest(current, next.Point))
+				priority := nextCost + heuristic(next.Point, to)
 
 				// Store the edge and push to the frontier
 				edges.Store(pNext, encode(nextCost, angle))
 				frontier.Push(pNext, priority)
 			}
-		})
+		}
+	}
+
+	if opts.AllowPartial {
+		return m.reconstruct(edges, from, closest), int(closestCost), false
 	}
 
 	return nil, 0, false
 }
 
+// orthogonal appends the four direct neighbors of a point which can be moved to,
+// along with the cost of moving there.
+func (m *Grid[T]) orthogonal(at Point, costOf costFn, dst []edge) []edge {
+	for next, nextTile := range m.NeighborsOf(at) {
+		if cost := costOf(nextTile.Value()); cost > 0 {
+			dst = append(dst, edge{Point: next, Cost: uint32(cost)})
+		}
+	}
+	return dst
+}
+
+// diagonal appends all eight neighbors of a point which can be moved to, along
+// with the fixed-point cost of moving there.
+func (m *Grid[T]) diagonal(at Point, costOf costFn, policy DiagonalPolicy, dst []edge) []edge {
+	var open [8]uint16
+	for dir := North; dir <= NorthWest; dir++ {
+		next := at.Move(dir)
+		if tile, ok := m.At(next.X, next.Y); ok {
+			open[dir] = costOf(tile.Value())
+		}
+	}
+
+	n := len(dst)
+	dst = appendDiagonal(at, &open, policy, dst)
+	for i := n; i < len(dst); i++ {
+		dst[i].Point = m.wrapPoint(dst[i].Point)
+	}
+	return dst
+}
+
+// appendDiagonal appends the neighbors of a point which can be moved to, given the
+// cost of each of the eight neighbors, along with the fixed-point cost of the move.
+func appendDiagonal(at Point, open *[8]uint16, policy DiagonalPolicy, dst []edge) []edge {
+	for dir := North; dir <= NorthWest; dir++ {
+		cost := uint32(open[dir])
+		switch {
+		case cost == 0:
+			continue // Blocked tile
+		case dir%2 == 0:
+			dst = append(dst, edge{Point: at.Move(dir), Cost: cost * costStraight})
+			continue
+		}
+
+		// Check the sides of the diagonal move, e.g. North and East for NorthEast
+		a, b := open[dir-1] != 0, open[(dir+1)%8] != 0
+		switch {
+		case policy == DiagonalNoSqueeze && !a && !b:
+			continue
+		case policy == DiagonalNoCorners && (!a || !b):
+			continue
+		default:
+			dst = append(dst, edge{Point: at.Move(dir), Cost: cost * costDiagonal})
+		}
+	}
+	return dst
+}
+
+// reconstruct reconstructs the path from the edges of the search
+func (m *Grid[T]) reconstruct(edges *intmap.Map, from, to Point) []Point {
+	current := to
+	path := make([]Point, 0, 64)
+	path = append(path, current)
+	for !current.Equal(from) {
+		currentEncoded, _ := edges.Load(current.Integer())
+		_, dir := decode(currentEncoded)
+		current = m.wrapPoint(current.Move(oppositeDirection(dir &^ settled)))
+		path = append(path, current)
+	}
+
+	// Reverse the path to get from source to destination
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// settled is a flag which is packed along with the direction, marking the tiles which
+// were already expanded during a search.
+const settled Direction = 0x8
+
 // encode packs the cost and direction into a uint32
 func encode(cost uint32, dir Direction) uint32 {
 	return (cost << 4) | uint32(dir&0xF)
@@ -184,18 +458,23 @@ func release(v *pathfinder) {
 
 // -----------------------------------------------------------------------------
 
-// frontier is a priority queue implementation that uses buckets to store
-// elements. Original implementation by Iskander Sharipov (https://github.com/quasilyte/pathing)
+// frontier is a monotone priority queue implemented as a radix heap. Elements are
+// stored in buckets according to the highest bit in which their priority differs
+// from the last popped priority, which keeps the queue exact for any 32-bit priority
+// while only ever appending to the pre-allocated buckets. Since the queue is monotone,
+// an element pushed with a priority lower than the last popped one is treated as if
+// it had the last popped priority.
 type frontier struct {
-	buckets [64][]uint32
-	mask    uint64
+	buckets [33][]uint64 // Packed priority (high) and value (low)
+	mask    uint64       // Bitmask of the non-empty buckets
+	last    uint32       // The last popped priority
 }
 
 // newFrontier creates a new frontier priority queue
 func newFrontier() *frontier {
 	h := &frontier{}
 	for i := range &h.buckets {
-		h.buckets[i] = make([]uint32, 0, 16)
+		h.buckets[i] = make([]uint64, 0, 16)
 	}
 	return h
 }
@@ -203,24 +482,16 @@ func newFrontier() *frontier {
 func (q *frontier) Reset() {
 	buckets := &q.buckets
 
-	// Reslice storage slices back.
-	// To avoid traversing all len(q.buckets),
-	// we have some offset to skip uninteresting (already empty) buckets.
-	// We also stop when mask is 0 meaning all remaining buckets are empty too.
-	// In other words, it would only touch slices between min and max non-empty priorities.
-	mask := q.mask
-	offset := uint(bits.TrailingZeros64(mask))
-	mask >>= offset
-	i := offset
-	for mask != 0 {
-		if i < uint(len(buckets)) {
+	// Reslice storage slices back, only touching the non-empty buckets. We stop when
+	// mask is 0 meaning all remaining buckets are empty too.
+	for mask := q.mask; mask != 0; mask &= mask - 1 {
+		if i := uint(bits.TrailingZeros64(mask)); i < uint(len(buckets)) {
 			buckets[i] = buckets[i][:0]
 		}
-		mask >>= 1
-		i++
 	}
 
 	q.mask = 0
+	q.last = 0
 }
 
 func (q *frontier) IsEmpty() bool {
@@ -228,29 +499,48 @@ func (q *frontier) IsEmpty() bool {
 }
 
 func (q *frontier) Push(value, priority uint32) {
-	// No bound checks since compiler knows that i will never exceed 64.
-	// We also get a cool truncation of values above 64 to store them
-	// in our biggest bucket.
-	i := priority & 0b111111
-	q.buckets[i] = append(q.buckets[i], value)
+	priority = max(priority, q.last)
+
+	// No bound checks since compiler knows that i will never exceed 32.
+	i := bits.Len32(priority ^ q.last)
+	q.buckets[i] = append(q.buckets[i], uint64(priority)<<32|uint64(value))
 	q.mask |= 1 << i
 }
 
 func (q *frontier) Pop() uint32 {
 	buckets := &q.buckets
 
-	// Using uints here and explicit len check to avoid the
-	// implicitly inserted bound check.
-	i := uint(bits.TrailingZeros64(q.mask))
-	if i < uint(len(buckets)) {
-		e := buckets[i][len(buckets[i])-1]
-		buckets[i] = buckets[i][:len(buckets[i])-1]
-		if len(buckets[i]) == 0 {
-			q.mask &^= 1 << i
+	// If there's nothing with the last priority, find the smallest priority in the
+	// first non-empty bucket and redistribute it. Every element of the bucket moves
+	// into a lower bucket, so this is amortized over the pushes.
+	if q.mask&1 == 0 {
+		i := uint(bits.TrailingZeros64(q.mask))
+		if i >= uint(len(buckets)) {
+			return 0 // A queue is empty
 		}
-		return e
+
+		bucket := buckets[i]
+		lowest := bucket[0]
+		for _, e := range bucket[1:] {
+			lowest = min(lowest, e)
+		}
+
+		q.last = uint32(lowest >> 32)
+		for _, e := range bucket {
+			j := bits.Len32(uint32(e>>32) ^ q.last)
+			buckets[j] = append(buckets[j], e)
+			q.mask |= 1 << j
+		}
+
+		buckets[i] = bucket[:0]
+		q.mask &^= 1 << i
 	}
 
-	// A queue is empty
-	return 0
+	bucket := buckets[0]
+	e := bucket[len(bucket)-1]
+	buckets[0] = bucket[:len(bucket)-1]
+	if len(buckets[0]) == 0 {
+		q.mask &^= 1
+	}
+	return uint32(e)
 }
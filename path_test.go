@@ -4,10 +4,12 @@
 package tile
 
 import (
+	"container/heap"
 	"fmt"
 	"image"
 	"image/color"
 	"image/png"
+	"math"
 	"os"
 	"strings"
 	"testing"
@@ -48,6 +50,194 @@ xxxxxx`, plotPath(m, path))
 	assert.True(t, found)
 }
 
+func TestPathDiagonal(t *testing.T) {
+	m := mapFrom("9x9.png")
+	path, dist, found := m.PathDiagonal(At(1, 1), At(7, 7), costOf, DiagonalNoCorners)
+	assert.Equal(t, `
+.........
+.x  .   .
+. x... ..
+. xx . ..
+... x.  .
+.   xx  .
+.....x...
+.    xxx.
+.........`, plotPath(m, path))
+	assert.Equal(t, 54, dist)
+	assert.True(t, found)
+	assertDiagonal(t, m, path, DiagonalNoCorners)
+}
+
+func TestPathDiagonalTiny(t *testing.T) {
+	m := NewGrid(6, 6)
+	path, dist, found := m.PathDiagonal(At(0, 0), At(5, 5), costOf, DiagonalAlways)
+	assert.Equal(t, `
+x     
+ x    
+  x   
+   x  
+    x 
+     x`, plotPath(m, path))
+	assert.Equal(t, 5*costDiagonal, dist)
+	assert.True(t, found)
+}
+
+func TestPathDiagonalPolicy(t *testing.T) {
+	tests := []struct {
+		walls  []Point
+		policy DiagonalPolicy
+		length int
+		dist   int
+		found  bool
+	}{
+		{walls: []Point{At(1, 0)}, policy: DiagonalAlways, length: 2, dist: 7, found: true},
+		{walls: []Point{At(1, 0)}, policy: DiagonalNoSqueeze, length: 2, dist: 7, found: true},
+		{walls: []Point{At(1, 0)}, policy: DiagonalNoCorners, length: 3, dist: 10, found: true},
+		{walls: []Point{At(1, 0), At(0, 1)}, policy: DiagonalAlways, length: 2, dist: 7, found: true},
+		{walls: []Point{At(1, 0), At(0, 1)}, policy: DiagonalNoSqueeze, found: false},
+		{walls: []Point{At(1, 0), At(0, 1)}, policy: DiagonalNoCorners, found: false},
+	}
+
+	for _, tc := range tests {
+		m := NewGrid(6, 6)
+		for _, p := range tc.walls {
+			m.WriteAt(p.X, p.Y, Value(0xff))
+		}
+
+		path, dist, found := m.PathDiagonal(At(0, 0), At(1, 1), costOf, tc.policy)
+		assert.Equal(t, tc.found, found)
+		assert.Equal(t, tc.length, len(path))
+		assert.Equal(t, tc.dist, dist)
+	}
+}
+
+func TestPathDiagonalPolicies(t *testing.T) {
+	m := mapFrom("300x300.png")
+	from, goal := At(115, 20), At(160, 270)
+
+	var dists []int
+	for _, policy := range []DiagonalPolicy{DiagonalAlways, DiagonalNoSqueeze, DiagonalNoCorners} {
+		path, dist, found := m.PathDiagonal(from, goal, costOf, policy)
+		assert.True(t, found)
+		assert.Equal(t, from, path[0])
+		assert.Equal(t, goal, path[len(path)-1])
+		assertDiagonal(t, m, path, policy)
+		dists = append(dists, dist)
+	}
+
+	// Diagonal paths should be shorter than the straight ones
+	_, straight, _ := m.Path(from, goal, costOf)
+	assert.Less(t, dists[0], straight*costStraight)
+}
+
+func TestPathWith(t *testing.T) {
+	m := mapFrom("9x9.png")
+
+	// Same as the default path
+	path, dist, found := m.PathWith(At(1, 1), At(7, 7), costOf, PathOptions{})
+	expect, expectDist, _ := m.Path(At(1, 1), At(7, 7), costOf)
+	assert.Equal(t, expect, path)
+	assert.Equal(t, expectDist, dist)
+	assert.True(t, found)
+
+	// Same as the diagonal path
+	path, dist, found = m.PathWith(At(1, 1), At(7, 7), costOf, PathOptions{
+		Neighbors: EightWay,
+		Diagonal:  DiagonalNoCorners,
+	})
+	expect, expectDist, _ = m.PathDiagonal(At(1, 1), At(7, 7), costOf, DiagonalNoCorners)
+	assert.Equal(t, expect, path)
+	assert.Equal(t, expectDist, dist)
+	assert.True(t, found)
+
+	// Dijkstra, with a heuristic that never estimates anything
+	_, dist, found = m.PathWith(At(1, 1), At(7, 7), costOf, PathOptions{
+		Heuristic: func(Point, Point) uint32 { return 0 },
+	})
+	assert.Equal(t, 12, dist)
+	assert.True(t, found)
+}
+
+func TestPathMaxCost(t *testing.T) {
+	m := NewGrid(6, 6)
+	path, _, found := m.PathWith(At(0, 0), At(5, 5), costOf, PathOptions{MaxCost: 9})
+	assert.False(t, found)
+	assert.Nil(t, path)
+
+	path, dist, found := m.PathWith(At(0, 0), At(5, 5), costOf, PathOptions{MaxCost: 10})
+	assert.True(t, found)
+	assert.Equal(t, 11, len(path))
+	assert.Equal(t, 10, dist)
+}
+
+func TestPathPartial(t *testing.T) {
+	m := NewGrid(9, 9)
+	for _, p := range []Point{At(6, 6), At(7, 6), At(8, 6), At(6, 7), At(6, 8)} {
+		m.WriteAt(p.X, p.Y, Value(0xff))
+	}
+
+	// Unreachable, without a partial path
+	path, _, found := m.PathWith(At(0, 0), At(7, 7), costOf, PathOptions{})
+	assert.False(t, found)
+	assert.Nil(t, path)
+
+	// Unreachable, with a partial path
+	path, dist, found := m.PathWith(At(0, 0), At(7, 7), costOf, PathOptions{
+		AllowPartial: true,
+	})
+	assert.False(t, found)
+	assert.Equal(t, At(0, 0), path[0])
+	assert.Equal(t, 2, int(path[len(path)-1].DistanceTo(At(7, 7))))
+	assert.Equal(t, len(path)-1, dist)
+}
+
+func TestPathBudget(t *testing.T) {
+	m := mapFrom("300x300.png")
+	from, goal := At(115, 20), At(160, 270)
+
+	// Not enough budget to reach the goal
+	path, _, found := m.PathWith(from, goal, costOf, PathOptions{MaxExpanded: 100})
+	assert.False(t, found)
+	assert.Nil(t, path)
+
+	// Partial path, towards the goal
+	path, dist, found := m.PathWith(from, goal, costOf, PathOptions{
+		MaxExpanded:  100,
+		AllowPartial: true,
+	})
+	assert.False(t, found)
+	assert.Equal(t, from, path[0])
+	assert.Equal(t, len(path)-1, dist)
+	assert.Less(t, path[len(path)-1].DistanceTo(goal), from.DistanceTo(goal))
+
+	// Enough budget to reach the goal
+	_, _, found = m.PathWith(from, goal, costOf, PathOptions{MaxExpanded: 1000000})
+	assert.True(t, found)
+}
+
+func TestPathExpanded(t *testing.T) {
+	m := mapFrom("300x300.png")
+	from, goal := At(115, 20), At(160, 270)
+
+	// Each of the tiles is only expanded once, the stale ones in the frontier are skipped
+	expanded := make(map[Point]int)
+	opts := PathOptions{Heuristic: Manhattan}
+	_, _, found := m.search(from, goal, func(at Point, dst []edge) []edge {
+		expanded[at]++
+		return m.orthogonal(at, costOf, dst)
+	}, &opts)
+	assert.True(t, found)
+	for at, count := range expanded {
+		assert.Equal(t, 1, count, "%v", at)
+	}
+
+	// The budget only counts the expanded tiles
+	_, _, found = m.PathWith(from, goal, costOf, PathOptions{MaxExpanded: len(expanded)})
+	assert.True(t, found)
+	_, _, found = m.PathWith(from, goal, costOf, PathOptions{MaxExpanded: len(expanded) - 1})
+	assert.False(t, found)
+}
+
 func TestDraw(t *testing.T) {
 	m := mapFrom("9x9.png")
 	out := drawGrid(m, NewRect(0, 0, 0, 0))
@@ -184,6 +374,143 @@ func TestAroundMiss(t *testing.T) {
 	})
 }
 
+func TestFlood(t *testing.T) {
+	m := NewGrid(9, 9)
+	m.WriteAt(1, 0, Value(0x2)) // Swamp
+	m.WriteAt(0, 2, Value(0xff))
+
+	costs := make(map[Point]uint32)
+	m.Flood(At(0, 0), 3, costOfSwamp, func(p Point, tile Tile[string], cost uint32, prev Point) {
+		assert.Equal(t, p, tile.Point())
+		if p.Equal(At(0, 0)) {
+			assert.Equal(t, p, prev)
+		} else {
+			assert.Equal(t, costs[prev]+uint32(costOfSwamp(tile.Value())), cost)
+		}
+
+		costs[p] = cost
+	})
+
+	assert.Equal(t, map[Point]uint32{
+		At(0, 0): 0,
+		At(0, 1): 1,
+		At(1, 1): 2,
+		At(2, 1): 3,
+		At(1, 2): 3,
+		At(1, 0): 3, // Swamp
+	}, costs)
+}
+
+func TestFloodOrder(t *testing.T) {
+	m := mapFrom("9x9.png")
+
+	var last uint32
+	var tiles []string
+	m.Flood(At(2, 2), 3, costOf, func(p Point, _ Tile[string], cost uint32, _ Point) {
+		assert.GreaterOrEqual(t, cost, last)
+		last = cost
+		tiles = append(tiles, p.String())
+	})
+
+	assert.ElementsMatch(t, []string{
+		"2,2", "2,1", "2,3", "1,2", "3,1",
+		"1,1", "1,3", "3,3", "4,3", "3,4",
+	}, tiles)
+}
+
+func TestFloodBudget(t *testing.T) {
+	m := NewGrid(90, 90)
+
+	// The costs go beyond the range of the bucket frontier, and the budget beyond the
+	// size of the map
+	var last uint32
+	count := 0
+	m.Flood(At(0, 0), math.MaxUint32, costOf, func(p Point, _ Tile[string], cost uint32, _ Point) {
+		assert.GreaterOrEqual(t, cost, last)
+		assert.Equal(t, uint32(p.X)+uint32(p.Y), cost)
+		last = cost
+		count++
+	})
+	assert.Equal(t, 90*90, count)
+}
+
+func TestFloodMiss(t *testing.T) {
+	m := mapFrom("9x9.png")
+	m.Flood(At(20, 20), 3, costOf, func(Point, Tile[string], uint32, Point) {
+		t.Fail()
+	})
+}
+
+func TestFrontier(t *testing.T) {
+	h := newFrontier()
+	for i := 0; i < 1000; i++ {
+		h.Push(uint32(i), rand(i)*1000)
+	}
+
+	// Must pop in the order of priority, even beyond 64 buckets
+	last := uint32(0)
+	for i := 0; i < 500; i++ {
+		v := h.Pop()
+		assert.GreaterOrEqual(t, rand(int(v))*1000, last)
+		last = rand(int(v)) * 1000
+	}
+
+	// Pushing with a lower priority than the last popped is monotone
+	h.Push(5000, 0)
+	assert.Equal(t, uint32(5000), h.Pop())
+
+	// Reset the queue
+	h.Reset()
+	assert.True(t, h.IsEmpty())
+	assert.Equal(t, uint32(0), h.Pop())
+}
+
+func TestPathOptimal(t *testing.T) {
+	for _, name := range []string{"9x9.png", "300x300.png"} {
+		m := mapFrom(name)
+
+		// Collect all of the passable tiles
+		var open []Point
+		m.Each(func(p Point, tile Tile[string]) {
+			if costOf(tile.Value()) > 0 {
+				open = append(open, p)
+			}
+		})
+
+		for i := 0; i < 20; i++ {
+			from := open[int(rand(i*7))*len(open)/256]
+			goal := open[int(rand(i*13+1))*len(open)/256]
+
+			// Four-directional path
+			expect := dijkstra(m, from, goal, FourWay, DiagonalAlways)
+			path, dist, found := m.Path(from, goal, costOf)
+			assert.Equal(t, expect >= 0, found)
+			if found {
+				assert.Equal(t, expect, dist, "%v: %v -> %v", name, from, goal)
+				assert.Equal(t, dist, len(path)-1)
+			}
+
+			// Eight-directional path, for every policy
+			for _, policy := range []DiagonalPolicy{DiagonalAlways, DiagonalNoSqueeze, DiagonalNoCorners} {
+				expect := dijkstra(m, from, goal, EightWay, policy)
+				path, dist, found := m.PathDiagonal(from, goal, costOf, policy)
+				assert.Equal(t, expect >= 0, found)
+				if found {
+					assert.Equal(t, expect, dist, "%v: %v -> %v", name, from, goal)
+					assertDiagonal(t, m, path, policy)
+				}
+			}
+
+			// Cost-bounded flood, with a budget that is large enough to reach everything
+			m.Flood(from, 1000000, costOf, func(p Point, _ Tile[string], cost uint32, _ Point) {
+				if p.Equal(goal) {
+					assert.Equal(t, dijkstra(m, from, goal, FourWay, DiagonalAlways), int(cost))
+				}
+			})
+		}
+	}
+}
+
 /*
 cpu: 13th Gen Intel(R) Core(TM) i7-13700K
 BenchmarkHeap-24    	  240228	      5076 ns/op	    6016 B/op	      68 allocs/op
@@ -219,6 +546,18 @@ func costOf(tile Value) uint16 {
 	return 1
 }
 
+// Cost estimation function, with swamps
+func costOfSwamp(tile Value) uint16 {
+	switch {
+	case tile&1 != 0:
+		return 0 // Blocked
+	case tile == 0x2:
+		return 3 // Swamp
+	default:
+		return 1
+	}
+}
+
 // mapFrom creates a map from ASCII string
 func mapFrom(name string) *Grid[string] {
 	f, err := os.Open("fixtures/" + name)
@@ -276,6 +615,96 @@ func plotPath(m *Grid[string], path []Point) string {
 	return sb.String()
 }
 
+// dijkstra computes the reference cost of the shortest path, or -1 if unreachable
+func dijkstra(m *Grid[string], from, goal Point, neighbors Neighborhood, policy DiagonalPolicy) int {
+	blocked := func(p Point) bool {
+		tile, ok := m.At(p.X, p.Y)
+		return !ok || costOf(tile.Value()) == 0
+	}
+
+	dist := map[Point]int{from: 0}
+	done := map[Point]bool{}
+	queue := &reference{{from, 0}}
+	for queue.Len() > 0 {
+		next := heap.Pop(queue).(edge)
+		current, best := next.Point, int(next.Cost)
+		switch {
+		case done[current]:
+			continue
+		case current.Equal(goal):
+			return best
+		}
+
+		done[current] = true
+		for dir := North; dir <= NorthWest; dir++ {
+			next := current.Move(dir)
+			if blocked(next) {
+				continue
+			}
+
+			cost := 1
+			switch {
+			case neighbors == FourWay && dir%2 == 1:
+				continue
+			case neighbors == EightWay && dir%2 == 0:
+				cost = costStraight
+			case neighbors == EightWay:
+				a, b := blocked(current.Move(dir-1)), blocked(current.Move((dir+1)%8))
+				if (policy == DiagonalNoSqueeze && a && b) || (policy == DiagonalNoCorners && (a || b)) {
+					continue
+				}
+				cost = costDiagonal
+			}
+
+			if d, ok := dist[next]; !ok || best+cost < d {
+				dist[next] = best + cost
+				heap.Push(queue, edge{Point: next, Cost: uint32(best + cost)})
+			}
+		}
+	}
+	return -1
+}
+
+// reference is a simple binary heap for the reference implementation
+type reference []edge
+
+func (h reference) Len() int           { return len(h) }
+func (h reference) Less(i, j int) bool { return h[i].Cost < h[j].Cost }
+func (h reference) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *reference) Push(x any)        { *h = append(*h, x.(edge)) }
+func (h *reference) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// assertDiagonal validates that the path is continuous and respects the policy
+func assertDiagonal(t *testing.T, m *Grid[string], path []Point, policy DiagonalPolicy) {
+	blocked := func(x, y int16) bool {
+		tile, ok := m.At(x, y)
+		return !ok || costOf(tile.Value()) == 0
+	}
+
+	for i := 1; i < len(path); i++ {
+		prev, next := path[i-1], path[i]
+		dx, dy := next.X-prev.X, next.Y-prev.Y
+		assert.True(t, abs(int32(dx)) <= 1 && abs(int32(dy)) <= 1, "path is not continuous")
+		assert.False(t, blocked(next.X, next.Y), "path crosses a blocked tile")
+		if dx == 0 || dy == 0 {
+			continue
+		}
+
+		a, b := blocked(prev.X+dx, prev.Y), blocked(prev.X, prev.Y+dy)
+		switch policy {
+		case DiagonalNoSqueeze:
+			assert.False(t, a && b, "path squeezes between blocked tiles")
+		case DiagonalNoCorners:
+			assert.False(t, a || b, "path cuts a blocked corner")
+		}
+	}
+}
+
 // pointInPath returns whether a point is part of a path or not
 func pointInPath(point Point, path []Point) bool {
 	for _, p := range path {
@@ -0,0 +1,183 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+// Anchor represents the part of the grid which stays in place when it is resized.
+type Anchor uint8
+
+// Various anchors of the grid
+const (
+	AnchorNorthWest Anchor = iota
+	AnchorNorth
+	AnchorNorthEast
+	AnchorWest
+	AnchorCenter
+	AnchorEast
+	AnchorSouthWest
+	AnchorSouth
+	AnchorSouthEast
+)
+
+// String returns a string representation of an anchor
+func (a Anchor) String() string {
+	switch a {
+	case AnchorNorthWest:
+		return "NW"
+	case AnchorNorth:
+		return "N"
+	case AnchorNorthEast:
+		return "NE"
+	case AnchorWest:
+		return "W"
+	case AnchorCenter:
+		return "C"
+	case AnchorEast:
+		return "E"
+	case AnchorSouthWest:
+		return "SW"
+	case AnchorSouth:
+		return "S"
+	case AnchorSouthEast:
+		return "SE"
+	default:
+		return ""
+	}
+}
+
+// offset returns by how many pages the existing pages are moved, given the difference
+// in the number of pages on each of the axes.
+func (a Anchor) offset(grow Point) Point {
+	var out Point
+	switch a % 3 {
+	case 1:
+		out.X = grow.X / 2
+	case 2:
+		out.X = grow.X
+	}
+
+	switch a / 3 {
+	case 1:
+		out.Y = grow.Y / 2
+	case 2:
+		out.Y = grow.Y
+	}
+	return out
+}
+
+// resizeObserver represents an observer which depends on the size of the grid, and is
+// resized along with it, given the previous size and the offset of the existing tiles.
+type resizeObserver interface {
+	onResize(prev, moved Point)
+}
+
+// Resize changes the size of the grid, which can both grow and shrink. The width and
+// height must be both multiples of 3. The anchor specifies which part of the existing
+// grid stays in place, for example with AnchorNorthWest the new tiles are added to the
+// east and to the south, while with AnchorSouthEast the existing tiles move towards
+// south-east. The existing pages, along with their objects, are kept as long as they
+// are still within the grid and the active snapshots are left untouched.
+//
+// The views keep their subscriptions and their viewports, which are not moved. Each view
+// receives an update for each tile of its viewport which was added to the grid and, when
+// the existing tiles are moved, for each of the tiles of its viewport as well.
+//
+// The hierarchies, as well as the fog of war attached to the views, are resized along
+// with the grid before any of the views is notified. Resize must not be called
+// concurrently with any other operation on the grid. The tiles which were returned
+// before, as well as the flow fields and distance maps built on the grid, which keep
+// covering its previous size, must be recreated once it is resized.
+func (m *Grid[T]) Resize(width, height int16, anchor Anchor) {
+	width, height = width/3, height/3
+
+	// Make sure the snapshots have their own copy of every page, since the pages are
+	// about to move, and detach them from the grid.
+	m.snapMu.Lock()
+	for i := range m.pages {
+		m.preserve(&m.pages[i], false)
+	}
+	m.snaps.Store(nil)
+	m.snapMu.Unlock()
+
+	prev, prevWidth, prevSize := m.pages, m.pageWidth, m.Size
+	shift := anchor.offset(At(width-m.pageWidth, height-m.pageHeight))
+	pages := make([]page[T], int(width)*int(height))
+	for i := range pages {
+		at := At(int16(i%int(width)), int16(i/int(width)))
+		dst := &pages[i]
+		dst.point = at.MultiplyScalar(3)
+
+		// Move the existing page, if any
+		from := at.Subtract(shift)
+		if from.X >= 0 && from.Y >= 0 && from.X < m.pageWidth && from.Y < m.pageHeight {
+			src := &prev[int(from.X)+int(prevWidth)*int(from.Y)]
+			dst.tiles = src.tiles
+			dst.state = src.state
+		}
+	}
+
+	m.pages = pages
+	m.pageWidth = width
+	m.pageHeight = height
+	m.Size = At(width*3, height*3)
+	if m.wrap.X != 0 {
+		m.wrap.X = m.Size.X
+	}
+	if m.wrap.Y != 0 {
+		m.wrap.Y = m.Size.Y
+	}
+	m.observers.wrap = m.wrap
+
+	// Resize the observers which depend on the size of the grid first, since they are
+	// about to receive the updates of the resized grid.
+	moved := shift.MultiplyScalar(3)
+	views := m.observers.unsubscribeAll()
+	resize := func(sub Observer[T]) {
+		if r, ok := sub.(resizeObserver); ok {
+			r.onResize(prevSize, moved)
+		}
+	}
+	for _, view := range views {
+		resize(view)
+	}
+	m.observers.all.Each(resize)
+
+	// Subscribe the views to the pages within their viewports again, since the grid
+	// might now have more pages in their viewports.
+	for _, view := range views {
+		r := view.Viewport()
+		m.pagesWithin(r.Min, r.Max, func(page *page[T]) {
+			if m.intersects(r, page.Bounds()) {
+				m.observers.Subscribe(page.point, view)
+			}
+		})
+	}
+
+	for i := range m.pages {
+		m.pages[i].SetObserved(m.observers.Observed(m.pages[i].point))
+	}
+
+	// Notify the views of the tiles which were added or moved
+	for _, view := range views {
+		r := view.Viewport()
+		m.Within(r.Min, r.Max, func(p Point, tile Tile[T]) {
+			added := !p.Subtract(moved).WithinSize(prevSize)
+			if !added && moved == (Point{}) {
+				return // Neither added nor moved
+			}
+
+			before := Value(0)
+			if p.WithinSize(prevSize) {
+				page := &prev[int(p.X/3)+int(prevWidth)*int(p.Y/3)]
+				before = page.tileAt(uint8((p.Y%3)*3 + (p.X % 3)))
+			}
+
+			view.onUpdate(&Update[T]{
+				Old:  ValueAt{Point: p, Value: before},
+				New:  ValueAt{Point: p, Value: tile.Value()},
+				Seq:  m.seq.Add(1),
+				Kind: ValueChanged,
+			})
+		})
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+cpu: Intel(R) Xeon(R) Processor
+BenchmarkResize/resize      	     265	   4842622 ns/op	 4202465 B/op	       1 allocs/op
+*/
+func BenchmarkResize(b *testing.B) {
+	m := NewGrid(768, 768)
+
+	b.Run("resize", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			m.Resize(768+int16(n%2)*3, 768, AnchorNorthWest)
+		}
+	})
+}
+
+func TestResize(t *testing.T) {
+	m := NewGrid(9, 9)
+	m.WriteAt(1, 1, Value(1))
+	m.WriteAt(8, 8, Value(8))
+	tile, _ := m.At(8, 8)
+	tile.Add("A")
+
+	// Grow towards south-east
+	m.Resize(15, 12, AnchorNorthWest)
+	assert.Equal(t, At(15, 12), m.Size)
+	assert.Equal(t, Value(1), m.valueAt(1, 1))
+	assert.Equal(t, Value(8), m.valueAt(8, 8))
+
+	tile, _ = m.At(8, 8)
+	assert.Equal(t, []string{"A"}, objectsOf(tile))
+
+	// The new tiles can be written
+	m.WriteAt(14, 11, Value(2))
+	tile, ok := m.At(14, 11)
+	assert.True(t, ok)
+	assert.Equal(t, Value(2), tile.Value())
+
+	// Shrink, dropping the tiles outside of the grid
+	m.Resize(6, 6, AnchorNorthWest)
+	assert.Equal(t, At(6, 6), m.Size)
+	assert.Equal(t, Value(1), m.valueAt(1, 1))
+	_, ok = m.At(8, 8)
+	assert.False(t, ok)
+
+	count := 0
+	m.Each(func(p Point, tile Tile[string]) {
+		count++
+	})
+	assert.Equal(t, 36, count)
+}
+
+func TestResizeAnchor(t *testing.T) {
+	tests := []struct {
+		anchor Anchor
+		expect Point
+	}{
+		{AnchorNorthWest, At(1, 1)},
+		{AnchorNorth, At(4, 1)},
+		{AnchorNorthEast, At(7, 1)},
+		{AnchorWest, At(1, 4)},
+		{AnchorCenter, At(4, 4)},
+		{AnchorEast, At(7, 4)},
+		{AnchorSouthWest, At(1, 7)},
+		{AnchorSouth, At(4, 7)},
+		{AnchorSouthEast, At(7, 7)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.anchor.String(), func(t *testing.T) {
+			m := NewGrid(9, 9)
+			m.WriteAt(1, 1, Value(1))
+			tile, _ := m.At(1, 1)
+			tile.Add("A")
+
+			m.Resize(15, 15, tc.anchor)
+			assert.Equal(t, Value(1), m.valueAt(tc.expect.X, tc.expect.Y))
+
+			tile, _ = m.At(tc.expect.X, tc.expect.Y)
+			assert.Equal(t, []string{"A"}, objectsOf(tile))
+
+			// Shrinking back restores the grid
+			m.Resize(9, 9, tc.anchor)
+			assert.Equal(t, Value(1), m.valueAt(1, 1))
+		})
+	}
+}
+
+func TestResizeView(t *testing.T) {
+	m := NewGrid(9, 9)
+	m.WriteAt(7, 7, Value(1))
+
+	v := NewView(m, "view 1")
+	v.Resize(NewRect(6, 6, 12, 12), nil)
+	defer v.Close()
+
+	// The view is told about the new tiles in its viewport
+	m.Resize(12, 12, AnchorNorthWest)
+	assert.Len(t, v.Inbox, 27)
+	for len(v.Inbox) > 0 {
+		ev := <-v.Inbox
+		assert.False(t, ev.New.WithinSize(At(9, 9)))
+		assert.Zero(t, ev.New.Value)
+	}
+
+	// And keeps receiving the updates, including of the new tiles
+	m.WriteAt(7, 7, Value(2))
+	m.WriteAt(10, 10, Value(3))
+	assert.Equal(t, Value(2), (<-v.Inbox).New.Value)
+	assert.Equal(t, Value(3), (<-v.Inbox).New.Value)
+
+	// Moving the tiles notifies about every tile of the viewport
+	m.Resize(9, 9, AnchorSouthEast)
+	assert.Len(t, v.Inbox, 9)
+	for len(v.Inbox) > 0 {
+		ev := <-v.Inbox
+		assert.Equal(t, m.valueAt(ev.New.X, ev.New.Y), ev.New.Value)
+		if ev.New.Point == At(7, 7) {
+			assert.Equal(t, Value(2), ev.Old.Value)
+			assert.Equal(t, Value(3), ev.New.Value)
+		}
+	}
+
+	// The pages outside of the viewport are not observed
+	m.WriteAt(0, 0, Value(1))
+	assert.Len(t, v.Inbox, 0)
+	assert.False(t, m.pageAt(0, 0).IsObserved())
+	assert.True(t, m.pageAt(2, 2).IsObserved())
+}
+
+func TestResizeSnapshot(t *testing.T) {
+	m := NewGrid(9, 9)
+	m.WriteAt(1, 1, Value(1))
+	s := m.Snapshot()
+	defer s.Close()
+
+	m.Resize(15, 15, AnchorSouthEast)
+	m.WriteAt(7, 7, Value(2))
+
+	tile, _ := s.At(1, 1)
+	assert.Equal(t, Value(1), tile.Value())
+	assert.Equal(t, At(9, 9), s.Size)
+	assert.Nil(t, m.snaps.Load())
+}
+
+func TestResizeWrap(t *testing.T) {
+	m := NewGrid(9, 9, WithWrap(true, false))
+	m.Resize(12, 12, AnchorNorthWest)
+	m.WriteAt(11, 0, Value(1))
+
+	tile, ok := m.At(-1, 0)
+	assert.True(t, ok)
+	assert.Equal(t, Value(1), tile.Value())
+
+	_, ok = m.At(0, -1)
+	assert.False(t, ok)
+}
+
+func TestResizeFog(t *testing.T) {
+	m := NewGrid(9, 9)
+	fog := NewFog(m, 1)
+	fog.Update(0, opaque, Sight{At(1, 1), 1})
+
+	v := NewView(m, "view 1")
+	v.Resize(NewRect(0, 0, 18, 18), nil)
+	v.SetFog(fog, 0)
+	defer v.Close()
+
+	// The fog moves along with the tiles, and the view only sees the visible ones
+	m.Resize(18, 18, AnchorSouthEast)
+	assert.Equal(t, At(18, 18), fog.size)
+	assert.True(t, fog.IsVisible(0, 10, 10))
+	assert.True(t, fog.IsExplored(0, 10, 10))
+	assert.False(t, fog.IsVisible(0, 1, 1))
+	assert.NotEmpty(t, v.Inbox)
+	for len(v.Inbox) > 0 {
+		ev := <-v.Inbox
+		assert.True(t, fog.IsVisible(0, ev.New.X, ev.New.Y))
+	}
+
+	// The new tiles can be revealed
+	fog.Update(0, opaque, Sight{At(16, 16), 1})
+	assert.True(t, fog.IsVisible(0, 16, 17))
+	assert.False(t, fog.IsVisible(0, 10, 10))
+	assert.True(t, fog.IsExplored(0, 10, 10))
+}
+
+func TestResizeHierarchy(t *testing.T) {
+	m := NewGrid(9, 9)
+	h := NewHierarchy(m, 1, costOf)
+	defer h.Close()
+
+	_, dist, found := h.Path(At(0, 0), At(8, 8))
+	assert.True(t, found)
+	assert.Equal(t, 16, dist)
+
+	// The hierarchy keeps observing the new tiles, and finds the paths across them
+	m.Resize(18, 18, AnchorNorthWest)
+	m.WriteAt(17, 16, Value(1))
+	_, dist, found = h.Path(At(0, 0), At(17, 17))
+	assert.True(t, found)
+	assert.Equal(t, 34, dist)
+
+	m.WriteAt(16, 17, Value(1))
+	_, _, found = h.Path(At(0, 0), At(17, 17))
+	assert.False(t, found)
+}
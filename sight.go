@@ -0,0 +1,219 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+// FieldOfView iterates over every tile which is visible from the origin within a radius,
+// given a predicate which returns whether a tile blocks the sight. It uses symmetric
+// shadowcasting, so a tile is visible from the origin if and only if the origin is
+// visible from the tile. Opaque tiles which are lit are visible themselves, while the
+// tiles outside of the grid block the sight. Each visible tile is visited exactly once.
+func (m *Grid[T]) FieldOfView(origin Point, radius int16, opaque func(Value) bool, fn func(Point, Tile[T])) {
+	origin = m.wrapPoint(origin)
+	tile, ok := m.At(origin.X, origin.Y)
+	if !ok || radius < 0 {
+		return
+	}
+
+	fn(origin, tile)
+	s := shadowcast{
+		size:   m.Size,
+		origin: origin,
+		radius: radius,
+	}
+
+	// East and west are scanned last, since they need to know which of the diagonals
+	// were already revealed by north and south.
+	for _, quadrant := range [4]Direction{North, South, East, West} {
+		s.quadrant = quadrant
+		m.castShadows(&s, 1, slope{-1, 1}, slope{1, 1}, opaque, fn)
+	}
+}
+
+// castShadows scans a row of a quadrant between two slopes, and recursively scans the
+// next rows which are not entirely in the shadow.
+func (m *Grid[T]) castShadows(s *shadowcast, depth int, start, end slope, opaque func(Value) bool, fn func(Point, Tile[T])) {
+	if depth > int(s.radius) {
+		return
+	}
+
+	// The tiles of the row, with the ties rounded towards the center of the row
+	lo := floorDiv(2*depth*start.num+start.den, 2*start.den)
+	hi := -floorDiv(-(2*depth*end.num - end.den), 2*end.den)
+
+	wasWall, wasFloor := false, false
+	for col := lo; col <= hi; col++ {
+		at := s.pointOf(depth, col)
+		wall := !at.WithinSize(m.Size) || opaque(m.valueAt(at.X, at.Y))
+		if (wall || (col*start.den >= depth*start.num && col*end.den <= depth*end.num)) && s.reveal(at, depth, col) {
+			tile, _ := m.At(at.X, at.Y)
+			fn(at, tile)
+		}
+
+		switch {
+		case wasWall && !wall:
+			start = slope{2*col - 1, 2 * depth}
+		case wasFloor && wall:
+			m.castShadows(s, depth+1, start, slope{2*col - 1, 2 * depth}, opaque, fn)
+		}
+
+		wasWall, wasFloor = wall, !wall
+	}
+
+	if wasFloor {
+		m.castShadows(s, depth+1, start, end, opaque, fn)
+	}
+}
+
+// slope represents a rational slope of a shadow, the denominator is always positive.
+type slope struct {
+	num, den int
+}
+
+// shadowcast represents the state of the field of view computation, within one of the
+// four quadrants around the origin.
+type shadowcast struct {
+	size     Point     // The size of the grid
+	origin   Point     // The origin of the field of view
+	radius   int16     // The radius of the field of view
+	quadrant Direction // The quadrant being scanned
+	reach    [4]int    // The depth up to which each of the diagonals was revealed
+}
+
+// pointOf returns the point of a tile given its depth and column within the quadrant
+func (s *shadowcast) pointOf(depth, col int) Point {
+	x, y := int(s.origin.X), int(s.origin.Y)
+	switch s.quadrant {
+	case North:
+		return At(int16(x+col), int16(y-depth))
+	case South:
+		return At(int16(x+col), int16(y+depth))
+	case East:
+		return At(int16(x+depth), int16(y+col))
+	default:
+		return At(int16(x-depth), int16(y+col))
+	}
+}
+
+// reveal returns whether a lit tile should be revealed, if it is within the grid and
+// the radius. The diagonals are shared between the quadrants and each of them is
+// revealed up to some depth by north and south, so east and west only reveal the tiles
+// beyond it.
+func (s *shadowcast) reveal(at Point, depth, col int) bool {
+	if !at.WithinSize(s.size) || depth*depth+col*col > int(s.radius)*int(s.radius) {
+		return false
+	}
+
+	if col == depth || col == -depth {
+		corner := 0
+		if at.X > s.origin.X {
+			corner |= 1
+		}
+		if at.Y > s.origin.Y {
+			corner |= 2
+		}
+
+		switch {
+		case s.quadrant == North || s.quadrant == South:
+			s.reach[corner] = depth
+		case depth <= s.reach[corner]:
+			return false // Already revealed
+		}
+	}
+	return true
+}
+
+// floorDiv returns the quotient of the division rounded towards negative infinity
+func floorDiv(a, b int) int {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
+
+// Raycast walks a straight line from one point to another, using Bresenham's algorithm,
+// and stops at the first tile which is blocked according to the predicate. It returns
+// the tiles crossed by the ray, including the blocking one, along with the blocking tile
+// and whether the ray was blocked. The origin itself never blocks the ray, while the ray
+// stops without being blocked when it leaves the grid.
+func (m *Grid[T]) Raycast(from, to Point, blocked func(Value) bool) ([]Point, Point, bool) {
+	path := make([]Point, 0, max(abs(int32(to.X)-int32(from.X)), abs(int32(to.Y)-int32(from.Y)))+1)
+	hit, found := Point{}, false
+	m.castRay(from, to, func(at Point, value Value) bool {
+		path = append(path, at)
+		if !at.Equal(from) && blocked(value) {
+			hit, found = at, true
+			return false
+		}
+		return true
+	})
+	return path, hit, found
+}
+
+// LineOfSight returns whether the two points can see each other, meaning that none of
+// the tiles between them are blocked according to the predicate. The points themselves
+// do not block the sight, and the result is the same in both directions.
+func (m *Grid[T]) LineOfSight(a, b Point, blocked func(Value) bool) bool {
+	if !a.WithinSize(m.Size) || !b.WithinSize(m.Size) {
+		return false
+	}
+
+	// Always walk in the same direction, since the line is not symmetric
+	if b.Y < a.Y || (b.Y == a.Y && b.X < a.X) {
+		a, b = b, a
+	}
+
+	visible := true
+	m.castRay(a, b, func(at Point, value Value) bool {
+		if !at.Equal(a) && !at.Equal(b) && blocked(value) {
+			visible = false
+		}
+		return visible
+	})
+	return visible
+}
+
+// castRay walks a line between two points and calls the function for every tile of the
+// grid along the way, until it returns false. The page is only looked up when the line
+// crosses into a different one.
+func (m *Grid[T]) castRay(from, to Point, fn func(Point, Value) bool) {
+	x, y := int32(from.X), int32(from.Y)
+	x1, y1 := int32(to.X), int32(to.Y)
+	dx, dy := int32(abs(x1-x)), -int32(abs(y1-y))
+	sx, sy := int32(1), int32(1)
+	if x > x1 {
+		sx = -1
+	}
+	if y > y1 {
+		sy = -1
+	}
+
+	var page *page[T]
+	px, py := int32(-1), int32(-1)
+	for err := dx + dy; ; {
+		at := At(int16(x), int16(y))
+		if !at.WithinSize(m.Size) {
+			return // Left the grid
+		}
+
+		if x/3 != px || y/3 != py {
+			px, py = x/3, y/3
+			page = m.pageAt(int16(px), int16(py))
+		}
+
+		if !fn(at, page.tileAt(uint8((y%3)*3+x%3))) || (x == x1 && y == y1) {
+			return
+		}
+
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y += sy
+		}
+	}
+}
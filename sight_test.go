@@ -0,0 +1,230 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+cpu: Intel(R) Xeon(R) Processor
+BenchmarkFieldOfView/r=10         	  343862	      3764 ns/op	       0 B/op	       0 allocs/op
+BenchmarkFieldOfView/r=30         	  260505	      5114 ns/op	       0 B/op	       0 allocs/op
+BenchmarkRaycast/raycast          	  214478	      5455 ns/op	    1152 B/op	       1 allocs/op
+BenchmarkRaycast/los              	  446672	      2588 ns/op	       0 B/op	       0 allocs/op
+*/
+func BenchmarkFieldOfView(b *testing.B) {
+	m := mapFrom("300x300.png")
+	for _, radius := range []int16{10, 30} {
+		b.Run(fmt.Sprintf("r=%d", radius), func(b *testing.B) {
+			count := 0
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				m.FieldOfView(At(115, 20), radius, opaque, func(p Point, tile Tile[string]) {
+					count++
+				})
+			}
+		})
+	}
+}
+
+func BenchmarkRaycast(b *testing.B) {
+	m := NewGrid(300, 300)
+	b.Run("raycast", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			m.Raycast(At(10, 20), At(290, 270), opaque)
+		}
+	})
+
+	b.Run("los", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			m.LineOfSight(At(10, 20), At(290, 270), opaque)
+		}
+	})
+}
+
+func TestFieldOfView(t *testing.T) {
+	m := NewGrid(9, 9)
+	visible := fieldOfView(m, At(4, 4), 3)
+
+	// Every tile within the radius is visible exactly once
+	assert.Len(t, visible, 29)
+	for p, count := range visible {
+		assert.Equal(t, 1, count, "%v visited %d times", p, count)
+		assert.LessOrEqual(t, int(p.X-4)*int(p.X-4)+int(p.Y-4)*int(p.Y-4), 9)
+	}
+}
+
+func TestFieldOfViewWalls(t *testing.T) {
+	m := NewGrid(9, 9)
+	m.WriteAt(4, 2, Value(0xff))
+	m.WriteAt(6, 4, Value(0xff))
+	visible := fieldOfView(m, At(4, 4), 4)
+
+	// Walls are visible, but not the tiles behind them
+	assert.Contains(t, visible, At(4, 2))
+	assert.Contains(t, visible, At(6, 4))
+	assert.NotContains(t, visible, At(4, 1))
+	assert.NotContains(t, visible, At(4, 0))
+	assert.NotContains(t, visible, At(7, 4))
+	assert.NotContains(t, visible, At(8, 4))
+
+	// Tiles beside the walls are still visible
+	assert.Contains(t, visible, At(3, 1))
+	assert.Contains(t, visible, At(7, 2))
+	for p, count := range visible {
+		assert.Equal(t, 1, count, "%v visited %d times", p, count)
+	}
+}
+
+func TestFieldOfViewSymmetric(t *testing.T) {
+	m := mapFrom("300x300.png")
+	sees := func(from, to Point) bool {
+		_, ok := fieldOfView(m, from, 12)[to]
+		return ok
+	}
+
+	for i := 0; i < 200; i++ {
+		from := At(int16(rand(i*7)), int16(rand(i*13+1)))
+		if opaque(m.valueAt(from.X, from.Y)) {
+			continue
+		}
+
+		// If a floor tile is visible from the origin, the origin is visible from it
+		for to, count := range fieldOfView(m, from, 12) {
+			assert.Equal(t, 1, count, "%v visited %d times", to, count)
+			if !opaque(m.valueAt(to.X, to.Y)) {
+				assert.True(t, sees(to, from), "%v sees %v, but not the other way", from, to)
+			}
+		}
+	}
+}
+
+func TestFieldOfViewMiss(t *testing.T) {
+	m := NewGrid(9, 9)
+
+	// Outside of the grid
+	assert.Len(t, fieldOfView(m, At(-1, 4), 3), 0)
+	assert.Len(t, fieldOfView(m, At(4, 4), -1), 0)
+
+	// Only the origin itself
+	visible := fieldOfView(m, At(0, 0), 0)
+	assert.Len(t, visible, 1)
+	assert.Contains(t, visible, At(0, 0))
+
+	// Clipped by the corner of the grid
+	assert.Len(t, fieldOfView(m, At(0, 0), 2), 6)
+}
+
+func TestFieldOfViewAllocs(t *testing.T) {
+	m := mapFrom("300x300.png")
+	count := 0
+	allocs := testing.AllocsPerRun(100, func() {
+		m.FieldOfView(At(115, 20), 20, opaque, func(p Point, tile Tile[string]) {
+			count++
+		})
+	})
+	assert.Zero(t, allocs)
+	assert.NotZero(t, count)
+}
+
+func TestRaycast(t *testing.T) {
+	m := NewGrid(9, 9)
+	m.WriteAt(5, 3, Value(0xff))
+
+	// Ray is blocked by the wall
+	path, hit, found := m.Raycast(At(1, 1), At(8, 4), opaque)
+	assert.True(t, found)
+	assert.Equal(t, At(5, 3), hit)
+	assert.Equal(t, []Point{At(1, 1), At(2, 1), At(3, 2), At(4, 2), At(5, 3)}, path)
+
+	// Ray reaches its destination
+	path, _, found = m.Raycast(At(1, 1), At(1, 4), opaque)
+	assert.False(t, found)
+	assert.Equal(t, []Point{At(1, 1), At(1, 2), At(1, 3), At(1, 4)}, path)
+
+	// Ray stops at the edge of the grid
+	path, _, found = m.Raycast(At(6, 6), At(12, 12), opaque)
+	assert.False(t, found)
+	assert.Equal(t, []Point{At(6, 6), At(7, 7), At(8, 8)}, path)
+
+	// The origin never blocks the ray
+	path, _, found = m.Raycast(At(5, 3), At(5, 5), opaque)
+	assert.False(t, found)
+	assert.Len(t, path, 3)
+}
+
+func TestRaycastContinuous(t *testing.T) {
+	m := NewGrid(300, 300)
+	for i := 0; i < 100; i++ {
+		from := At(int16(rand(i*7)), int16(rand(i*13+1)))
+		to := At(int16(rand(i*3+5)), int16(rand(i*11+2)))
+
+		// Every step moves to one of the eight neighbors
+		path, _, found := m.Raycast(from, to, opaque)
+		assert.False(t, found)
+		assert.Equal(t, from, path[0])
+		assert.Equal(t, to, path[len(path)-1])
+		for j := 1; j < len(path); j++ {
+			dx, dy := path[j].X-path[j-1].X, path[j].Y-path[j-1].Y
+			assert.True(t, dx >= -1 && dx <= 1 && dy >= -1 && dy <= 1 && (dx != 0 || dy != 0))
+		}
+	}
+}
+
+func TestLineOfSight(t *testing.T) {
+	m := mapFrom("300x300.png")
+	for i := 0; i < 200; i++ {
+		a := At(int16(rand(i*7)), int16(rand(i*13+1)))
+		b := At(int16(rand(i*3+5)), int16(rand(i*11+2)))
+
+		// Symmetric, and the same as a ray between the points
+		visible := m.LineOfSight(a, b, opaque)
+		assert.Equal(t, visible, m.LineOfSight(b, a, opaque))
+		if b.Y > a.Y || (b.Y == a.Y && b.X > a.X) {
+			_, hit, found := m.Raycast(a, b, opaque)
+			assert.Equal(t, visible, !found || hit == b, "%v -> %v", a, b)
+		}
+	}
+
+	// The end points do not block the sight
+	g := NewGrid(9, 9)
+	g.WriteAt(1, 1, Value(0xff))
+	g.WriteAt(7, 1, Value(0xff))
+	assert.True(t, g.LineOfSight(At(1, 1), At(7, 1), opaque))
+
+	g.WriteAt(4, 1, Value(0xff))
+	assert.False(t, g.LineOfSight(At(1, 1), At(7, 1), opaque))
+	assert.False(t, g.LineOfSight(At(1, 1), At(-1, 1), opaque))
+}
+
+func TestLineOfSightAllocs(t *testing.T) {
+	m := mapFrom("300x300.png")
+	allocs := testing.AllocsPerRun(100, func() {
+		m.LineOfSight(At(115, 20), At(160, 270), opaque)
+	})
+	assert.Zero(t, allocs)
+}
+
+// opaque returns whether a tile of the test fixtures blocks the sight
+func opaque(v Value) bool {
+	return costOf(v) == 0
+}
+
+// fieldOfView returns how many times each of the tiles was visited
+func fieldOfView(m *Grid[string], from Point, radius int16) map[Point]int {
+	visible := make(map[Point]int)
+	m.FieldOfView(from, radius, opaque, func(p Point, tile Tile[string]) {
+		visible[p]++
+	})
+	return visible
+}
@@ -0,0 +1,252 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"io"
+	"iter"
+	"maps"
+	"slices"
+	"sync/atomic"
+)
+
+// Snapshot represents a point-in-time, read-only copy of a grid. The read API of the
+// grid is available on the snapshot, while the writers keep going on the live grid and
+// the changes they make are not visible in the snapshot. The tiles of a snapshot can
+// not be modified, and any attempt to write them is ignored.
+type Snapshot[T comparable] struct {
+	grid *Grid[T] // The pages of the snapshot
+	Size Point    // The map size
+}
+
+// Snapshot takes a consistent, point-in-time snapshot of the grid. The pages are copied
+// lazily: the live grid copies a page into the snapshot right before it is modified for
+// the first time, and the snapshot copies the pages which were not modified as they are
+// first read, so only the pages which were either modified or read take memory. The
+// writes which are concurrent to the snapshot are either entirely in or out of it, in
+// the order they happened. The snapshot must be closed once it is no longer needed, so
+// that the writers stop copying the pages for it.
+func (m *Grid[T]) Snapshot() *Snapshot[T] {
+	snap := &Grid[T]{
+		copies:     make([]atomic.Pointer[page[T]], len(m.pages)),
+		pageWidth:  m.pageWidth,
+		pageHeight: m.pageHeight,
+		wrap:       m.wrap,
+		origin:     m,
+		Size:       m.Size,
+	}
+	snap.observers.wrap = m.wrap
+
+	// Publish the snapshot, so that the writers start copying the pages for it
+	m.snapMu.Lock()
+	var active []*Grid[T]
+	if prev := m.snaps.Load(); prev != nil {
+		active = slices.Clone(*prev)
+	}
+	active = append(active, snap)
+	m.snaps.Store(&active)
+	m.snapMu.Unlock()
+
+	return &Snapshot[T]{grid: snap, Size: snap.Size}
+}
+
+// Close releases the snapshot, so that the live grid no longer copies its pages. The
+// snapshot must not be used after being closed.
+func (s *Snapshot[T]) Close() error {
+	m := s.grid.origin
+	m.snapMu.Lock()
+	defer m.snapMu.Unlock()
+
+	prev := m.snaps.Load()
+	if prev == nil {
+		return nil
+	}
+
+	active := slices.DeleteFunc(slices.Clone(*prev), func(g *Grid[T]) bool {
+		return g == s.grid
+	})
+
+	switch len(active) {
+	case 0:
+		m.snaps.Store(nil)
+	default:
+		m.snaps.Store(&active)
+	}
+	return nil
+}
+
+// At returns the tile at a specified position.
+func (s *Snapshot[T]) At(x, y int16) (Tile[T], bool) {
+	return s.grid.At(x, y)
+}
+
+// Each iterates over all of the tiles in the map.
+func (s *Snapshot[T]) Each(fn func(Point, Tile[T])) {
+	s.grid.Each(fn)
+}
+
+// Within selects the tiles within a specifid bounding box which is specified by
+// north-west and south-east coordinates.
+func (s *Snapshot[T]) Within(nw, se Point, fn func(Point, Tile[T])) {
+	s.grid.Within(nw, se, fn)
+}
+
+// Neighbors iterates over the direct neighbouring tiles.
+func (s *Snapshot[T]) Neighbors(x, y int16, fn func(Point, Tile[T])) {
+	s.grid.Neighbors(x, y, fn)
+}
+
+// All returns an iterator over all of the tiles in the map.
+func (s *Snapshot[T]) All() iter.Seq2[Point, Tile[T]] {
+	return s.grid.All()
+}
+
+// InRect returns an iterator over the tiles within a rectangle.
+func (s *Snapshot[T]) InRect(r Rect) iter.Seq2[Point, Tile[T]] {
+	return s.grid.InRect(r)
+}
+
+// NeighborsOf returns an iterator over the direct neighbouring tiles of a point.
+func (s *Snapshot[T]) NeighborsOf(p Point) iter.Seq2[Point, Tile[T]] {
+	return s.grid.NeighborsOf(p)
+}
+
+// Around performs a breadth first search around a point, see Grid.Around().
+func (s *Snapshot[T]) Around(from Point, distance uint32, costOf costFn, fn func(Point, Tile[T])) {
+	s.grid.Around(from, distance, costOf, fn)
+}
+
+// Reachable returns an iterator over the tiles reachable from a point, see
+// Grid.Reachable().
+func (s *Snapshot[T]) Reachable(from Point, distance uint32, costOf costFn) iter.Seq2[Point, Tile[T]] {
+	return s.grid.Reachable(from, distance, costOf)
+}
+
+// Flood explores the tiles within a cost budget from a point, see Grid.Flood().
+func (s *Snapshot[T]) Flood(from Point, budget uint32, costOf costFn, fn func(at Point, tile Tile[T], cost uint32, prev Point)) {
+	s.grid.Flood(from, budget, costOf, fn)
+}
+
+// Path calculates a short path and the distance between the two locations, see
+// Grid.Path().
+func (s *Snapshot[T]) Path(from, to Point, costOf costFn) ([]Point, int, bool) {
+	return s.grid.Path(from, to, costOf)
+}
+
+// PathDiagonal calculates a short path with diagonal moves, see Grid.PathDiagonal().
+func (s *Snapshot[T]) PathDiagonal(from, to Point, costOf costFn, policy DiagonalPolicy) ([]Point, int, bool) {
+	return s.grid.PathDiagonal(from, to, costOf, policy)
+}
+
+// PathWith calculates a short path with the specified options, see Grid.PathWith().
+func (s *Snapshot[T]) PathWith(from, to Point, costOf costFn, opts PathOptions) ([]Point, int, bool) {
+	return s.grid.PathWith(from, to, costOf, opts)
+}
+
+// PathJPS calculates a short path using the jump point search, see Grid.PathJPS().
+func (s *Snapshot[T]) PathJPS(from, to Point, costOf costFn) ([]Point, int, bool) {
+	return s.grid.PathJPS(from, to, costOf)
+}
+
+// WriteTo writes the snapshot to a specific writer, in the same format as the grid.
+func (s *Snapshot[T]) WriteTo(dst io.Writer) (int64, error) {
+	return s.grid.WriteTo(dst)
+}
+
+// WriteFile writes the snapshot into a flate-compressed binary file.
+func (s *Snapshot[T]) WriteFile(filename string) error {
+	return s.grid.WriteFile(filename)
+}
+
+// ---------------------------------- Copy-on-Write ----------------------------------
+
+// copied returns a page of a snapshot, copying it from the live grid if it wasn't yet
+func (m *Grid[T]) copied(index int) *page[T] {
+	if p := m.copies[index].Load(); p != nil {
+		return p
+	}
+
+	live := &m.origin.pages[index]
+	m.origin.preserve(live, false)
+	if p := m.copies[index].Load(); p != nil {
+		return p
+	}
+
+	// The snapshot is no longer active, copy the page for it alone
+	live.Lock()
+	defer live.Unlock()
+	return m.copyFrom(index, live)
+}
+
+// copyAt returns a page of a snapshot at a given index, or nil if outside of the map
+func (m *Grid[T]) copyAt(index int) *page[T] {
+	if index >= 0 && index < len(m.copies) {
+		return m.copied(index)
+	}
+	return nil
+}
+
+// copyFrom copies a live page into the snapshot, unless it was already copied. The
+// live page must be locked.
+func (m *Grid[T]) copyFrom(index int, p *page[T]) *page[T] {
+	if dst := m.copies[index].Load(); dst != nil {
+		return dst
+	}
+
+	dst := &page[T]{point: p.point}
+	for i := range p.tiles {
+		dst.tiles[i] = p.tileAt(uint8(i))
+	}
+	if p.state != nil {
+		dst.state = maps.Clone(p.state)
+	}
+
+	m.copies[index].Store(dst)
+	return dst
+}
+
+// preserve copies a live page into every active snapshot which doesn't have its own
+// copy of the page yet. This must happen before the page is modified.
+func (m *Grid[T]) preserve(p *page[T], locked bool) {
+	snaps := m.snaps.Load()
+	if snaps == nil {
+		return
+	}
+
+	index := m.pageIndex(p.point)
+	if !slices.ContainsFunc(*snaps, func(s *Grid[T]) bool { return s.copies[index].Load() == nil }) {
+		return // Already copied everywhere
+	}
+
+	// The page lock serializes the copies with the writers of the page
+	if !locked {
+		p.Lock()
+		defer p.Unlock()
+	}
+
+	for _, s := range *snaps {
+		s.copyFrom(index, p)
+	}
+}
+
+// beginWrite copies the page into the active snapshots, before it gets modified
+func (p *page[T]) beginWrite(grid *Grid[T], locked bool) {
+	if grid.snaps.Load() != nil {
+		grid.preserve(p, locked)
+	}
+}
+
+// endWrite copies the page into the snapshots which were taken while a lock-free write
+// was in progress, so that the write is included in the snapshot unless a copy was
+// already made. Any write which happens after it sees the snapshot in beginWrite().
+func (p *page[T]) endWrite(grid *Grid[T]) {
+	if grid.snaps.Load() != nil {
+		grid.preserve(p, false)
+	}
+}
+
+// readOnly returns whether the grid is a snapshot, which can not be modified
+func (m *Grid[T]) readOnly() bool {
+	return m.origin != nil
+}
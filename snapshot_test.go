@@ -0,0 +1,285 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+cpu: Intel(R) Xeon(R) Processor
+BenchmarkSnapshot/snapshot  	   34197	     49883 ns/op	  524656 B/op	       7 allocs/op
+BenchmarkSnapshot/write     	58839158	        19.66 ns/op	       0 B/op	       0 allocs/op
+BenchmarkSnapshot/read      	146408506	         7.598 ns/op	       0 B/op	       0 allocs/op
+*/
+func BenchmarkSnapshot(b *testing.B) {
+	m := NewGrid(768, 768)
+
+	b.Run("snapshot", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			m.Snapshot().Close()
+		}
+	})
+
+	b.Run("write", func(b *testing.B) {
+		s := m.Snapshot()
+		defer s.Close()
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			m.WriteAt(int16(n%768), 100, Value(n))
+		}
+	})
+
+	b.Run("read", func(b *testing.B) {
+		s := m.Snapshot()
+		defer s.Close()
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			s.At(int16(n%768), 100)
+		}
+	})
+}
+
+func TestSnapshot(t *testing.T) {
+	m := NewGrid(9, 9)
+	m.WriteAt(1, 1, Value(1))
+	m.WriteAt(7, 7, Value(7))
+	tile, _ := m.At(1, 1)
+	tile.Add("A")
+
+	s := m.Snapshot()
+	defer s.Close()
+
+	// Keep writing on the live grid
+	m.WriteAt(1, 1, Value(2))
+	m.MaskAt(4, 4, Value(0xff), Value(0xff))
+	tile.Del("A")
+	tile.Add("B")
+
+	// The snapshot keeps the values at the time it was taken
+	at, ok := s.At(1, 1)
+	assert.True(t, ok)
+	assert.Equal(t, Value(1), at.Value())
+	assert.Equal(t, []string{"A"}, objectsOf(at))
+	at, _ = s.At(4, 4)
+	assert.Zero(t, at.Value())
+	at, _ = s.At(7, 7)
+	assert.Equal(t, Value(7), at.Value())
+
+	// While the live grid has moved on
+	at, _ = m.At(1, 1)
+	assert.Equal(t, Value(2), at.Value())
+	assert.Equal(t, []string{"B"}, objectsOf(at))
+
+	// Writes on the untouched pages after the first read are not visible either
+	m.WriteAt(7, 7, Value(8))
+	at, _ = s.At(7, 7)
+	assert.Equal(t, Value(7), at.Value())
+
+	count := 0
+	s.Each(func(p Point, tile Tile[string]) {
+		if tile.Value() != 0 {
+			count++
+		}
+	})
+	assert.Equal(t, 2, count)
+}
+
+func TestSnapshotPath(t *testing.T) {
+	m := mapFrom("9x9.png")
+	s := m.Snapshot()
+	defer s.Close()
+
+	// Block the path on the live grid only
+	for y := int16(0); y < 9; y++ {
+		m.WriteAt(4, y, Value(1))
+	}
+
+	_, _, found := m.Path(At(1, 1), At(7, 7), costOf)
+	assert.False(t, found)
+
+	path, dist, found := s.Path(At(1, 1), At(7, 7), costOf)
+	assert.True(t, found)
+	assert.Equal(t, 12, dist)
+	assert.Equal(t, At(7, 7), path[len(path)-1])
+}
+
+func TestSnapshotPathJPS(t *testing.T) {
+	m := NewGrid(9, 9)
+	for y := int16(0); y < 8; y++ {
+		m.WriteAt(4, y, Value(1))
+	}
+
+	// None of the pages was copied into the snapshot yet
+	s := m.Snapshot()
+	defer s.Close()
+
+	path, dist, found := s.PathJPS(At(1, 1), At(7, 1), costOf)
+	assert.True(t, found)
+	for _, p := range path {
+		assert.False(t, p.X == 4 && p.Y < 8, p.String())
+	}
+
+	_, expect, found := m.PathDiagonal(At(1, 1), At(7, 1), costOf, DiagonalNoCorners)
+	assert.True(t, found)
+	assert.Equal(t, expect, dist)
+}
+
+func TestSnapshotWriteTo(t *testing.T) {
+	m := NewGrid(30, 30)
+	m.Each(func(p Point, tile Tile[string]) {
+		tile.Write(Value(p.Integer()))
+	})
+
+	expect := bytes.NewBuffer(nil)
+	_, err := m.WriteTo(expect)
+	assert.NoError(t, err)
+
+	// Save a snapshot while the grid gets rewritten
+	s := m.Snapshot()
+	defer s.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m.Each(func(p Point, tile Tile[string]) {
+			tile.Write(0)
+		})
+	}()
+
+	output := bytes.NewBuffer(nil)
+	_, err = s.WriteTo(output)
+	assert.NoError(t, err)
+	assert.Equal(t, expect.Bytes(), output.Bytes())
+	wg.Wait()
+}
+
+func TestSnapshotMany(t *testing.T) {
+	m := NewGrid(9, 9)
+	m.WriteAt(0, 0, Value(1))
+	s1 := m.Snapshot()
+	defer s1.Close()
+
+	m.WriteAt(0, 0, Value(2))
+	s2 := m.Snapshot()
+	m.WriteAt(0, 0, Value(3))
+
+	v1, _ := s1.At(0, 0)
+	v2, _ := s2.At(0, 0)
+	v3, _ := m.At(0, 0)
+	assert.Equal(t, Value(1), v1.Value())
+	assert.Equal(t, Value(2), v2.Value())
+	assert.Equal(t, Value(3), v3.Value())
+
+	// Once all of the snapshots are closed, pages are no longer copied
+	assert.NoError(t, s2.Close())
+	assert.Len(t, *m.snaps.Load(), 1)
+	assert.NoError(t, s1.Close())
+	assert.Nil(t, m.snaps.Load())
+}
+
+func TestSnapshotReadOnly(t *testing.T) {
+	m := NewGrid(9, 9)
+	m.WriteAt(1, 1, Value(1))
+	tile, _ := m.At(1, 1)
+	tile.Add("A")
+
+	s := m.Snapshot()
+	defer s.Close()
+
+	// The writes through the tiles of the snapshot are ignored
+	at, _ := s.At(1, 1)
+	at.Write(2)
+	at.Mask(0xF0, 0xF0)
+	at.Merge(func(v Value) Value { return v + 1 })
+	assert.False(t, at.CompareAndSwap(1, 3))
+	at.Add("B")
+	at.Del("A")
+	assert.False(t, at.Move("A", At(2, 2)))
+
+	at, _ = s.At(1, 1)
+	assert.Equal(t, Value(1), at.Value())
+	assert.Equal(t, []string{"A"}, objectsOf(at))
+
+	// And so is the live grid
+	live, _ := m.At(1, 1)
+	assert.Equal(t, Value(1), live.Value())
+	assert.Equal(t, []string{"A"}, objectsOf(live))
+}
+
+func TestSnapshotSparse(t *testing.T) {
+	m := NewGrid(30, 30)
+	s := m.Snapshot()
+	defer s.Close()
+
+	copied := func() (n int) {
+		for i := range s.grid.copies {
+			if s.grid.copies[i].Load() != nil {
+				n++
+			}
+		}
+		return
+	}
+
+	// Only the pages which were either written or read are copied
+	assert.Nil(t, s.grid.pages)
+	assert.Zero(t, copied())
+	m.WriteAt(1, 1, Value(1))
+	assert.Equal(t, 1, copied())
+	s.At(29, 29)
+	assert.Equal(t, 2, copied())
+}
+
+func TestSnapshotConcurrent(t *testing.T) {
+	m := NewGrid(30, 30)
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+
+	// The writer always writes the first tile before the last one, so any consistent
+	// snapshot sees the first tile ahead or equal to the last one.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := Value(1); ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+				m.WriteAt(0, 0, i)
+				m.MergeAt(29, 29, func(Value) Value { return i })
+			}
+		}
+	}()
+
+	for i := 0; i < 1000; i++ {
+		s := m.Snapshot()
+		last, _ := s.At(29, 29)
+		first, _ := s.At(0, 0)
+		assert.GreaterOrEqual(t, first.Value(), last.Value())
+		s.Close()
+	}
+
+	close(done)
+	wg.Wait()
+}
+
+// objectsOf returns the objects of a tile
+func objectsOf(tile Tile[string]) (out []string) {
+	tile.Range(func(v string) error {
+		out = append(out, v)
+		return nil
+	})
+	return
+}
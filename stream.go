@@ -0,0 +1,279 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// ChunkStore represents a backing store for the chunks of a world, which allows the
+// world to only keep in memory the chunks which are in view.
+type ChunkStore interface {
+	// Load opens a chunk for reading. It returns an error which wraps fs.ErrNotExist
+	// if the chunk was never saved.
+	Load(at WorldPoint) (io.ReadCloser, error)
+
+	// Save opens a chunk for writing, which replaces the chunk once the writer is
+	// closed.
+	Save(at WorldPoint) (io.WriteCloser, error)
+}
+
+// WithChunkStore streams the chunks of the world from a backing store. The chunks are
+// loaded when a view moves over them or one of their tiles is accessed, and the chunks
+// which are no longer observed by any view are written back to the store and evicted
+// from memory by Evict(), after the grace period. Only the tiles are written to the
+// store, so the chunks which hold any object are kept in memory. The grace period is
+// also how long a tile returned by At() remains usable once its chunk is out of view.
+func WithChunkStore(store ChunkStore, grace time.Duration) Option {
+	return func(o *options) {
+		o.store = store
+		o.grace = grace
+	}
+}
+
+// Evict writes back the chunks which were neither observed by any view nor accessed
+// through At() for longer than the grace period to the store, and evicts them from
+// memory. The chunks which hold any object are never evicted, since the objects are not
+// written. It should be called periodically, for example on each tick of the server,
+// and returns the errors which occurred while loading or saving the chunks since the
+// previous call.
+func (w *World[T]) Evict() error {
+	if w.store == nil {
+		return nil
+	}
+
+	w.mu.Lock()
+	errs := w.errs
+	w.errs = nil
+	idle := w.idleChunks(time.Now())
+	w.mu.Unlock()
+
+	// Write the chunks back without locking the world, so that the other chunks can
+	// be loaded and observed in the meantime.
+	for _, c := range idle {
+		if err := w.evict(c.at, c.chunk); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// idleChunk represents a chunk which is about to be evicted
+type idleChunk[T comparable] struct {
+	at    WorldPoint // The position of the chunk
+	chunk *chunk[T]  // The chunk
+}
+
+// idleChunks returns the chunks which were idle for longer than the grace period, and
+// prevents the operations from pinning them until they are evicted or kept. The world
+// must be locked.
+func (w *World[T]) idleChunks(now time.Time) (out []idleChunk[T]) {
+	w.chunks.Range(func(key, value any) bool {
+		at, c := key.(WorldPoint), value.(*chunk[T])
+		switch {
+		case c.evicted.Load():
+			return true // Being evicted by another call
+		case c.used.Swap(false) || c.keep || c.observed() || c.occupied():
+			c.idle = time.Time{}
+			return true
+		case c.idle.IsZero():
+			c.idle = now
+		}
+
+		if now.Sub(c.idle) >= w.grace {
+			c.saving.Lock()
+			c.evicted.Store(true)
+			out = append(out, idleChunk[T]{at: at, chunk: c})
+		}
+		return true
+	})
+	return
+}
+
+// evict writes a chunk back to the store once the operations in progress on it are
+// done, and removes it from memory. The chunk is kept if an object was added to it or
+// a view started observing it in the meantime, or if it could not be written.
+func (w *World[T]) evict(at WorldPoint, c *chunk[T]) (err error) {
+	defer c.saving.Unlock()
+	for c.pins.Load() > 0 {
+		runtime.Gosched() // Only held for the duration of a single operation
+	}
+
+	if !c.occupied() {
+		err = w.save(at, c)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch {
+	case err != nil:
+		c.evicted.Store(false)
+	case c.occupied() || c.observed():
+		c.evicted.Store(false)
+		c.idle = time.Time{}
+	default:
+		w.chunks.Delete(at)
+	}
+	return err
+}
+
+// restore reads a chunk from the store, or returns nil if it is not in the store
+func (w *World[T]) restore(at WorldPoint) (*chunk[T], error) {
+	if w.store == nil {
+		return nil, nil
+	}
+
+	if _, ok := w.absent.Load(at); ok {
+		return nil, nil
+	}
+
+	src, err := w.store.Load(at)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		w.absent.Store(at, struct{}{})
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	defer src.Close()
+	c := &chunk[T]{Grid: NewGridOf[T](chunkSize, chunkSize)}
+	if err := readChunk(src, c.Grid); err != nil {
+		return nil, fmt.Errorf("tile: unable to load chunk %v, %w", at, err)
+	}
+	return c, nil
+}
+
+// save writes a chunk to the store
+func (w *World[T]) save(at WorldPoint, c *chunk[T]) error {
+	dst, err := w.store.Save(at)
+	if err != nil {
+		return err
+	}
+
+	if err := writeChunk(dst, c.Grid); err != nil {
+		dst.Close()
+		return fmt.Errorf("tile: unable to save chunk %v, %w", at, err)
+	}
+	return dst.Close()
+}
+
+// observed returns whether any of the pages of the chunk is observed
+func (c *chunk[T]) observed() bool {
+	for i := range c.pages {
+		if c.pages[i].IsObserved() {
+			return true
+		}
+	}
+	return false
+}
+
+// occupied returns whether any of the tiles of the chunk holds an object
+func (c *chunk[T]) occupied() bool {
+	for i := range c.pages {
+		p := &c.pages[i]
+		p.Lock()
+		count := len(p.state)
+		p.Unlock()
+		if count > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ---------------------------------- Directory ----------------------------------
+
+var _ ChunkStore = new(DirStore)
+
+// DirStore represents a chunk store which keeps each of the chunks in its own
+// flate-compressed file, within a local directory.
+type DirStore struct {
+	dir string // The directory of the chunks
+}
+
+// NewDirStore creates a new chunk store in a directory, creating it if necessary.
+func NewDirStore(dir string) (*DirStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &DirStore{dir: dir}, nil
+}
+
+// Load opens a chunk for reading.
+func (s *DirStore) Load(at WorldPoint) (io.ReadCloser, error) {
+	file, err := os.Open(s.pathOf(at))
+	if err != nil {
+		return nil, err
+	}
+
+	return &dirReader{
+		ReadCloser: flate.NewReader(file),
+		file:       file,
+	}, nil
+}
+
+// Save opens a chunk for writing. The chunk is written into a temporary file, which
+// replaces the chunk once the writer is closed.
+func (s *DirStore) Save(at WorldPoint) (io.WriteCloser, error) {
+	file, err := os.CreateTemp(s.dir, "chunk-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+
+	writer, err := flate.NewWriter(file, flate.BestSpeed)
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+
+	return &dirWriter{
+		Writer: writer,
+		file:   file,
+		path:   s.pathOf(at),
+	}, nil
+}
+
+// pathOf returns the path of the file of a chunk
+func (s *DirStore) pathOf(at WorldPoint) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%d_%d.chunk", at.X, at.Y))
+}
+
+// dirReader represents a reader of a chunk file
+type dirReader struct {
+	io.ReadCloser          // The decompressor
+	file          *os.File // The underlying file
+}
+
+// Close closes the decompressor and the file
+func (r *dirReader) Close() error {
+	return errors.Join(r.ReadCloser.Close(), r.file.Close())
+}
+
+// dirWriter represents a writer of a chunk file
+type dirWriter struct {
+	*flate.Writer          // The compressor
+	file          *os.File // The temporary file
+	path          string   // The path of the chunk file
+}
+
+// Close flushes the compressor and replaces the chunk file with the temporary one
+func (w *dirWriter) Close() error {
+	if err := errors.Join(w.Writer.Close(), w.file.Close()); err != nil {
+		os.Remove(w.file.Name())
+		return err
+	}
+
+	return os.Rename(w.file.Name(), w.path)
+}
@@ -0,0 +1,294 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+cpu: Intel(R) Xeon(R) Processor
+BenchmarkStream/write       	19512796	        67.50 ns/op	       0 B/op	       0 allocs/op
+BenchmarkStream/evict       	    2943	    472837 ns/op	  878264 B/op	      46 allocs/op
+*/
+func BenchmarkStream(b *testing.B) {
+	store, err := NewDirStore(b.TempDir())
+	assert.NoError(b, err)
+
+	b.Run("write", func(b *testing.B) {
+		w := NewWorld(0, WithChunkStore(store, time.Minute))
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			w.WriteAt(int32(n%200)-100, 20, Value(n%2)*2)
+		}
+	})
+
+	b.Run("evict", func(b *testing.B) {
+		w := NewWorld(0, WithChunkStore(store, 0))
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			w.WriteAt(10, 10, Value(n))
+			w.Evict()
+		}
+	})
+}
+
+func TestDirStore(t *testing.T) {
+	store, err := NewDirStore(t.TempDir())
+	assert.NoError(t, err)
+
+	_, err = store.Load(WorldAt(-1, 2))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	dst, err := store.Save(WorldAt(-1, 2))
+	assert.NoError(t, err)
+	_, err = dst.Write([]byte("hello"))
+	assert.NoError(t, err)
+
+	// Not visible until closed
+	_, err = store.Load(WorldAt(-1, 2))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.NoError(t, dst.Close())
+
+	src, err := store.Load(WorldAt(-1, 2))
+	assert.NoError(t, err)
+	data, err := io.ReadAll(src)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+	assert.NoError(t, src.Close())
+}
+
+func TestWorldEvict(t *testing.T) {
+	store, err := NewDirStore(t.TempDir())
+	assert.NoError(t, err)
+
+	w := NewWorld(7, WithChunkStore(store, 0))
+	w.WriteAt(-1, -1, 1)
+	w.WriteAt(100, 100, 2)
+	assert.Equal(t, 2, countChunks(w))
+
+	// The chunks are not observed, so they are written back and evicted
+	assert.NoError(t, w.Evict())
+	assert.Equal(t, 0, countChunks(w))
+
+	// Reading loads the chunk again
+	assert.Equal(t, Value(1), w.ValueAt(-1, -1))
+	assert.Equal(t, Value(7), w.ValueAt(-2, -1))
+	assert.Equal(t, 1, countChunks(w))
+
+	// Reading the chunks which were never written doesn't load anything
+	assert.Equal(t, Value(7), w.ValueAt(1000, 1000))
+	assert.Equal(t, 1, countChunks(w))
+
+	// A new world over the same store
+	other := NewWorld(7, WithChunkStore(store, 0))
+	assert.Equal(t, Value(2), other.ValueAt(100, 100))
+}
+
+func TestWorldEvictObjects(t *testing.T) {
+	store, err := NewDirStore(t.TempDir())
+	assert.NoError(t, err)
+
+	w := NewWorld(0, WithChunkStore(store, 0))
+	w.At(1, 1).Add("unit")
+	w.WriteAt(100, 100, 1)
+
+	// The chunk holding the object is kept, since the objects are not saved
+	assert.NoError(t, w.Evict())
+	assert.Equal(t, 1, countChunks(w))
+	assert.Equal(t, 1, w.At(1, 1).Count())
+
+	// Once the object is gone, the chunk can be evicted after the next call, since
+	// one of its tiles was just returned
+	w.At(1, 1).Del("unit")
+	assert.NoError(t, w.Evict())
+	assert.Equal(t, 1, countChunks(w))
+	assert.NoError(t, w.Evict())
+	assert.Equal(t, 0, countChunks(w))
+}
+
+func TestWorldEvictAt(t *testing.T) {
+	store, err := NewDirStore(t.TempDir())
+	assert.NoError(t, err)
+
+	// The tile remains usable through the next eviction
+	w := NewWorld(0, WithChunkStore(store, 0))
+	tile := w.At(1, 1)
+	assert.NoError(t, w.Evict())
+	tile.Write(5)
+	assert.Equal(t, Value(5), w.ValueAt(1, 1))
+
+	// Written back once the chunk is evicted
+	assert.NoError(t, w.Evict())
+	assert.Equal(t, 0, countChunks(w))
+	assert.Equal(t, Value(5), w.ValueAt(1, 1))
+}
+
+func TestWorldEvictUnlocked(t *testing.T) {
+	store, err := NewDirStore(t.TempDir())
+	assert.NoError(t, err)
+
+	slow := &slowStore{ChunkStore: store, saving: make(chan struct{}), resume: make(chan struct{})}
+	w := NewWorld(0, WithChunkStore(slow, 0))
+	w.WriteAt(1, 1, 1)
+
+	evicted := make(chan error)
+	go func() { evicted <- w.Evict() }()
+	<-slow.saving
+
+	// The other chunks are loaded and observed while the chunk is being saved
+	w.WriteAt(100, 100, 2)
+	v := NewWorldView(w, "view 1")
+	v.Resize(NewWorldRect(90, 90, 110, 110), nil)
+	assert.NoError(t, v.Close())
+
+	// The writers of the chunk being evicted wait for it, and load it again
+	written := make(chan struct{})
+	go func() {
+		w.WriteAt(1, 1, 3)
+		close(written)
+	}()
+
+	close(slow.resume)
+	assert.NoError(t, <-evicted)
+	<-written
+	assert.Equal(t, Value(3), w.ValueAt(1, 1))
+	assert.Equal(t, Value(2), w.ValueAt(100, 100))
+}
+
+func TestWorldEvictGrace(t *testing.T) {
+	store, err := NewDirStore(t.TempDir())
+	assert.NoError(t, err)
+
+	w := NewWorld(0, WithChunkStore(store, time.Hour))
+	w.WriteAt(1, 1, 1)
+	assert.NoError(t, w.Evict())
+	assert.Equal(t, 1, countChunks(w))
+	assert.False(t, w.resident(WorldAt(0, 0)).idle.IsZero())
+
+	// Observing the chunk again resets the grace period
+	v := NewWorldView(w, "view 1")
+	v.Resize(NewWorldRect(0, 0, 5, 5), nil)
+	assert.NoError(t, w.Evict())
+	assert.True(t, w.resident(WorldAt(0, 0)).idle.IsZero())
+	assert.NoError(t, v.Close())
+}
+
+func TestWorldEvictView(t *testing.T) {
+	store, err := NewDirStore(t.TempDir())
+	assert.NoError(t, err)
+
+	w := NewWorld(0, WithChunkStore(store, 0))
+	w.WriteAt(1, 1, 1)
+	w.WriteAt(100, 1, 2)
+
+	// The chunk in view is kept in memory
+	v := NewWorldView(w, "view 1")
+	defer v.Close()
+	v.Resize(NewWorldRect(0, 0, 5, 5), nil)
+	assert.NoError(t, w.Evict())
+	assert.Equal(t, 1, countChunks(w))
+	assert.NotNil(t, w.resident(WorldAt(0, 0)))
+
+	// Moving the view loads the chunk and observes it
+	count := 0
+	v.MoveAt(WorldAt(98, 0), func(p WorldPoint, tile Tile[string]) {
+		if tile.Value() != 0 {
+			count++
+		}
+	})
+	assert.Equal(t, 1, count)
+
+	w.WriteAt(100, 1, 3)
+	ev := <-v.Inbox
+	assert.Equal(t, Value(2), ev.Old.Value)
+	assert.Equal(t, Value(3), ev.New.Value)
+
+	// The chunk which is no longer in view is evicted
+	assert.NoError(t, w.Evict())
+	assert.Nil(t, w.resident(WorldAt(0, 0)))
+	assert.NotNil(t, w.resident(WorldAt(2, 0)))
+}
+
+func TestWorldEvictConcurrent(t *testing.T) {
+	store, err := NewDirStore(t.TempDir())
+	assert.NoError(t, err)
+
+	const writers, writes = 4, 500
+	w := NewWorld(0, WithChunkStore(store, 0))
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				assert.NoError(t, w.Evict())
+			}
+		}
+	}()
+
+	// None of the writes is lost while the chunk is evicted and loaded again
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < writes; n++ {
+				w.MergeAt(5, 5, func(v Value) Value { return v + 1 })
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(done)
+	<-stopped
+	assert.Equal(t, Value(writers*writes), w.ValueAt(5, 5))
+}
+
+func TestWorldLoadError(t *testing.T) {
+	errBroken := errors.New("broken")
+	w := NewWorld(7, WithChunkStore(brokenStore{errBroken}, 0))
+
+	// The chunk which can not be loaded reads as empty and is never written back
+	assert.Equal(t, Value(7), w.ValueAt(1, 1))
+	w.WriteAt(1, 1, 1)
+	assert.ErrorIs(t, w.Evict(), errBroken)
+	assert.Equal(t, 1, countChunks(w))
+	assert.NoError(t, w.Evict())
+}
+
+// brokenStore represents a chunk store which always fails
+type brokenStore struct {
+	err error
+}
+
+func (s brokenStore) Load(WorldPoint) (io.ReadCloser, error)  { return nil, s.err }
+func (s brokenStore) Save(WorldPoint) (io.WriteCloser, error) { return nil, s.err }
+
+// slowStore represents a chunk store which waits before saving the first chunk
+type slowStore struct {
+	ChunkStore
+	once   sync.Once
+	saving chan struct{}
+	resume chan struct{}
+}
+
+func (s *slowStore) Save(at WorldPoint) (io.WriteCloser, error) {
+	s.once.Do(func() {
+		close(s.saving)
+		<-s.resume
+	})
+	return s.ChunkStore.Save(at)
+}
@@ -4,11 +4,15 @@
 package tile
 
 import (
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
 )
 
-// Observer represents a tile update Observer.
+// Observer represents a tile update Observer. The observers of the tiles are either
+// views, which deliver the updates through their inbox, or observer functions which
+// receive the updates directly.
 type Observer[T comparable] interface {
 	Viewport() Rect
 	Resize(Rect, func(Point, Tile[T]))
@@ -23,10 +27,65 @@ type ValueAt struct {
 
 // Update represents a tile update notification.
 type Update[T comparable] struct {
-	Old ValueAt // Old tile + value
-	New ValueAt // New tile + value
-	Add T       // An object was added to the tile
-	Del T       // An object was removed from the tile
+	Old    ValueAt    // Old tile + value
+	New    ValueAt    // New tile + value
+	Add    T          // An object was added to the tile
+	Del    T          // An object was removed from the tile
+	Seq    uint64     // The sequence number of the update within the grid
+	Origin uint32     // The origin of the change, or zero if unknown
+	Kind   UpdateKind // The kind of the update
+}
+
+// tile returns the tile after the update, and the kind of the update
+func (ev *Update[T]) tile() (uint64, UpdateKind) {
+	return uint64(ev.New.Integer()), ev.Kind
+}
+
+// change returns the change of the tile
+func (ev *Update[T]) change() change[Point, T] {
+	return change[Point, T]{
+		old: ev.Old.Point, new: ev.New.Point,
+		prev: ev.Old.Value, next: ev.New.Value,
+		add: ev.Add, del: ev.Del,
+		kind: ev.Kind,
+	}
+}
+
+// merge merges a previous update of the same tile into the update
+func (ev *Update[T]) merge(prev *Update[T]) {
+	ev.Old = prev.Old
+}
+
+// UpdateKind represents a kind of update. The kinds are bit flags, so that the updates
+// which were applied by a batch carry BatchApplied along with the kind of the change,
+// the tiles revealed by the fog of war carry FogRevealed, and a set of kinds can be
+// combined together.
+type UpdateKind uint8
+
+// Various kinds of updates
+const (
+	ValueChanged  UpdateKind = 1 << iota // The value of the tile has changed
+	ObjectAdded                          // An object was added to the tile
+	ObjectRemoved                        // An object was removed from the tile
+	ObjectMoved                          // An object was moved from the old to the new tile
+	BatchApplied                         // The update was applied by a batch
+	FogRevealed                          // The tile was revealed by the fog of war
+)
+
+// Is returns whether the kind contains every one of the specified kinds.
+func (k UpdateKind) Is(kind UpdateKind) bool {
+	return k&kind == kind
+}
+
+// String returns the string representation of the kind.
+func (k UpdateKind) String() string {
+	var names []string
+	for i, name := range []string{"ValueChanged", "ObjectAdded", "ObjectRemoved", "ObjectMoved", "BatchApplied", "FogRevealed"} {
+		if k&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "|")
 }
 
 var _ Observer[string] = (*View[string, string])(nil)
@@ -34,20 +93,30 @@ var _ Observer[string] = (*View[string, string])(nil)
 // View represents a view which can monitor a collection of tiles. Type parameters
 // S and T are the state and tile types respectively.
 type View[S any, T comparable] struct {
-	Grid  *Grid[T]       // The associated map
-	Inbox chan Update[T] // The update inbox for the view
-	State S              // The state of the view
-	rect  atomic.Uint64  // The view box
+	outbox[Update[T], *Update[T], Point, T]
+	Grid   *Grid[T]                  // The associated map
+	Inbox  chan Update[T]            // The update inbox for the view
+	State  S                         // The state of the view
+	rect   atomic.Uint64             // The view box
+	fog    atomic.Pointer[fogOf[T]]  // The fog of war filtering the updates
+	filter atomic.Pointer[Filter[T]] // The filter of the updates, if any
 }
 
-// NewView creates a new view for a map with a given state. State can be anything
-// that is passed to the view and can be used to store additional information.
-func NewView[S any, T comparable](m *Grid[T], state S) *View[S, T] {
+// fogOf represents the fog of war of a faction, which a view is attached to.
+type fogOf[T comparable] struct {
+	fog     *Fog[T]
+	faction int
+}
+
+// NewView creates a new view for a map, either a Grid or a HexGrid, with a given state.
+// State can be anything that is passed to the view and can be used to store additional
+// information.
+func NewView[S any, T comparable](m tiled[T], state S, opts ...ViewOption) *View[S, T] {
 	v := &View[S, T]{
-		Grid:  m,
-		Inbox: make(chan Update[T], 32),
+		Grid:  m.tiles(),
 		State: state,
 	}
+	v.Inbox = v.open(newViewOptions(opts))
 	v.rect.Store(NewRect(-1, -1, -1, -1).pack())
 	return v
 }
@@ -59,41 +128,9 @@ func (v *View[S, T]) Viewport() Rect {
 
 // Resize resizes the viewport and notifies the observers of the changes.
 func (v *View[S, T]) Resize(view Rect, fn func(Point, Tile[T])) {
-	grid := v.Grid
+	view = v.Grid.wrapRect(view)
 	prev := unpackRect(v.rect.Swap(view.pack()))
-
-	for _, diff := range view.Difference(prev) {
-		if diff.IsZero() {
-			continue // Skip zero-value rectangles
-		}
-
-		grid.pagesWithin(diff.Min, diff.Max, func(page *page[T]) {
-			r := page.Bounds()
-			switch {
-
-			// Page is now in view
-			case view.Intersects(r) && !prev.Intersects(r):
-				if grid.observers.Subscribe(page.point, v) {
-					page.SetObserved(true) // Mark the page as being observed
-				}
-
-			// Page is no longer in view
-			case !view.Intersects(r) && prev.Intersects(r):
-				if grid.observers.Unsubscribe(page.point, v) {
-					page.SetObserved(false) // Mark the page as not being observed
-				}
-			}
-
-			// Callback for each new tile in the view
-			if fn != nil {
-				page.Each(v.Grid, func(p Point, tile Tile[T]) {
-					if view.Contains(p) && !prev.Contains(p) {
-						fn(p, tile)
-					}
-				})
-			}
-		})
-	}
+	v.Grid.observe(v, prev, view, fn)
 }
 
 // MoveTo moves the viewport towards a particular direction.
@@ -147,28 +184,90 @@ func (v *View[S, T]) MergeAt(x, y int16, tile, mask Value) {
 	v.Grid.MaskAt(x, y, tile, mask)
 }
 
+// SetFog attaches the view to the fog of war of a faction. The view then only receives
+// the updates of the tiles which are visible to the faction, as well as the tiles and
+// objects revealed when the fog lifts. Passing a nil fog detaches the view.
+func (v *View[S, T]) SetFog(fog *Fog[T], faction int) {
+	var next *fogOf[T]
+	if fog != nil {
+		next = &fogOf[T]{fog: fog, faction: faction}
+	}
+
+	if prev := v.fog.Swap(next); prev != nil {
+		prev.fog.detach(prev.faction, v)
+	}
+
+	if next != nil {
+		fog.attach(faction, v)
+	}
+}
+
 // Close closes the view and unsubscribes from everything.
 func (v *View[S, T]) Close() error {
-	r := v.Viewport()
-	v.Grid.pagesWithin(r.Min, r.Max, func(page *page[T]) {
-		if v.Grid.observers.Unsubscribe(page.point, v) {
-			page.SetObserved(false) // Mark the page as not being observed
-		}
-	})
+	v.close()
+
+	v.SetFog(nil, 0)
+	v.Grid.unobserve(v, v.Viewport())
 	return nil
 }
 
+// onResize occurs when the grid was resized, and moves the tiles of the fog of war the
+// view is attached to along with the tiles of the grid.
+func (v *View[S, T]) onResize(prev, moved Point) {
+	if fog := v.fog.Load(); fog != nil {
+		fog.fog.resize(prev, moved)
+	}
+}
+
 // onUpdate occurs when a tile has updated.
 func (v *View[S, T]) onUpdate(ev *Update[T]) {
-	v.Inbox <- *ev // (copy)
+	if fog := v.fog.Load(); fog != nil {
+		if ev = fog.fog.redact(fog.faction, ev); ev == nil {
+			return // Hidden by the fog of war
+		}
+	}
+
+	if filter := v.filter.Load(); filter != nil && !filter.allows(ev) {
+		return // Filtered out
+	}
+
+	v.send.Lock()
+	v.deliver(ev)
+	v.send.Unlock()
+}
+
+// onBatch occurs when several tiles were updated by a batch, and sends all of the
+// updates to the inbox without interleaving them with other updates. The updates
+// which are hidden or filtered out are removed from the slice in place.
+func (v *View[S, T]) onBatch(updates []Update[T]) {
+	fog, filter := v.fog.Load(), v.filter.Load()
+	group := updates[:0]
+	for i := range updates {
+		ev := &updates[i]
+		if fog != nil {
+			if ev = fog.fog.redact(fog.faction, ev); ev == nil {
+				continue // Hidden by the fog of war
+			}
+		}
+
+		if filter == nil || filter.allows(ev) {
+			group = append(group, *ev)
+		}
+	}
+
+	v.send.Lock()
+	defer v.send.Unlock()
+	v.deliverBatch(group)
 }
 
 // -----------------------------------------------------------------------------
 
 // Pubsub represents a publish/subscribe layer for observers.
 type pubsub[T comparable] struct {
-	m   sync.Map  // Concurrent map of observers
-	tmp sync.Pool // Temporary observer sets for notifications
+	m    sync.Map     // Concurrent map of observers
+	all  observers[T] // Observers of the entire map
+	tmp  sync.Pool    // Temporary observer sets for notifications
+	wrap Point        // The size of the axes which wrap around, or zero
 }
 
 // Subscribe registers an event listener on a system
@@ -182,10 +281,51 @@ func (p *pubsub[T]) Subscribe(page Point, sub Observer[T]) bool {
 	return v.(*observers[T]).Subscribe(sub)
 }
 
-// Unsubscribe deregisters an event listener from a system
+// Unsubscribe deregisters an event listener from a system, and returns whether the
+// page is no longer observed by anyone.
 func (p *pubsub[T]) Unsubscribe(page Point, sub Observer[T]) bool {
 	if v, ok := p.m.Load(page.Integer()); ok {
-		return v.(*observers[T]).Unsubscribe(sub)
+		return v.(*observers[T]).Unsubscribe(sub) && p.all.Count() == 0
+	}
+	return false
+}
+
+// SubscribeAll registers an event listener for every page of the map
+func (p *pubsub[T]) SubscribeAll(sub Observer[T]) bool {
+	return p.all.Subscribe(sub)
+}
+
+// UnsubscribeAll deregisters an event listener for every page of the map, and returns
+// whether there are no more listeners of the entire map.
+func (p *pubsub[T]) UnsubscribeAll(sub Observer[T]) bool {
+	return p.all.Unsubscribe(sub)
+}
+
+// unsubscribeAll deregisters the event listeners from all of the pages, and returns
+// each of the listeners once. The listeners of the entire map are kept.
+func (p *pubsub[T]) unsubscribeAll() []Observer[T] {
+	var out []Observer[T]
+	p.m.Range(func(key, value any) bool {
+		for _, sub := range value.(*observers[T]).subs {
+			if !slices.Contains(out, sub) {
+				out = append(out, sub)
+			}
+		}
+
+		p.m.Delete(key)
+		return true
+	})
+	return out
+}
+
+// Observed returns whether a page is observed by anyone
+func (p *pubsub[T]) Observed(page Point) bool {
+	if p.all.Count() > 0 {
+		return true
+	}
+
+	if v, ok := p.m.Load(page.Integer()); ok {
+		return v.(*observers[T]).Count() > 0
 	}
 	return false
 }
@@ -194,7 +334,7 @@ func (p *pubsub[T]) Unsubscribe(page Point, sub Observer[T]) bool {
 func (p *pubsub[T]) Notify1(ev *Update[T], page Point) {
 	p.Each1(func(sub Observer[T]) {
 		viewport := sub.Viewport()
-		if viewport.Contains(ev.New.Point) || viewport.Contains(ev.Old.Point) {
+		if wrapContains(viewport, ev.New.Point, p.wrap) || wrapContains(viewport, ev.Old.Point, p.wrap) {
 			sub.onUpdate(ev)
 		}
 	}, page)
@@ -204,7 +344,7 @@ func (p *pubsub[T]) Notify1(ev *Update[T], page Point) {
 func (p *pubsub[T]) Notify2(ev *Update[T], pages [2]Point) {
 	p.Each2(func(sub Observer[T]) {
 		viewport := sub.Viewport()
-		if viewport.Contains(ev.New.Point) || viewport.Contains(ev.Old.Point) {
+		if wrapContains(viewport, ev.New.Point, p.wrap) || wrapContains(viewport, ev.Old.Point, p.wrap) {
 			sub.onUpdate(ev)
 		}
 	}, pages)
@@ -217,6 +357,8 @@ func (p *pubsub[T]) Each1(fn func(sub Observer[T]), page Point) {
 			fn(sub)
 		})
 	}
+
+	p.all.Each(fn)
 }
 
 // Each2 iterates over each observer in a page
@@ -234,6 +376,11 @@ func (p *pubsub[T]) Each2(fn func(sub Observer[T]), pages [2]Point) {
 		}
 	}
 
+	// Observers of the entire map
+	p.all.Each(func(sub Observer[T]) {
+		targets[sub] = struct{}{}
+	})
+
 	// Invoke the callback for each observer, once
 	for sub := range targets {
 		fn(sub)
@@ -256,19 +403,29 @@ func newObservers[T comparable]() *observers[T] {
 	}
 }
 
-// Each iterates over each observer
+// Each iterates over each observer. The lock is not held while the observers are
+// notified, so that an observer which is slow to receive the update does not prevent
+// the others from subscribing or unsubscribing.
 func (s *observers[T]) Each(fn func(sub Observer[T])) {
 	if s == nil {
 		return
 	}
 
 	s.Lock()
-	defer s.Unlock()
-	for _, sub := range s.subs {
+	subs := s.subs
+	s.Unlock()
+	for _, sub := range subs {
 		fn(sub)
 	}
 }
 
+// Count returns the number of observers
+func (s *observers[T]) Count() int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.subs)
+}
+
 // Subscribe registers an event listener on a system
 func (s *observers[T]) Subscribe(sub Observer[T]) bool {
 	s.Lock()
@@ -282,7 +439,8 @@ func (s *observers[T]) Unsubscribe(sub Observer[T]) bool {
 	s.Lock()
 	defer s.Unlock()
 
-	clean := s.subs[:0]
+	// Copy the observers, since they might be iterated over at the same time
+	clean := make([]Observer[T], 0, len(s.subs))
 	for _, o := range s.subs {
 		if o != sub {
 			clean = append(clean, o)
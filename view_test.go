@@ -119,6 +119,8 @@ func TestUpdates_Simple(t *testing.T) {
 			Point: At(5, 5),
 			Value: Value(0xF0),
 		},
+		Seq:  1,
+		Kind: ValueChanged,
 	}, <-v.Inbox)
 
 	// Add an object to an observed tile
@@ -132,7 +134,9 @@ func TestUpdates_Simple(t *testing.T) {
 			Point: At(5, 5),
 			Value: Value(0xF0),
 		},
-		Add: "A",
+		Add:  "A",
+		Seq:  2,
+		Kind: ObjectAdded,
 	}, <-v.Inbox)
 
 	// Delete an object from an observed tile
@@ -146,7 +150,9 @@ func TestUpdates_Simple(t *testing.T) {
 			Point: At(5, 5),
 			Value: Value(0xF0),
 		},
-		Del: "A",
+		Del:  "A",
+		Seq:  3,
+		Kind: ObjectRemoved,
 	}, <-v.Inbox)
 
 	// Mask a tile in view
@@ -160,6 +166,8 @@ func TestUpdates_Simple(t *testing.T) {
 			Point: At(5, 5),
 			Value: Value(0xFF),
 		},
+		Seq:  4,
+		Kind: ValueChanged,
 	}, <-v.Inbox)
 
 	// Merge a tile in view
@@ -175,11 +183,15 @@ func TestUpdates_Simple(t *testing.T) {
 			Point: At(5, 5),
 			Value: Value(0xAA),
 		},
+		Seq:  5,
+		Kind: ValueChanged,
 	}, <-v.Inbox)
 }
 
 func TestMove_Within(t *testing.T) {
 	m := mapFrom("300x300.png")
+	src, _ := m.At(5, 5)
+	src.Add("A")
 	c := counter(0)
 	v := NewView(m, "view 1")
 	v.Resize(NewRect(0, 0, 10, 10), c.count)
@@ -195,13 +207,17 @@ func TestMove_Within(t *testing.T) {
 		New: ValueAt{
 			Point: At(6, 6),
 		},
-		Del: "A",
-		Add: "A",
+		Del:  "A",
+		Add:  "A",
+		Seq:  1,
+		Kind: ObjectMoved,
 	}, <-v.Inbox)
 }
 
 func TestMove_Incoming(t *testing.T) {
 	m := mapFrom("300x300.png")
+	src, _ := m.At(20, 20)
+	src.Add("A")
 	c := counter(0)
 	v := NewView(m, "view 1")
 	v.Resize(NewRect(0, 0, 10, 10), c.count)
@@ -216,13 +232,17 @@ func TestMove_Incoming(t *testing.T) {
 		New: ValueAt{
 			Point: At(5, 5),
 		},
-		Del: "A",
-		Add: "A",
+		Del:  "A",
+		Add:  "A",
+		Seq:  1,
+		Kind: ObjectMoved,
 	}, <-v.Inbox)
 }
 
 func TestMove_Outgoing(t *testing.T) {
 	m := mapFrom("300x300.png")
+	src, _ := m.At(5, 5)
+	src.Add("A")
 	c := counter(0)
 	v := NewView(m, "view 1")
 	v.Resize(NewRect(0, 0, 10, 10), c.count)
@@ -237,8 +257,10 @@ func TestMove_Outgoing(t *testing.T) {
 		New: ValueAt{
 			Point: At(20, 20),
 		},
-		Del: "A",
-		Add: "A",
+		Del:  "A",
+		Add:  "A",
+		Seq:  1,
+		Kind: ObjectMoved,
 	}, <-v.Inbox)
 }
 
@@ -290,14 +312,18 @@ func TestView_Updates(t *testing.T) {
 	v := NewView(m, "view 1")
 	v.Resize(NewRect(10, 10, 15, 15), nil)
 
+	seq := uint64(0)
 	move := func(x1, y1, x2, y2 int16) {
 		at, _ := m.At(x1, y1)
+		at.data.addObject(m, at.idx, "A") // Place it without notifying
 		at.Move("A", At(x2, y2))
 
+		seq++
 		assert.Equal(t, Update[string]{
 			Old: ValueAt{Point: At(x1, y1)},
 			New: ValueAt{Point: At(x2, y2)},
 			Del: "A", Add: "A",
+			Seq: seq, Kind: ObjectMoved,
 		}, <-v.Inbox)
 	}
 
@@ -322,7 +348,61 @@ func TestView_Updates(t *testing.T) {
 }
 
 func TestSizeUpdate(t *testing.T) {
-	assert.Equal(t, 24, int(unsafe.Sizeof(Update[uint32]{})))
+	assert.Equal(t, 40, int(unsafe.Sizeof(Update[uint32]{})))
+}
+
+func TestUpdateKind(t *testing.T) {
+	assert.Equal(t, "ValueChanged", ValueChanged.String())
+	assert.Equal(t, "ObjectAdded|BatchApplied", (ObjectAdded | BatchApplied).String())
+	assert.Equal(t, "", UpdateKind(0).String())
+	assert.True(t, (ObjectMoved | BatchApplied).Is(ObjectMoved))
+	assert.False(t, ObjectMoved.Is(ObjectMoved|BatchApplied))
+}
+
+func TestUpdateObjectZero(t *testing.T) {
+	m := NewGridOf[uint32](9, 9)
+	v := NewView(m, "view 1")
+	v.Resize(NewRect(0, 0, 9, 9), nil)
+	defer v.Close()
+
+	// The entity with a zero identifier is not mistaken for a change of the value
+	tile, _ := m.At(1, 1)
+	tile.Add(0)
+	tile.Move(0, At(2, 2))
+	tile, _ = m.At(2, 2)
+	tile.Del(0)
+	m.WriteAt(2, 2, 1)
+
+	for i, kind := range []UpdateKind{ObjectAdded, ObjectMoved, ObjectRemoved, ValueChanged} {
+		ev := <-v.Inbox
+		assert.Equal(t, kind, ev.Kind)
+		assert.Equal(t, uint64(i+1), ev.Seq)
+	}
+}
+
+func TestUpdateOrigin(t *testing.T) {
+	m := NewGrid(9, 9)
+	v := NewView(m, "view 1")
+	v.Resize(NewRect(0, 0, 9, 9), nil)
+	defer v.Close()
+
+	// Every change made through the tile carries its origin
+	tile, _ := m.At(1, 1)
+	player := tile.WithOrigin(7)
+	player.Write(1)
+	player.Mask(2, 0xF)
+	player.CompareAndSwap(2, 3)
+	player.Add("A")
+	player.Move("A", At(2, 2))
+	moved, _ := m.At(2, 2)
+	moved.WithOrigin(7).Del("A")
+	for i := 0; i < 6; i++ {
+		assert.Equal(t, uint32(7), (<-v.Inbox).Origin)
+	}
+
+	// While the tile itself is not tagged
+	tile.Write(4)
+	assert.Zero(t, (<-v.Inbox).Origin)
 }
 
 // ---------------------------------- Mocks ----------------------------------
@@ -0,0 +1,770 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/kelindar/iostream"
+)
+
+// chunkSize is the number of tiles on each side of a chunk of the world
+const chunkSize = 48
+
+// WorldPoint represents a 2D coordinate within a world.
+type WorldPoint struct {
+	X int32 // X coordinate
+	Y int32 // Y coordinate
+}
+
+// WorldAt creates a new world point at a specified x,y coordinate.
+func WorldAt(x, y int32) WorldPoint {
+	return WorldPoint{X: x, Y: y}
+}
+
+// String returns string representation of a point.
+func (p WorldPoint) String() string {
+	return fmt.Sprintf("%v,%v", p.X, p.Y)
+}
+
+// Integer returns a packed 64-bit integer representation of a point.
+func (p WorldPoint) Integer() uint64 {
+	return uint64(uint32(p.X))<<32 | uint64(uint32(p.Y))
+}
+
+// Add adds two points together.
+func (p WorldPoint) Add(p2 WorldPoint) WorldPoint {
+	return WorldPoint{p.X + p2.X, p.Y + p2.Y}
+}
+
+// Subtract subtracts the second point from the first.
+func (p WorldPoint) Subtract(p2 WorldPoint) WorldPoint {
+	return WorldPoint{p.X - p2.X, p.Y - p2.Y}
+}
+
+// offset returns the world point of a point relative to this one
+func (p WorldPoint) offset(local Point) WorldPoint {
+	return WorldPoint{p.X + int32(local.X), p.Y + int32(local.Y)}
+}
+
+// WorldRect represents a rectangle within a world.
+type WorldRect struct {
+	Min WorldPoint // Top left point of the rectangle
+	Max WorldPoint // Bottom right point of the rectangle
+}
+
+// NewWorldRect creates a new rectangle
+// left,top,right,bottom correspond to x1,y1,x2,y2
+func NewWorldRect(left, top, right, bottom int32) WorldRect {
+	return WorldRect{Min: WorldAt(left, top), Max: WorldAt(right, bottom)}
+}
+
+// Contains returns whether a point is within the rectangle or not.
+func (a WorldRect) Contains(p WorldPoint) bool {
+	return a.Min.X <= p.X && p.X < a.Max.X && a.Min.Y <= p.Y && p.Y < a.Max.Y
+}
+
+// WorldValueAt represents a tile of a world and its value.
+type WorldValueAt struct {
+	WorldPoint // The point of the tile
+	Value      // The value of the tile
+}
+
+// WorldUpdate represents a tile update notification of a world.
+type WorldUpdate[T comparable] struct {
+	Old    WorldValueAt // Old tile + value
+	New    WorldValueAt // New tile + value
+	Add    T            // An object was added to the tile
+	Del    T            // An object was removed from the tile
+	Seq    uint64       // The sequence number of the update within its chunk
+	Origin uint32       // The origin of the change, or zero if unknown
+	Kind   UpdateKind   // The kind of the update
+}
+
+// tile returns the tile after the update, and the kind of the update
+func (ev *WorldUpdate[T]) tile() (uint64, UpdateKind) {
+	return ev.New.Integer(), ev.Kind
+}
+
+// change returns the change of the tile
+func (ev *WorldUpdate[T]) change() change[WorldPoint, T] {
+	return change[WorldPoint, T]{
+		old: ev.Old.WorldPoint, new: ev.New.WorldPoint,
+		prev: ev.Old.Value, next: ev.New.Value,
+		add: ev.Add, del: ev.Del,
+		kind: ev.Kind,
+	}
+}
+
+// merge merges a previous update of the same tile into the update
+func (ev *WorldUpdate[T]) merge(prev *WorldUpdate[T]) {
+	ev.Old = prev.Old
+}
+
+// ---------------------------------- World ----------------------------------
+
+// World represents an unbounded 2D tile map, addressed with 32-bit coordinates. The
+// world is composed of chunks of 48x48 tiles which are only allocated once one of
+// their tiles is written, while the tiles of the chunks which were never allocated
+// have the default value of the world.
+type World[T comparable] struct {
+	mu     sync.Mutex         // Protects the loading of the chunks and the views
+	chunks sync.Map           // The chunks in memory, by their position
+	absent sync.Map           // The chunks which are known to not be in the store
+	views  []worldObserver[T] // The views of the world
+	errs   []error            // The errors which occurred while loading the chunks
+	store  ChunkStore         // The backing store of the chunks, if any
+	grace  time.Duration      // The grace period before evicting the chunks
+	fill   Value              // The value of the tiles which were never written
+}
+
+// chunk represents a chunk of the world which is in memory
+type chunk[T comparable] struct {
+	*Grid[T]
+	pins    atomic.Int32 // The number of operations in progress on the chunk
+	used    atomic.Bool  // Whether a tile was returned by At() since the last eviction
+	evicted atomic.Bool  // Whether the chunk is being evicted
+	saving  sync.Mutex   // Held while the chunk is being evicted
+	idle    time.Time    // Since when the chunk is not observed, protected by the world
+	keep    bool         // Whether the chunk is kept in memory, since it failed to load
+}
+
+// worldObserver represents a view of the world, which observes the chunks in view
+type worldObserver[T comparable] interface {
+	attach(at WorldPoint, chunk *Grid[T])
+}
+
+// NewWorld returns a new, empty world where every tile has the default value.
+func NewWorld(fill Value, opts ...Option) *World[string] {
+	return NewWorldOf[string](fill, opts...)
+}
+
+// NewWorldOf returns a new, empty world where every tile has the default value.
+func NewWorldOf[T comparable](fill Value, opts ...Option) *World[T] {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &World[T]{
+		store: o.store,
+		grace: o.grace,
+		fill:  fill,
+	}
+}
+
+// At returns the tile at a specified position. Since the tile can then be written,
+// its chunk is allocated if it wasn't already, so ValueAt() is preferable in order to
+// only read the value of a tile. The chunk of the tile is kept in memory through the
+// next call of Evict() and for the grace period of the world, but the tile must not be
+// kept for longer than that once its chunk is no longer in view, since the changes made
+// through it would then be lost.
+func (w *World[T]) At(x, y int32) Tile[T] {
+	at, p := chunkOf(x, y)
+	c := w.acquire(at)
+	c.used.Store(true)
+	tile, _ := c.At(p.X, p.Y)
+	c.release()
+	return tile
+}
+
+// ValueAt returns the value of the tile at a specified position, or the default value
+// of the world if the tile was never written.
+func (w *World[T]) ValueAt(x, y int32) Value {
+	at, p := chunkOf(x, y)
+	if c := w.lookup(at); c != nil {
+		return c.valueAt(p.X, p.Y)
+	}
+	return w.fill
+}
+
+// WriteAt updates the entire tile value at a specific coordinate
+func (w *World[T]) WriteAt(x, y int32, tile Value) {
+	at, p := chunkOf(x, y)
+	c := w.acquire(at)
+	c.WriteAt(p.X, p.Y, tile)
+	c.release()
+}
+
+// MaskAt atomically updates the bits of tile at a specific coordinate. The bits are
+// specified by the mask. The bits that need to be updated should be flipped on in the
+// mask. It returns the value of the tile before and after the update.
+func (w *World[T]) MaskAt(x, y int32, tile, mask Value) (old, new Value) {
+	at, p := chunkOf(x, y)
+	c := w.acquire(at)
+	defer c.release()
+	return c.MaskAt(p.X, p.Y, tile, mask)
+}
+
+// MergeAt atomically merges the tile by applying a merging function at a specific
+// coordinate. It returns the value of the tile before and after the merge.
+func (w *World[T]) MergeAt(x, y int32, merge func(Value) Value) (old, new Value) {
+	at, p := chunkOf(x, y)
+	c := w.acquire(at)
+	defer c.release()
+	return c.MergeAt(p.X, p.Y, merge)
+}
+
+// Each iterates over all of the tiles of the chunks which are in memory.
+func (w *World[T]) Each(fn func(WorldPoint, Tile[T])) {
+	w.chunks.Range(func(key, value any) bool {
+		origin := chunkOrigin(key.(WorldPoint))
+		value.(*chunk[T]).Each(func(p Point, tile Tile[T]) {
+			fn(origin.offset(p), tile)
+		})
+		return true
+	})
+}
+
+// Within selects the tiles of the allocated chunks within a specifid bounding box
+// which is specified by north-west and south-east coordinates.
+func (w *World[T]) Within(nw, se WorldPoint, fn func(WorldPoint, Tile[T])) {
+	type found struct {
+		at    WorldPoint
+		chunk *Grid[T]
+	}
+
+	// Collect the chunks first, since the function might allocate other chunks
+	var chunks []found
+	box := WorldRect{Min: nw, Max: se}
+	w.mu.Lock()
+	w.chunksWithin(box, true, func(at WorldPoint, chunk *Grid[T]) {
+		chunks = append(chunks, found{at: at, chunk: chunk})
+	})
+	w.mu.Unlock()
+
+	for _, c := range chunks {
+		origin := chunkOrigin(c.at)
+		r := localRect(box, origin)
+		c.chunk.Within(r.Min, r.Max, func(p Point, tile Tile[T]) {
+			fn(origin.offset(p), tile)
+		})
+	}
+}
+
+// resident returns the chunk at a position if it is in memory, or nil
+func (w *World[T]) resident(at WorldPoint) *chunk[T] {
+	if v, ok := w.chunks.Load(at); ok {
+		return v.(*chunk[T])
+	}
+	return nil
+}
+
+// lookup returns the chunk at a position, loading it from the store if necessary, or
+// nil if it was never allocated.
+func (w *World[T]) lookup(at WorldPoint) *chunk[T] {
+	if c := w.resident(at); c != nil || w.store == nil {
+		return c
+	}
+
+	if _, ok := w.absent.Load(at); ok {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.load(at, false)
+}
+
+// acquire returns the chunk at a position, loading or allocating it if necessary, and
+// prevents it from being evicted until it is released.
+func (w *World[T]) acquire(at WorldPoint) *chunk[T] {
+	for {
+		c := w.resident(at)
+		if c == nil {
+			w.mu.Lock()
+			c = w.load(at, true)
+			w.mu.Unlock()
+		}
+
+		// If the chunk is being evicted, wait for it and load it again
+		if c.pins.Add(1); !c.evicted.Load() {
+			return c
+		}
+		c.pins.Add(-1)
+		c.saving.Lock()
+		c.saving.Unlock()
+	}
+}
+
+// release allows the chunk to be evicted again
+func (c *chunk[T]) release() {
+	c.pins.Add(-1)
+}
+
+// load returns the chunk at a position, loading it from the store or allocating it if
+// necessary. The views observe the chunk before any write can happen on it, and the
+// world must be locked.
+func (w *World[T]) load(at WorldPoint, create bool) *chunk[T] {
+	if c := w.resident(at); c != nil {
+		return c
+	}
+
+	c, err := w.restore(at)
+	switch {
+	case err != nil:
+		w.errs = append(w.errs, err)
+		if !create {
+			return nil
+		}
+
+		// Never overwrite the chunk in the store, since it could not be read
+		c = w.newChunk()
+		c.keep = true
+	case c == nil && !create:
+		return nil
+	case c == nil:
+		c = w.newChunk()
+	}
+
+	for _, view := range w.views {
+		view.attach(at, c.Grid)
+	}
+
+	w.absent.Delete(at)
+	w.chunks.Store(at, c)
+	return c
+}
+
+// newChunk allocates a new chunk, filled with the default value
+func (w *World[T]) newChunk() *chunk[T] {
+	c := &chunk[T]{Grid: NewGridOf[T](chunkSize, chunkSize)}
+	if w.fill != 0 {
+		for i := range c.pages {
+			for j := range c.pages[i].tiles {
+				c.pages[i].tiles[j] = w.fill
+			}
+		}
+	}
+	return c
+}
+
+// chunksWithin selects the chunks which overlap a bounding box, and loads them from the
+// store if specified. The world must be locked.
+func (w *World[T]) chunksWithin(box WorldRect, load bool, fn func(WorldPoint, *Grid[T])) {
+	if box.Max.X <= box.Min.X || box.Max.Y <= box.Min.Y {
+		return
+	}
+
+	nw, _ := chunkOf(box.Min.X, box.Min.Y)
+	se, _ := chunkOf(box.Max.X-1, box.Max.Y-1)
+	for y := nw.Y; y <= se.Y; y++ {
+		for x := nw.X; x <= se.X; x++ {
+			c := w.resident(WorldAt(x, y))
+			if c == nil && load && w.store != nil {
+				c = w.load(WorldAt(x, y), false)
+			}
+
+			if c != nil {
+				fn(WorldAt(x, y), c.Grid)
+			}
+		}
+	}
+}
+
+// chunkOf returns the position of the chunk containing a point, and the point within
+// the chunk.
+func chunkOf(x, y int32) (WorldPoint, Point) {
+	dx, dy := mod(x, chunkSize), mod(y, chunkSize)
+	return WorldAt((x-dx)/chunkSize, (y-dy)/chunkSize), At(int16(dx), int16(dy))
+}
+
+// chunkOrigin returns the world point of the north-west corner of a chunk
+func chunkOrigin(at WorldPoint) WorldPoint {
+	return WorldAt(at.X*chunkSize, at.Y*chunkSize)
+}
+
+// localRect returns the part of a bounding box which is within the chunk starting at
+// an origin, relative to the chunk. The rectangle is empty if they don't overlap.
+func localRect(box WorldRect, origin WorldPoint) Rect {
+	x1, y1 := max(box.Min.X-origin.X, 0), max(box.Min.Y-origin.Y, 0)
+	x2, y2 := min(box.Max.X-origin.X, chunkSize), min(box.Max.Y-origin.Y, chunkSize)
+	if x2 <= x1 || y2 <= y1 {
+		return Rect{}
+	}
+
+	return NewRect(int16(x1), int16(y1), int16(x2), int16(y2))
+}
+
+// ---------------------------------- Path ----------------------------------
+
+// Path calculates a short path and the distance between two locations of the world,
+// where the tiles which were never written have the default value. Both locations
+// must be within 32767 tiles of each other on each axis. Since the world is unbounded,
+// a search towards an unreachable location should be limited with PathWith().
+func (w *World[T]) Path(from, to WorldPoint, costOf costFn) ([]WorldPoint, int, bool) {
+	return w.PathWith(from, to, costOf, PathOptions{})
+}
+
+// PathWith calculates a short path and the distance between two locations of the
+// world, given a set of options.
+func (w *World[T]) PathWith(from, to WorldPoint, costOf costFn, opts PathOptions) ([]WorldPoint, int, bool) {
+	delta := to.Subtract(from)
+	if delta.X < math.MinInt16 || delta.X > math.MaxInt16 || delta.Y < math.MinInt16 || delta.Y > math.MaxInt16 {
+		return nil, 0, false // Too far apart
+	}
+
+	// Read the cost of moving to a neighbor, relative to the start of the search
+	costAt := func(at Point, dir Direction) uint16 {
+		next := at.Move(dir)
+		if abs(int32(next.X)-int32(at.X)) > 1 || abs(int32(next.Y)-int32(at.Y)) > 1 {
+			return 0 // Out of the search range
+		}
+
+		p := from.offset(next)
+		return costOf(w.ValueAt(p.X, p.Y))
+	}
+
+	var expand func(Point, []edge) []edge
+	switch opts.Neighbors {
+	case EightWay:
+		if opts.Heuristic == nil {
+			opts.Heuristic = Octile
+		}
+
+		expand = func(at Point, dst []edge) []edge {
+			var open [8]uint16
+			for dir := North; dir <= NorthWest; dir++ {
+				open[dir] = costAt(at, dir)
+			}
+			return appendDiagonal(at, &open, opts.Diagonal, dst)
+		}
+	default:
+		if opts.Heuristic == nil {
+			opts.Heuristic = Manhattan
+		}
+
+		expand = func(at Point, dst []edge) []edge {
+			for _, dir := range [4]Direction{North, East, South, West} {
+				if cost := costAt(at, dir); cost > 0 {
+					dst = append(dst, edge{Point: at.Move(dir), Cost: uint32(cost)})
+				}
+			}
+			return dst
+		}
+	}
+
+	// The search happens on the points relative to the start, which is the same as
+	// searching an empty grid that doesn't wrap around.
+	var local Grid[T]
+	path, dist, found := local.search(At(0, 0), At(int16(delta.X), int16(delta.Y)), expand, &opts)
+	if path == nil {
+		return nil, dist, found
+	}
+
+	out := make([]WorldPoint, 0, len(path))
+	for _, p := range path {
+		out = append(out, from.offset(p))
+	}
+	return out, dist, found
+}
+
+// ---------------------------------- Store ----------------------------------
+
+// WriteTo writes the chunks of the world which are in memory to a specific writer.
+func (w *World[T]) WriteTo(dst io.Writer) (n int64, err error) {
+	var chunks []WorldPoint
+	w.chunks.Range(func(key, _ any) bool {
+		chunks = append(chunks, key.(WorldPoint))
+		return true
+	})
+
+	slices.SortFunc(chunks, func(a, b WorldPoint) int {
+		return cmp.Or(cmp.Compare(a.Y, b.Y), cmp.Compare(a.X, b.X))
+	})
+
+	// Write the default value and the number of chunks
+	out := iostream.NewWriter(dst)
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header[0:4], w.fill)
+	binary.BigEndian.PutUint32(header[4:8], uint32(len(chunks)))
+	if _, err := out.Write(header); err != nil {
+		return out.Offset(), err
+	}
+
+	// Write the position and the pages of every chunk
+	for _, at := range chunks {
+		binary.BigEndian.PutUint32(header[0:4], uint32(at.X))
+		binary.BigEndian.PutUint32(header[4:8], uint32(at.Y))
+		if _, err := out.Write(header); err != nil {
+			return out.Offset(), err
+		}
+
+		if err := writeChunk(out, w.resident(at).Grid); err != nil {
+			return out.Offset(), err
+		}
+	}
+	return out.Offset(), nil
+}
+
+// ReadWorldFrom reads the world from the reader.
+func ReadWorldFrom[T comparable](src io.Reader) (*World[T], error) {
+	r := iostream.NewReader(src)
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	world := NewWorldOf[T](binary.BigEndian.Uint32(header[0:4]))
+	count := int(binary.BigEndian.Uint32(header[4:8]))
+	for i := 0; i < count; i++ {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, err
+		}
+
+		c := &chunk[T]{Grid: NewGridOf[T](chunkSize, chunkSize)}
+		if err := readChunk(r, c.Grid); err != nil {
+			return nil, err
+		}
+
+		at := WorldAt(int32(binary.BigEndian.Uint32(header[0:4])), int32(binary.BigEndian.Uint32(header[4:8])))
+		world.chunks.Store(at, c)
+	}
+	return world, nil
+}
+
+// writeChunk writes the tiles of a chunk to a specific writer
+func writeChunk[T comparable](dst io.Writer, chunk *Grid[T]) error {
+	for i := range chunk.pages {
+		buffer := (*[tileDataSize]byte)(unsafe.Pointer(&chunk.pages[i].tiles))[:]
+		if _, err := dst.Write(buffer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readChunk reads the tiles of a chunk from a specific reader
+func readChunk[T comparable](src io.Reader, chunk *Grid[T]) error {
+	for i := range chunk.pages {
+		buffer := (*[tileDataSize]byte)(unsafe.Pointer(&chunk.pages[i].tiles))[:]
+		if _, err := io.ReadFull(src, buffer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ---------------------------------- View ----------------------------------
+
+// WorldView represents a view which can monitor a collection of tiles of a world,
+// across several chunks. Type parameters S and T are the state and tile types
+// respectively.
+type WorldView[S any, T comparable] struct {
+	outbox[WorldUpdate[T], *WorldUpdate[T], WorldPoint, T]
+	World  *World[T]                        // The associated world
+	Inbox  chan WorldUpdate[T]              // The update inbox for the view
+	State  S                                // The state of the view
+	rect   WorldRect                        // The view box, protected by the world
+	chunks map[WorldPoint]*worldChunk[S, T] // The observers of the chunks in view
+	filter atomic.Pointer[Filter[T]]        // The filter of the updates, if any
+}
+
+// NewWorldView creates a new view for a world with a given state. State can be
+// anything that is passed to the view and can be used to store additional information.
+// The updates are delivered to the inbox according to the options, as for NewView().
+func NewWorldView[S any, T comparable](w *World[T], state S, opts ...ViewOption) *WorldView[S, T] {
+	v := &WorldView[S, T]{
+		World:  w,
+		State:  state,
+		chunks: make(map[WorldPoint]*worldChunk[S, T], 4),
+	}
+	v.Inbox = v.open(newViewOptions(opts))
+
+	w.mu.Lock()
+	w.views = append(w.views, v)
+	w.mu.Unlock()
+	return v
+}
+
+// Viewport returns the current viewport of the view.
+func (v *WorldView[S, T]) Viewport() WorldRect {
+	v.World.mu.Lock()
+	defer v.World.mu.Unlock()
+	return v.rect
+}
+
+// Resize resizes the viewport and calls the function for each of the tiles which are
+// now in view, only for the chunks which were allocated. The chunks which are now in
+// view are loaded from the store of the world, if any.
+func (v *WorldView[S, T]) Resize(view WorldRect, fn func(WorldPoint, Tile[T])) {
+	w := v.World
+	w.mu.Lock()
+	prev := v.rect
+	v.rect = view
+	w.chunksWithin(prev, false, v.attach)
+	w.chunksWithin(view, true, v.attach)
+	w.mu.Unlock()
+
+	// Callback for each new tile in the view
+	if fn != nil {
+		w.Within(view.Min, view.Max, func(p WorldPoint, tile Tile[T]) {
+			if !prev.Contains(p) {
+				fn(p, tile)
+			}
+		})
+	}
+}
+
+// MoveBy moves the viewport towards a particular direction.
+func (v *WorldView[S, T]) MoveBy(x, y int32, fn func(WorldPoint, Tile[T])) {
+	r := v.Viewport()
+	v.Resize(WorldRect{
+		Min: r.Min.Add(WorldAt(x, y)),
+		Max: r.Max.Add(WorldAt(x, y)),
+	}, fn)
+}
+
+// MoveAt moves the viewport to a specific coordinate.
+func (v *WorldView[S, T]) MoveAt(nw WorldPoint, fn func(WorldPoint, Tile[T])) {
+	r := v.Viewport()
+	v.Resize(WorldRect{
+		Min: nw,
+		Max: nw.Add(r.Max.Subtract(r.Min)),
+	}, fn)
+}
+
+// Each iterates over all of the tiles in the view, for the allocated chunks.
+func (v *WorldView[S, T]) Each(fn func(WorldPoint, Tile[T])) {
+	r := v.Viewport()
+	v.World.Within(r.Min, r.Max, fn)
+}
+
+// At returns the tile at a specified position.
+func (v *WorldView[S, T]) At(x, y int32) Tile[T] {
+	return v.World.At(x, y)
+}
+
+// WriteAt updates the entire tile at a specific coordinate.
+func (v *WorldView[S, T]) WriteAt(x, y int32, tile Value) {
+	v.World.WriteAt(x, y, tile)
+}
+
+// MergeAt updates the bits of tile at a specific coordinate. The bits are specified
+// by the mask. The bits that need to be updated should be flipped on in the mask.
+func (v *WorldView[S, T]) MergeAt(x, y int32, tile, mask Value) {
+	v.World.MaskAt(x, y, tile, mask)
+}
+
+// Dropped returns the number of updates which were dropped, since the inbox was full.
+func (v *WorldView[S, T]) Dropped() uint64 {
+	return v.dropped.Load()
+}
+
+// Coalesced returns the number of updates which were merged into a pending update of
+// the same tile.
+func (v *WorldView[S, T]) Coalesced() uint64 {
+	return v.coalesced.Load()
+}
+
+// Close closes the view and unsubscribes from everything.
+func (v *WorldView[S, T]) Close() error {
+	v.close()
+	w := v.World
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	v.rect = WorldRect{}
+	for at, chunk := range v.chunks {
+		chunk.move(Rect{})
+		delete(v.chunks, at)
+	}
+
+	w.views = slices.DeleteFunc(w.views, func(o worldObserver[T]) bool {
+		return o == worldObserver[T](v)
+	})
+	return nil
+}
+
+// attach observes the part of a chunk which is in view, the world must be locked
+func (v *WorldView[S, T]) attach(at WorldPoint, chunk *Grid[T]) {
+	origin := chunkOrigin(at)
+	r := localRect(v.rect, origin)
+	observer, ok := v.chunks[at]
+	switch {
+	case !ok && r.IsZero():
+		return // Not in view
+	case !ok:
+		observer = &worldChunk[S, T]{view: v, grid: chunk, origin: origin}
+		v.chunks[at] = observer
+	case r.IsZero():
+		delete(v.chunks, at)
+	}
+
+	observer.move(r)
+}
+
+// worldChunk represents an observer of a single chunk, on behalf of a world view.
+type worldChunk[S any, T comparable] struct {
+	view   *WorldView[S, T] // The world view
+	grid   *Grid[T]         // The chunk
+	origin WorldPoint       // The world point of the north-west corner of the chunk
+	rect   atomic.Uint64    // The view box within the chunk
+}
+
+// Viewport returns the part of the chunk which is in view.
+func (c *worldChunk[S, T]) Viewport() Rect {
+	return unpackRect(c.rect.Load())
+}
+
+// Resize does nothing, since the world view moves the observers of its chunks.
+func (c *worldChunk[S, T]) Resize(Rect, func(Point, Tile[T])) {}
+
+// move moves the part of the chunk which is in view, and observes its pages
+func (c *worldChunk[S, T]) move(view Rect) {
+	m := c.grid
+	prev := unpackRect(c.rect.Swap(view.pack()))
+
+	// Pages which are no longer in view
+	m.pagesWithin(prev.Min, prev.Max, func(page *page[T]) {
+		if r := page.Bounds(); prev.Intersects(r) && !view.Intersects(r) {
+			if m.observers.Unsubscribe(page.point, c) {
+				page.SetObserved(false)
+			}
+		}
+	})
+
+	// Pages which are now in view
+	m.pagesWithin(view.Min, view.Max, func(page *page[T]) {
+		if r := page.Bounds(); view.Intersects(r) && !prev.Intersects(r) {
+			if m.observers.Subscribe(page.point, c) {
+				page.SetObserved(true)
+			}
+		}
+	})
+}
+
+// onUpdate occurs when a tile of the chunk has updated.
+func (c *worldChunk[S, T]) onUpdate(ev *Update[T]) {
+	if filter := c.view.filter.Load(); filter != nil && !filter.allows(ev) {
+		return // Filtered out
+	}
+
+	update := c.convert(ev)
+	c.view.send.Lock()
+	c.view.deliver(&update)
+	c.view.send.Unlock()
+}
+
+// convert converts an update of the chunk into an update of the world
+func (c *worldChunk[S, T]) convert(ev *Update[T]) WorldUpdate[T] {
+	return WorldUpdate[T]{
+		Old:    WorldValueAt{WorldPoint: c.origin.offset(ev.Old.Point), Value: ev.Old.Value},
+		New:    WorldValueAt{WorldPoint: c.origin.offset(ev.New.Point), Value: ev.New.Value},
+		Add:    ev.Add,
+		Del:    ev.Del,
+		Seq:    ev.Seq,
+		Origin: ev.Origin,
+		Kind:   ev.Kind,
+	}
+}
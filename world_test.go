@@ -0,0 +1,256 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+cpu: Intel(R) Xeon(R) Processor
+BenchmarkWorld/read         	44466645	        28.13 ns/op	       0 B/op	       0 allocs/op
+BenchmarkWorld/write        	19700745	        58.72 ns/op	       0 B/op	       0 allocs/op
+BenchmarkWorld/path         	     420	   2811959 ns/op	    3264 B/op	       5 allocs/op
+*/
+func BenchmarkWorld(b *testing.B) {
+	w := NewWorld(0)
+	for y := int32(-100); y < 100; y++ {
+		for x := int32(-100); x < 100; x++ {
+			if x == 10 && y > -50 && y < 50 {
+				w.WriteAt(x, y, 1)
+			}
+		}
+	}
+
+	b.Run("read", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			w.ValueAt(int32(n%1000)-500, 10)
+		}
+	})
+
+	b.Run("write", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			w.WriteAt(int32(n%200)-100, 20, Value(n%2)*2)
+		}
+	})
+
+	b.Run("path", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			w.Path(WorldAt(-20, 0), WorldAt(40, 0), costOf)
+		}
+	})
+}
+
+func TestWorld(t *testing.T) {
+	w := NewWorld(0xff)
+
+	// Reading does not allocate anything
+	assert.Equal(t, Value(0xff), w.ValueAt(1_000_000, -1_000_000))
+	assert.Equal(t, 0, countChunks(w))
+
+	// Writing allocates the chunk, filled with the default value
+	w.WriteAt(1_000_000, -1_000_000, 1)
+	assert.Equal(t, 1, countChunks(w))
+	assert.Equal(t, Value(1), w.ValueAt(1_000_000, -1_000_000))
+	assert.Equal(t, Value(0xff), w.ValueAt(1_000_001, -1_000_000))
+
+	// Negative coordinates map to their own chunks
+	w.WriteAt(-1, -1, 2)
+	w.WriteAt(0, 0, 3)
+	assert.Equal(t, 3, countChunks(w))
+	assert.Equal(t, Value(2), w.ValueAt(-1, -1))
+	assert.Equal(t, Value(3), w.ValueAt(0, 0))
+
+	old, new := w.MaskAt(-1, -1, 0b100, 0b100)
+	assert.Equal(t, Value(2), old)
+	assert.Equal(t, Value(6), new)
+	old, new = w.MergeAt(-48, -48, func(v Value) Value { return v + 1 })
+	assert.Equal(t, Value(0xff), old)
+	assert.Equal(t, Value(0x100), new)
+
+	// The tiles can hold objects
+	tile := w.At(-1, -1)
+	tile.Add("A")
+	assert.Equal(t, []string{"A"}, objectsOf(w.At(-1, -1)))
+}
+
+func TestWorldWithin(t *testing.T) {
+	w := NewWorld(0)
+	w.WriteAt(-1, -1, 1)
+	w.WriteAt(47, 47, 2)
+	w.WriteAt(48, 48, 3)
+	w.WriteAt(500, 500, 4)
+
+	var points []WorldPoint
+	w.Within(WorldAt(-1, -1), WorldAt(49, 49), func(p WorldPoint, tile Tile[string]) {
+		if tile.Value() != 0 {
+			points = append(points, p)
+		}
+	})
+	assert.ElementsMatch(t, []WorldPoint{WorldAt(-1, -1), WorldAt(47, 47), WorldAt(48, 48)}, points)
+
+	count := 0
+	w.Each(func(p WorldPoint, tile Tile[string]) {
+		count++
+	})
+	assert.Equal(t, 4*chunkSize*chunkSize, count)
+}
+
+func TestWorldPath(t *testing.T) {
+	w := NewWorld(0)
+
+	// A wall along the boundary of the chunks, which must be walked around
+	for y := int32(-20); y < 20; y++ {
+		w.WriteAt(0, y, 1)
+	}
+
+	path, dist, found := w.Path(WorldAt(-5, 0), WorldAt(5, 0), costOf)
+	assert.True(t, found)
+	assert.Equal(t, 50, dist)
+	assert.Equal(t, WorldAt(-5, 0), path[0])
+	assert.Equal(t, WorldAt(5, 0), path[len(path)-1])
+	for _, p := range path {
+		assert.Zero(t, w.ValueAt(p.X, p.Y))
+	}
+
+	// Diagonal moves
+	_, dist, found = w.PathWith(WorldAt(-5, 0), WorldAt(5, 0), costOf, PathOptions{
+		Neighbors: EightWay,
+	})
+	assert.True(t, found)
+	assert.Equal(t, 2*(7*5+5*15), dist)
+
+	// Too far apart
+	_, _, found = w.Path(WorldAt(-40000, 0), WorldAt(40000, 0), costOf)
+	assert.False(t, found)
+}
+
+func TestWorldView(t *testing.T) {
+	w := NewWorld(0)
+	w.WriteAt(-2, -2, 1)
+
+	v := NewWorldView(w, "view 1")
+	defer v.Close()
+
+	// The view straddles four chunks, only one of them is allocated
+	count := 0
+	v.Resize(NewWorldRect(-5, -5, 5, 5), func(p WorldPoint, tile Tile[string]) {
+		count++
+	})
+	assert.Equal(t, 25, count)
+
+	// Updates of the allocated chunk, as well as of the newly allocated ones
+	w.WriteAt(-2, -2, 2)
+	w.WriteAt(2, 2, 3)
+	w.WriteAt(10, 10, 4)
+	assert.Equal(t, WorldUpdate[string]{
+		Old:  WorldValueAt{WorldAt(-2, -2), 1},
+		New:  WorldValueAt{WorldAt(-2, -2), 2},
+		Seq:  1,
+		Kind: ValueChanged,
+	}, <-v.Inbox)
+	assert.Equal(t, WorldAt(2, 2), (<-v.Inbox).New.WorldPoint)
+	assert.Len(t, v.Inbox, 0)
+
+	// The origin of the change is carried along
+	w.At(4, -1).WithOrigin(7).Add("A")
+	ev := <-v.Inbox
+	assert.Equal(t, "A", ev.Add)
+	assert.Equal(t, uint32(7), ev.Origin)
+	assert.Equal(t, uint64(1), ev.Seq)
+
+	// Move the view away
+	v.MoveBy(100, 0, nil)
+	assert.Equal(t, NewWorldRect(95, -5, 105, 5), v.Viewport())
+	w.WriteAt(2, 2, 5)
+	assert.Len(t, v.Inbox, 0)
+
+	// Once closed, the pages are no longer observed
+	v.MoveAt(WorldAt(0, 0), nil)
+	assert.NoError(t, v.Close())
+	w.WriteAt(2, 2, 6)
+	assert.Len(t, v.Inbox, 0)
+	assert.False(t, w.resident(WorldAt(0, 0)).pageAt(0, 0).IsObserved())
+	assert.Len(t, w.views, 0)
+}
+
+func TestWorldViewDelivery(t *testing.T) {
+	w := NewWorld(0)
+	v := NewWorldView(w, "view 1", WithDelivery(DeliverDropNewest), WithInbox(2))
+	defer v.Close()
+	v.Resize(NewWorldRect(-50, -50, 50, 50), nil)
+
+	// The writers are not blocked by the full inbox, across the chunks
+	for i := int32(0); i < 5; i++ {
+		w.WriteAt(i*20-50, 0, Value(i+1))
+	}
+	assert.Len(t, v.Inbox, 2)
+	assert.Equal(t, uint64(3), v.Dropped())
+	assert.Equal(t, WorldAt(-50, 0), (<-v.Inbox).New.WorldPoint)
+	assert.Equal(t, WorldAt(-30, 0), (<-v.Inbox).New.WorldPoint)
+}
+
+func TestWorldViewCoalesce(t *testing.T) {
+	w := NewWorld(0)
+	v := NewWorldView(w, "view 1", WithDelivery(DeliverCoalesce), WithInbox(1))
+	defer v.Close()
+	v.Resize(NewWorldRect(-50, -50, 50, 50), nil)
+
+	// The writers are never blocked, and the updates of a tile are merged together
+	for i := Value(1); i <= 100; i++ {
+		w.WriteAt(-10, -10, i)
+	}
+
+	received, last := 0, Value(0)
+	for last != 100 {
+		ev := <-v.Inbox
+		assert.Equal(t, WorldAt(-10, -10), ev.New.WorldPoint)
+		assert.Equal(t, last, ev.Old.Value)
+		last = ev.New.Value
+		received++
+	}
+	assert.Equal(t, 100, received+int(v.Coalesced()))
+}
+
+func TestWorldStore(t *testing.T) {
+	w := NewWorld(7)
+	w.WriteAt(-100, 3, 1)
+	w.WriteAt(100_000, 3, 2)
+
+	buffer := bytes.NewBuffer(nil)
+	n, err := w.WriteTo(buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(buffer.Len()), n)
+	truncated := bytes.Clone(buffer.Bytes()[:100])
+
+	out, err := ReadWorldFrom[string](buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, countChunks(out))
+	assert.Equal(t, Value(1), out.ValueAt(-100, 3))
+	assert.Equal(t, Value(2), out.ValueAt(100_000, 3))
+	assert.Equal(t, Value(7), out.ValueAt(-101, 3))
+	assert.Equal(t, Value(7), out.ValueAt(0, 0))
+
+	// Truncated input
+	_, err = ReadWorldFrom[string](bytes.NewBuffer(truncated))
+	assert.Error(t, err)
+}
+
+// countChunks returns the number of chunks which were allocated
+func countChunks[T comparable](w *World[T]) (count int) {
+	w.chunks.Range(func(_, _ any) bool {
+		count++
+		return true
+	})
+	return
+}
@@ -0,0 +1,178 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import "time"
+
+// Option represents an option of the grid, which can be provided to NewGridOf(), or
+// of the world, which can be provided to NewWorldOf().
+type Option func(*options)
+
+// options represents the configuration of a grid or a world
+type options struct {
+	wrapX, wrapY bool          // Whether the edges of the grid are connected
+	store        ChunkStore    // The backing store of the chunks of the world
+	grace        time.Duration // The grace period before evicting the chunks
+}
+
+// WithWrap connects the opposite edges of the grid, horizontally and/or vertically,
+// which makes for a toroidal world. The coordinates are then wrapped around when
+// reading, writing or searching the grid, and the views can straddle the seam.
+//
+// Jump point search, hierarchical paths, flow fields, distance maps, field of view and
+// raycasting stop at the edges of the grid and do not wrap around.
+func WithWrap(horizontal, vertical bool) Option {
+	return func(o *options) {
+		o.wrapX = horizontal
+		o.wrapY = vertical
+	}
+}
+
+// wrapAt wraps the coordinates around the edges of the grid, if enabled. The unsigned
+// comparisons check for both edges at once, and keep it cheap enough to be inlined.
+func (m *Grid[T]) wrapAt(x, y int16) (int16, int16) {
+	if w := m.wrap.X; w != 0 && uint16(x) >= uint16(w) {
+		x = int16(mod(int32(x), int32(w)))
+	}
+	if h := m.wrap.Y; h != 0 && uint16(y) >= uint16(h) {
+		y = int16(mod(int32(y), int32(h)))
+	}
+	return x, y
+}
+
+// wrapPoint wraps a point around the edges of the grid, if enabled
+func (m *Grid[T]) wrapPoint(p Point) Point {
+	p.X, p.Y = m.wrapAt(p.X, p.Y)
+	return p
+}
+
+// wrapRect moves a rectangle by whole turns around the edges of the grid, if enabled,
+// so that its north-west corner is within the grid. The viewports which keep moving
+// across the seam then stay within reach of the copies of the tiles.
+func (m *Grid[T]) wrapRect(r Rect) Rect {
+	shift := m.wrapPoint(r.Min).Subtract(r.Min)
+	return Rect{Min: r.Min.Add(shift), Max: r.Max.Add(shift)}
+}
+
+// nearest returns the copy of a point which is the closest to another one, across the
+// edges of the grid, so that the distance and the direction between them are correct.
+func (m *Grid[T]) nearest(from, to Point) Point {
+	if m.wrap.X != 0 {
+		to.X = int16(int32(from.X) + shortest(int32(to.X)-int32(from.X), int32(m.wrap.X)))
+	}
+	if m.wrap.Y != 0 {
+		to.Y = int16(int32(from.Y) + shortest(int32(to.Y)-int32(from.Y), int32(m.wrap.Y)))
+	}
+	return to
+}
+
+// contains returns whether a rectangle contains a point, including any of its copies
+// across the edges of the grid.
+func (m *Grid[T]) contains(r Rect, p Point) bool {
+	return wrapContains(r, p, m.wrap)
+}
+
+// intersects returns whether two rectangles intersect, including any of the copies of
+// the second one across the edges of the grid.
+func (m *Grid[T]) intersects(a, b Rect) bool {
+	if m.wrap == (Point{}) {
+		return a.Intersects(b)
+	}
+
+	for _, dy := range offsets(m.wrap.Y) {
+		for _, dx := range offsets(m.wrap.X) {
+			shift := At(dx, dy)
+			if a.Intersects(Rect{Min: b.Min.Add(shift), Max: b.Max.Add(shift)}) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// split splits a rectangle with an inclusive bottom-right corner into up to four
+// rectangles within the grid, one for each side of the seams it straddles.
+func (m *Grid[T]) split(nw, se Point, fn func(nw, se Point)) {
+	if m.wrap == (Point{}) {
+		fn(nw, se)
+		return
+	}
+
+	xs, nx := segments(nw.X, se.X, m.wrap.X)
+	ys, ny := segments(nw.Y, se.Y, m.wrap.Y)
+	for i := 0; i < ny; i++ {
+		for j := 0; j < nx; j++ {
+			fn(At(xs[j][0], ys[i][0]), At(xs[j][1], ys[i][1]))
+		}
+	}
+}
+
+// wrapContains returns whether a rectangle contains a point, or any of its copies
+// across the edges of a grid of a given wrapped size.
+func wrapContains(r Rect, p Point, wrap Point) bool {
+	switch {
+	case r.Contains(p):
+		return true
+	case wrap == (Point{}):
+		return false
+	}
+
+	for _, dy := range offsets(wrap.Y) {
+		for _, dx := range offsets(wrap.X) {
+			if r.Contains(At(p.X+dx, p.Y+dy)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// segments splits an inclusive range along an axis into up to two ranges within the
+// axis, if it wraps around. An axis which doesn't wrap has a zero size.
+func segments(lo, hi, size int16) (out [2][2]int16, n int) {
+	switch {
+	case size == 0:
+		out[0] = [2]int16{lo, hi}
+		return out, 1
+	case int32(hi)-int32(lo)+1 >= int32(size):
+		out[0] = [2]int16{0, size - 1}
+		return out, 1
+	}
+
+	lo = int16(mod(int32(lo), int32(size)))
+	hi = int16(mod(int32(hi), int32(size)))
+	if lo <= hi {
+		out[0] = [2]int16{lo, hi}
+		return out, 1
+	}
+
+	out[0] = [2]int16{lo, size - 1}
+	out[1] = [2]int16{0, hi}
+	return out, 2
+}
+
+// offsets returns the offsets of the copies along an axis of a given wrapped size
+func offsets(size int16) []int16 {
+	if size == 0 {
+		return []int16{0}
+	}
+	return []int16{0, -size, size}
+}
+
+// shortest returns the shortest difference along an axis which wraps around
+func shortest(delta, size int32) int32 {
+	delta = mod(delta, size)
+	if delta > size/2 {
+		delta -= size
+	}
+	return delta
+}
+
+// mod returns the modulo which is always positive
+func mod(v, n int32) int32 {
+	if v %= n; v < 0 {
+		v += n
+	}
+	return v
+}
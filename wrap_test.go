@@ -0,0 +1,207 @@
+// Copyright (c) Roman Atachiants and contributors. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for details.
+
+package tile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+cpu: Intel(R) Xeon(R) Processor
+BenchmarkWrap/at            	146597242	         9.088 ns/op	       0 B/op	       0 allocs/op
+BenchmarkWrap/neighbors     	10198092	       103.1 ns/op	       0 B/op	       0 allocs/op
+BenchmarkWrap/path          	   17428	     72028 ns/op	     320 B/op	       2 allocs/op
+*/
+func BenchmarkWrap(b *testing.B) {
+	var d Tile[string]
+	var p Point
+	defer assert.NotNil(b, d)
+	m := NewGrid(300, 300, WithWrap(true, true))
+
+	b.Run("at", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			d, _ = m.At(-1, 301)
+		}
+	})
+
+	b.Run("neighbors", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			m.Neighbors(0, 299, func(point Point, tile Tile[string]) {
+				p = point
+				d = tile
+			})
+		}
+	})
+
+	b.Run("path", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			m.Path(At(290, 10), At(10, 10), costOf)
+		}
+	})
+
+	assert.NotNil(b, p)
+}
+
+func TestWrapAt(t *testing.T) {
+	m := NewGrid(9, 9, WithWrap(true, false))
+	m.WriteAt(-1, 4, Value(1))
+	m.WriteAt(9, 4, Value(2))
+
+	tile, ok := m.At(8, 4)
+	assert.True(t, ok)
+	assert.Equal(t, Value(1), tile.Value())
+
+	tile, ok = m.At(0, 4)
+	assert.True(t, ok)
+	assert.Equal(t, Value(2), tile.Value())
+
+	// The vertical edges are not connected
+	_, ok = m.At(4, -1)
+	assert.False(t, ok)
+	_, ok = m.At(4, 9)
+	assert.False(t, ok)
+}
+
+func TestWrapNeighbors(t *testing.T) {
+	m := NewGrid(9, 9, WithWrap(true, true))
+	var out []Point
+	m.Neighbors(0, 8, func(p Point, _ Tile[string]) {
+		out = append(out, p)
+	})
+
+	assert.ElementsMatch(t, []Point{
+		At(0, 7), At(1, 8), At(0, 0), At(8, 8),
+	}, out)
+
+	// Only a single axis wraps around
+	out = out[:0]
+	h := NewGrid(9, 9, WithWrap(true, false))
+	for p := range h.NeighborsOf(At(0, 8)) {
+		out = append(out, p)
+	}
+
+	assert.ElementsMatch(t, []Point{
+		At(0, 7), At(1, 8), At(8, 8),
+	}, out)
+}
+
+func TestWrapWithin(t *testing.T) {
+	m := NewGrid(9, 9, WithWrap(true, true))
+	var out []Point
+	m.Within(At(7, 8), At(10, 10), func(p Point, _ Tile[string]) {
+		out = append(out, p)
+	})
+
+	assert.ElementsMatch(t, []Point{
+		At(7, 8), At(8, 8), At(0, 8),
+		At(7, 0), At(8, 0), At(0, 0),
+	}, out)
+
+	// The iterator straddles the seam as well
+	out = out[:0]
+	for p := range m.InRect(NewRect(-1, 4, 1, 5)) {
+		out = append(out, p)
+	}
+	assert.ElementsMatch(t, []Point{At(8, 4), At(0, 4)}, out)
+}
+
+func TestWrapPath(t *testing.T) {
+	wall := func(m *Grid[string]) *Grid[string] {
+		for y := int16(0); y < 8; y++ {
+			m.WriteAt(4, y, Value(1))
+		}
+		return m
+	}
+
+	m := wall(NewGrid(9, 9, WithWrap(true, false)))
+	path, dist, found := m.Path(At(1, 4), At(7, 4), costOf)
+	assert.True(t, found)
+	assert.Equal(t, 3, dist)
+	assert.Equal(t, []Point{At(1, 4), At(0, 4), At(8, 4), At(7, 4)}, path)
+
+	// Diagonal paths also cross the seam
+	path, dist, found = m.PathDiagonal(At(1, 3), At(7, 4), costOf, DiagonalNoCorners)
+	assert.True(t, found)
+	assert.Equal(t, 3, len(path)-1)
+	assert.Equal(t, 2*costStraight+costDiagonal, dist)
+
+	// The same path on a grid without wrapping goes around the wall
+	plain := wall(NewGrid(9, 9))
+	_, dist, found = plain.Path(At(1, 4), At(7, 4), costOf)
+	assert.True(t, found)
+	assert.Equal(t, 14, dist)
+}
+
+func TestWrapAround(t *testing.T) {
+	m := NewGrid(9, 9, WithWrap(true, true))
+	var out []Point
+	m.Around(At(0, 0), 1, func(v Value) uint16 { return 1 }, func(p Point, _ Tile[string]) {
+		out = append(out, p)
+	})
+
+	assert.ElementsMatch(t, []Point{
+		At(0, 0), At(1, 0), At(0, 1), At(8, 0), At(0, 8),
+	}, out)
+
+	// Flooding reports the predecessors across the seam
+	prevs := map[Point]Point{}
+	m.Flood(At(0, 0), 2, func(v Value) uint16 { return 1 }, func(at Point, _ Tile[string], _ uint32, prev Point) {
+		prevs[at] = prev
+	})
+
+	assert.Equal(t, At(8, 0), prevs[At(7, 0)])
+	assert.Equal(t, At(0, 0), prevs[At(8, 0)])
+}
+
+func TestWrapView(t *testing.T) {
+	m := NewGrid(9, 9, WithWrap(true, false))
+	v := NewView(m, "view 1")
+	v.Resize(NewRect(-3, 0, 3, 9), nil)
+	defer v.Close()
+
+	// Updates on both sides of the seam are received
+	m.WriteAt(1, 1, Value(1))
+	assert.Equal(t, At(1, 1), (<-v.Inbox).New.Point)
+	m.WriteAt(7, 1, Value(2))
+	assert.Equal(t, At(7, 1), (<-v.Inbox).New.Point)
+
+	// While the tiles outside of the view are not
+	m.WriteAt(4, 1, Value(3))
+	assert.Len(t, v.Inbox, 0)
+}
+
+func TestWrapViewMove(t *testing.T) {
+	m := NewGrid(30, 30, WithWrap(true, false))
+	v := NewView(m, "view 1")
+	v.Resize(NewRect(0, 0, 6, 6), nil)
+	defer v.Close()
+
+	// Keep moving the view around the grid, several times over
+	for i := 0; i < 20; i++ {
+		v.MoveBy(3, 0, nil)
+	}
+	assert.Equal(t, NewRect(0, 0, 6, 6), v.Viewport())
+	for p, tile := range m.All() {
+		assert.Equal(t, p.X < 6 && p.Y < 6, tile.IsObserved(), p.String())
+	}
+
+	m.WriteAt(1, 1, Value(1))
+	assert.Equal(t, At(1, 1), (<-v.Inbox).New.Point)
+
+	// The viewport straddling the seam keeps its corner within the grid
+	v.MoveBy(-3, 0, nil)
+	assert.Equal(t, NewRect(27, 0, 33, 6), v.Viewport())
+	m.WriteAt(28, 1, Value(2))
+	assert.Equal(t, At(28, 1), (<-v.Inbox).New.Point)
+	m.WriteAt(2, 1, Value(3))
+	assert.Equal(t, At(2, 1), (<-v.Inbox).New.Point)
+}